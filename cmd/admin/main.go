@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"project/internal/commands"
+
+	"github.com/pkg/errors"
+)
+
+// admin runs maintenance commands that are not part of the service:
+//
+//	go run cmd/admin/main.go genkey
+//	go run cmd/admin/main.go -keys ./keys rotatekey
+//	go run cmd/admin/main.go -keys ./keys retirekey <kid>
+func main() {
+	keys := flag.String("keys", "./keys", "folder of the auth keys")
+	flag.Parse()
+
+	if err := run(*keys, flag.Args()); err != nil {
+		if errors.Cause(err) != commands.ErrHelp {
+			log.Println("admin: error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(keys string, args []string) error {
+	if len(args) == 0 {
+		fmt.Println("help: admin [-keys <folder>] genkey | rotatekey | retirekey <kid>")
+		return commands.ErrHelp
+	}
+
+	switch args[0] {
+	case "genkey":
+		return commands.GenKey()
+	case "rotatekey":
+		_, err := commands.RotateKey(keys)
+		return err
+	case "retirekey":
+		if len(args) < 2 {
+			fmt.Println("help: admin [-keys <folder>] retirekey <kid>")
+			return commands.ErrHelp
+		}
+		return commands.RetireKey(keys, args[1])
+	}
+
+	return errors.Errorf("unknown command %q", args[0])
+}
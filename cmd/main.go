@@ -1,20 +1,36 @@
 package main
 
 import (
-	"crypto/rsa"
+	"context"
 	"expvar"
 	"fmt"
 	"github.com/ardanlabs/conf"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/redis/go-redis/v9"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"project/foundation/logger"
+	"project/foundation/metrics"
+	"project/foundation/tracing"
 	"project/foundation/web"
 	"project/internal/auth"
 	"project/internal/commands"
+	"project/internal/debug"
+	"project/internal/middleware"
 	"project/internal/pkg/repository/postgresql"
+	"project/internal/repository/postgres/user"
 	"project/internal/router"
+	"project/internal/service/notify"
+	"project/internal/service/oidc"
+	"project/internal/service/password"
+	"project/internal/service/sms"
+	"project/internal/service/stats"
+	"project/internal/service/token"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -46,18 +62,28 @@ func run(log *log.Logger) error {
 		conf.Version
 		ServerBaseUrl string `conf:"default:http://gtm.rudi.uz"`
 		DefaultLang   string `conf:"default:uz"`
-		ServerPort    string `conf:"default:8039"`
 		Web           struct {
-			APIHost         string        `conf:"default:0.0.0.0:3000"`
+			APIHost         string        `conf:"default:0.0.0.0:8039"`
 			DebugHost       string        `conf:"default:0.0.0.0:4000"`
 			ReadTimeout     time.Duration `conf:"default:5s"`
-			WriteTimeout    time.Duration `conf:"default:5s"`
-			ShutdownTimeout time.Duration `conf:"default:5s"`
+			WriteTimeout    time.Duration `conf:"default:10s"`
+			ShutdownTimeout time.Duration `conf:"default:20s"`
 		}
 		Auth struct {
-			KeyID          string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
-			PrivateKeyFile string `conf:"default:./private.pem"`
-			Algorithm      string `conf:"default:RS256"`
+			KeyID                  string        `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
+			PrivateKeyFile         string        `conf:"default:./private.pem"`
+			Algorithm              string        `conf:"default:RS256"`
+			Issuer                 string        `conf:"default:backend-template"`
+			Audience               string        `conf:"default:backend-template"`
+			AccessLifetime         time.Duration `conf:"default:8h"`
+			RefreshLifetime        time.Duration `conf:"default:24h"`
+			MFALifetime            time.Duration `conf:"default:5m"`
+			ImpersonationLifetime  time.Duration `conf:"default:15m"`
+			PasswordChangeLifetime time.Duration `conf:"default:10m"`
+			KeysFolder             string        `conf:"default:./keys"`
+			ActiveKID              string        `conf:"help:kid of the signing key, the newest activated key when empty"`
+			KeyActivationDelay     time.Duration `conf:"default:2m"`
+			KeysReloadInterval     time.Duration `conf:"default:1m,help:keys are not reloaded when 0"`
 		}
 		Postgres struct {
 			User       string `conf:"default:postgres"`
@@ -66,16 +92,57 @@ func run(log *log.Logger) error {
 			Name       string `conf:"default:project"`
 			DisableTLS bool   `conf:"default:true"`
 		}
-		Zipkin struct {
-			ReporterURI string  `conf:"default:http://zipkin:9411/api/v2/spans"`
-			ServiceName string  `conf:"default:sale-api"`
+		Tracing struct {
+			Exporter    string  `conf:"default:none,help:otlp, zipkin, memory or none"`
+			OTLPHost    string  `conf:"default:localhost:4318"`
+			OTLPSecure  bool    `conf:"default:false"`
+			ReporterURI string  `conf:"default:http://zipkin:9411/api/v2/spans,help:span url of the zipkin collector"`
+			ServiceName string  `conf:"default:backend-template"`
 			Probability float64 `conf:"default:0.05"`
 		}
+		Log struct {
+			Stdout          bool     `conf:"default:true"`
+			File            string   `conf:"help:file the request logs are written to, they are not written to a file when empty"`
+			FileMaxSize     int64    `conf:"default:104857600,help:size in bytes a log file is rotated at"`
+			FileMaxBackups  int      `conf:"default:10"`
+			AlertDriver     string   `conf:"default:none,help:telegram or none, alerts are sent for server errors"`
+			TelegramToken   string   `conf:"mask"`
+			TelegramChatIDs []string `conf:"help:chats the telegram alerts are sent to"`
+		}
 		Redis struct {
 			Host string `conf:"default:localhost"`
 			Port string `conf:"default:6379"`
 			DB   int    `conf:"default:0"`
 		}
+		SMS struct {
+			Driver string `conf:"default:log"`
+		}
+		Notify struct {
+			Driver        string `conf:"default:log"`
+			ActivationURL string `conf:"default:http://localhost:3000/activate,help:page of the frontend invited users set their password at"`
+		}
+		MFA struct {
+			Issuer string `conf:"default:backend-template,help:name shown by authenticator apps"`
+		}
+		Password struct {
+			MinLength     int  `conf:"default:8"`
+			RequireUpper  bool `conf:"default:true"`
+			RequireLower  bool `conf:"default:true"`
+			RequireDigit  bool `conf:"default:true"`
+			RequireSymbol bool `conf:"default:false"`
+			RejectCommon  bool `conf:"default:true"`
+			History       int  `conf:"default:5,help:number of recent passwords that can not be used again"`
+			BcryptCost    int  `conf:"default:10,help:hashes of another cost are replaced on the next sign-in"`
+		}
+		OIDC struct {
+			IssuerURL     string `conf:"help:issuer of the identity provider, signing in through it is disabled when empty"`
+			ClientID      string
+			ClientSecret  string `conf:"mask"`
+			RedirectURL   string `conf:"help:page of the frontend the provider sends the code to"`
+			Scopes        string `conf:"default:openid email profile"`
+			Provision     bool   `conf:"default:false,help:create users for identities without a user"`
+			ProvisionRole string `conf:"default:EMPLOYEE"`
+		}
 	}
 	cfg.Version.SVN = build
 	cfg.Version.Desc = "copyright information here"
@@ -114,40 +181,111 @@ func run(log *log.Logger) error {
 	}
 	log.Printf("main: Config :\n%v\n", out)
 
+	// =========================================================================
+	// Start Tracing Support
+
+	log.Printf("main: Initializing tracing support : exporter %q", cfg.Tracing.Exporter)
+
+	endpoint := cfg.Tracing.OTLPHost
+	if cfg.Tracing.Exporter == tracing.ExporterZipkin {
+		endpoint = cfg.Tracing.ReporterURI
+	}
+
+	traceProvider, err := tracing.New(tracing.Config{
+		ServiceName: cfg.Tracing.ServiceName,
+		Version:     build,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    endpoint,
+		Insecure:    !cfg.Tracing.OTLPSecure,
+		Probability: cfg.Tracing.Probability,
+	})
+	if err != nil {
+		return errors.Wrap(err, "starting tracing")
+	}
+	defer func() {
+		log.Println("main: Tracing Stopping")
+		if err := traceProvider.Shutdown(cfg.Web.ShutdownTimeout); err != nil {
+			log.Printf("main: Tracing Stopping : %v", err)
+		}
+	}()
+
 	// =========================================================================
 	// Initialize authentication support
 
 	log.Println("main : Started : Initializing authentication support")
 
-	privatePEM, err := os.ReadFile(cfg.Auth.PrivateKeyFile)
+	// Every key of the folder is published and verifies tokens, the newest
+	// activated one signs them. The key file of older configs is kept as a key
+	// of the folder until it is removed.
+	keyFolder := auth.KeyFolder{
+		Path:            cfg.Auth.KeysFolder,
+		ActivationDelay: cfg.Auth.KeyActivationDelay,
+		Files:           map[string]string{cfg.Auth.KeyID: cfg.Auth.PrivateKeyFile},
+	}
+
+	keys, activeKID, err := loadAuthKeys(keyFolder, cfg.Auth.ActiveKID)
 	if err != nil {
-		return errors.Wrap(err, "reading auth private key")
+		return err
 	}
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+	auth, err := auth.New(cfg.Auth.Algorithm, nil, keys)
 	if err != nil {
-		return errors.Wrap(err, "parsing auth private key")
+		return errors.Wrap(err, "constructing auth")
 	}
 
-	lookup := func(kid string) (*rsa.PublicKey, error) {
-		switch kid {
-		case cfg.Auth.KeyID:
-			return &privateKey.PublicKey, nil
-		}
-		return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
+	if err = auth.SetActiveKID(activeKID); err != nil {
+		return errors.Wrap(err, "setting auth active key")
 	}
+	log.Printf("main : Auth keys : %d loaded : active %q", len(keys), activeKID)
 
-	auth, err := auth.New(cfg.Auth.Algorithm, lookup, auth.Keys{cfg.Auth.KeyID: privateKey})
-	if err != nil {
-		return errors.Wrap(err, "constructing auth")
+	tokenService := token.NewService(auth, token.Config{
+		Issuer:                 cfg.Auth.Issuer,
+		Audience:               cfg.Auth.Audience,
+		AccessLifetime:         cfg.Auth.AccessLifetime,
+		RefreshLifetime:        cfg.Auth.RefreshLifetime,
+		MFALifetime:            cfg.Auth.MFALifetime,
+		ImpersonationLifetime:  cfg.Auth.ImpersonationLifetime,
+		PasswordChangeLifetime: cfg.Auth.PasswordChangeLifetime,
+	})
+
+	// Keys added to or removed from the folder are picked up without restart.
+	// A zero interval turns reloading off.
+	if cfg.Auth.KeysReloadInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.Auth.KeysReloadInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				keys, activeKID, err := loadAuthKeys(keyFolder, cfg.Auth.ActiveKID)
+				if err != nil {
+					log.Printf("main : Auth keys : reloading : %v", err)
+					continue
+				}
+
+				if activeKID != auth.ActiveKID() {
+					log.Printf("main : Auth keys : active key changed to %q", activeKID)
+				}
+
+				if err = auth.SetKeys(keys, activeKID); err != nil {
+					log.Printf("main : Auth keys : reloading : %v", err)
+				}
+			}
+		}()
 	}
 
+	// =========================================================================
+	// Start Metrics
+
+	log.Println("main: Initializing metrics support")
+
+	registry := metrics.NewRegistry()
+
 	// =========================================================================
 	// Start Database: postgresql
 
 	log.Println("main: Initializing database support")
 
-	postgresDB := postgresql.NewDB(postgresql.Config{
+	postgresDB, err := postgresql.NewDB(postgresql.Config{
 		User:          cfg.Postgres.User,
 		Password:      cfg.Postgres.Password,
 		Host:          cfg.Postgres.Host,
@@ -159,10 +297,8 @@ func run(log *log.Logger) error {
 	if err != nil {
 		return errors.Wrap(err, "connecting to db")
 	}
-	defer func() {
-		log.Printf("main: Database Stopping : %s", cfg.Postgres.Host)
-		postgresDB.Close()
-	}()
+	postgresDB.AddQueryHook(postgresql.NewMetricsHook(registry))
+	registry.MustRegister(collectors.NewDBStatsCollector(postgresDB.DB.DB, cfg.Postgres.Name))
 
 	// =====================
 
@@ -176,19 +312,218 @@ func run(log *log.Logger) error {
 		Password: "",
 		DB:       cfg.Redis.DB,
 	})
+	redisDB.AddHook(tracing.NewRedisHook())
+	redisDB.AddHook(metrics.NewRedisHook(registry))
+
+	// The stores are closed once the server stopped, the database first.
+	defer func() {
+		log.Printf("main: Database Stopping : %s", cfg.Postgres.Host)
+		if err := postgresDB.Close(); err != nil {
+			log.Printf("main: Database Stopping : %v", err)
+		}
+
+		log.Printf("main: Cache Stopping : %s", cfg.Redis.Host)
+		if err := redisDB.Close(); err != nil {
+			log.Printf("main: Cache Stopping : %v", err)
+		}
+	}()
 
 	// ======================
 
+	// =========================================================================
+	// Start Debug Service
+
+	log.Printf("main: Initializing debug support : host %s", cfg.Web.DebugHost)
+
+	// The debug server has the timeouts of the API server and is shut down
+	// with it.
+	debugServer := http.Server{
+		Addr: cfg.Web.DebugHost,
+		Handler: debug.Mux(debug.Config{
+			Build:   build,
+			Log:     log,
+			DB:      postgresDB,
+			Redis:   redisDB,
+			Metrics: registry,
+		}),
+		ReadTimeout:  cfg.Web.ReadTimeout,
+		WriteTimeout: cfg.Web.WriteTimeout,
+		ErrorLog:     log,
+	}
+	defer debugServer.Close()
+
+	go func() {
+		if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("main: Debug Listener closed : %v", err)
+		}
+	}()
+
+	// =========================================================================
+	// Start SMS support
+
+	log.Printf("main: Initializing sms support : driver %q", cfg.SMS.Driver)
+
+	smsSender, err := sms.New(cfg.SMS.Driver, log)
+	if err != nil {
+		return errors.Wrap(err, "constructing sms sender")
+	}
+
+	// =========================================================================
+	// Start notification support
+
+	log.Printf("main: Initializing notify support : driver %q", cfg.Notify.Driver)
+
+	notifier, err := notify.New(cfg.Notify.Driver, log, cfg.Notify.ActivationURL)
+	if err != nil {
+		return errors.Wrap(err, "constructing notifier")
+	}
+
+	// =========================================================================
+	// Start password policy
+
+	passwordService, err := password.NewService(password.Config{
+		MinLength:     cfg.Password.MinLength,
+		RequireUpper:  cfg.Password.RequireUpper,
+		RequireLower:  cfg.Password.RequireLower,
+		RequireDigit:  cfg.Password.RequireDigit,
+		RequireSymbol: cfg.Password.RequireSymbol,
+		RejectCommon:  cfg.Password.RejectCommon,
+		HistorySize:   cfg.Password.History,
+		Cost:          cfg.Password.BcryptCost,
+	})
+	if err != nil {
+		return errors.Wrap(err, "constructing password service")
+	}
+
+	// =========================================================================
+	// Start OpenID Connect support
+
+	var oidcService *oidc.Service
+	if cfg.OIDC.IssuerURL != "" {
+		log.Printf("main: Initializing oidc support : issuer %q", cfg.OIDC.IssuerURL)
+
+		oidcService = oidc.NewService(oidc.Config{
+			IssuerURL:     cfg.OIDC.IssuerURL,
+			ClientID:      cfg.OIDC.ClientID,
+			ClientSecret:  cfg.OIDC.ClientSecret,
+			RedirectURL:   cfg.OIDC.RedirectURL,
+			Scopes:        strings.Fields(cfg.OIDC.Scopes),
+			Provision:     cfg.OIDC.Provision,
+			ProvisionRole: cfg.OIDC.ProvisionRole,
+		}, nil)
+	}
+
+	// =========================================================================
+	// Start request logging
+
+	log.Printf("main: Initializing request logging : stdout %t : file %q : alerts %q", cfg.Log.Stdout, cfg.Log.File, cfg.Log.AlertDriver)
+
+	var sinks []logger.Sink
+	if cfg.Log.Stdout {
+		sinks = append(sinks, logger.NewWriterSink(os.Stdout))
+	}
+
+	if cfg.Log.File != "" {
+		fileSink, err := logger.NewFileSink(cfg.Log.File, cfg.Log.FileMaxSize, cfg.Log.FileMaxBackups)
+		if err != nil {
+			return errors.Wrap(err, "opening log file")
+		}
+		defer fileSink.Close()
+
+		sinks = append(sinks, fileSink)
+	}
+
+	alerter, err := logger.NewAlerter(cfg.Log.AlertDriver, cfg.Log.TelegramToken, cfg.Log.TelegramChatIDs)
+	if err != nil {
+		return errors.Wrap(err, "constructing alerter")
+	}
+	if alerter != nil {
+		sinks = append(sinks, logger.NewAlertSink(alerter, log))
+	}
+
+	requestLogger := logger.New(log, sinks...)
+
+	// Make a channel to listen for an interrupt or terminate signal from the OS.
+	// Use a buffered channel because the signal package requires it.
 	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	// gin engine
-	webApp := web.NewApp(shutdown, cfg.DefaultLang)
+	webApp := web.NewApp(shutdown, cfg.DefaultLang, middleware.Logger(requestLogger), web.Metrics(registry), middleware.Panics(log, registry))
 
 	// migrations
 	commands.MigrateUP(postgresDB)
 	//commands.Migrate(postgresDB)
 
-	r := router.NewRouter(webApp, postgresDB, redisDB, fmt.Sprintf(":%s", cfg.ServerPort), auth, cfg.ServerBaseUrl)
+	// business figures are read when the metrics are scraped
+	registry.MustRegister(stats.NewCollector(user.NewRepository(postgresDB, passwordService), log))
+
+	r := router.NewRouter(webApp, postgresDB, redisDB, auth, cfg.ServerBaseUrl, smsSender, tokenService, cfg.MFA.Issuer, passwordService, oidcService, notifier, log)
+	r.Init()
+
+	// =========================================================================
+	// Start API Service
+
+	api := http.Server{
+		Addr:         cfg.Web.APIHost,
+		Handler:      webApp,
+		ReadTimeout:  cfg.Web.ReadTimeout,
+		WriteTimeout: cfg.Web.WriteTimeout,
+		ErrorLog:     log,
+	}
+
+	// Make a channel to listen for errors coming from the listener. Use a
+	// buffered channel so the goroutine can exit if we don't collect this error.
+	serverErrors := make(chan error, 1)
+
+	// Start the service listening for requests.
+	go func() {
+		log.Printf("main: API listening on %s", api.Addr)
+		serverErrors <- api.ListenAndServe()
+	}()
+
+	// =========================================================================
+	// Shutdown
+
+	// Blocking main and waiting for shutdown.
+	select {
+	case err := <-serverErrors:
+		return errors.Wrap(err, "server error")
+
+	case sig := <-shutdown:
+		log.Printf("main: %v : Start shutdown", sig)
+
+		// Give outstanding requests a deadline for completion.
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
+		defer cancel()
+
+		// Asking listener to shutdown and shed load.
+		if err := api.Shutdown(ctx); err != nil {
+			api.Close()
+			return errors.Wrap(err, "could not stop server gracefully")
+		}
+
+		if err := debugServer.Shutdown(ctx); err != nil {
+			return errors.Wrap(err, "could not stop debug server gracefully")
+		}
+
+		log.Printf("main: %v : Completed shutdown", sig)
+	}
+
+	return nil
+}
+
+// loadAuthKeys reads the keys of the folder. activeKID overrides the active key
+// chosen by the folder.
+func loadAuthKeys(folder auth.KeyFolder, activeKID string) (auth.Keys, string, error) {
+	keys, active, err := folder.Load()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "loading auth keys")
+	}
+
+	if activeKID != "" {
+		active = activeKID
+	}
 
-	return r.Init()
+	return keys, active, nil
 }
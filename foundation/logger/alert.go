@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// These are the drivers that can be chosen with NewAlerter.
+const (
+	AlertNone     = "none"
+	AlertTelegram = "telegram"
+)
+
+// Alerter sends an alert about an entry to people.
+type Alerter interface {
+	Alert(entry Entry) error
+}
+
+// NewAlerter returns the alerter of the driver, nil for AlertNone.
+func NewAlerter(driver, telegramToken string, telegramChatIDs []string) (Alerter, error) {
+	switch driver {
+	case AlertNone, "":
+		return nil, nil
+	case AlertTelegram:
+		if telegramToken == "" || len(telegramChatIDs) == 0 {
+			return nil, errors.New("telegram alerts need a bot token and chat ids")
+		}
+		return NewTelegramAlerter(telegramToken, telegramChatIDs), nil
+	}
+
+	return nil, errors.Errorf("unknown alert driver %q", driver)
+}
+
+// AlertSink passes the entries of server errors to an alerter. Alerts are
+// sent in the background so requests do not wait for them, they are dropped
+// while too many are queued.
+type AlertSink struct {
+	alerter Alerter
+	queue   chan Entry
+}
+
+// NewAlertSink starts sending the alerts. errLog gets the alerts that could
+// not be sent.
+func NewAlertSink(alerter Alerter, errLog *log.Logger) *AlertSink {
+	s := AlertSink{alerter: alerter, queue: make(chan Entry, 100)}
+
+	go func() {
+		for entry := range s.queue {
+			if err := s.alerter.Alert(entry); err != nil {
+				errLog.Printf("logger : sending alert : %v", err)
+			}
+		}
+	}()
+
+	return &s
+}
+
+func (s *AlertSink) Write(entry Entry) error {
+	if entry.Status < http.StatusInternalServerError {
+		return nil
+	}
+
+	select {
+	case s.queue <- entry:
+		return nil
+	default:
+		return errors.New("alert queue is full, alert dropped")
+	}
+}
+
+// TelegramAlerter posts alerts to Telegram chats through a bot.
+type TelegramAlerter struct {
+	token   string
+	chatIDs []string
+	client  *http.Client
+}
+
+func NewTelegramAlerter(token string, chatIDs []string) *TelegramAlerter {
+	return &TelegramAlerter{token: token, chatIDs: chatIDs, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (a *TelegramAlerter) Alert(entry Entry) error {
+	body, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding entry")
+	}
+
+	text := fmt.Sprintf("%d %s %s\n%s", entry.Status, entry.Method, entry.Path, body)
+
+	for _, chatID := range a.chatIDs {
+		message, err := json.Marshal(map[string]interface{}{
+			"chat_id": chatID,
+			"text":    text,
+		})
+		if err != nil {
+			return errors.Wrap(err, "encoding message")
+		}
+
+		response, err := a.client.Post(fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", a.token), "application/json", bytes.NewReader(message))
+		if err != nil {
+			// the error holds the url, that is the token
+			return errors.New("posting telegram message failed")
+		}
+		response.Body.Close()
+
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
+			return errors.Errorf("posting telegram message : status %d", response.StatusCode)
+		}
+	}
+
+	return nil
+}
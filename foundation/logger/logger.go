@@ -0,0 +1,120 @@
+// Package logger writes structured request logs. Every entry is written to
+// every sink of the logger, e.g. stdout, a rotating file and an alert channel.
+package logger
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// Entry is the log of one request.
+type Entry struct {
+	Time         time.Time         `json:"time"`
+	Level        string            `json:"level"`
+	Method       string            `json:"method"`
+	Path         string            `json:"path"`
+	Route        string            `json:"route,omitempty"`
+	Query        map[string]string `json:"query,omitempty"`
+	Status       int               `json:"status"`
+	LatencyMS    float64           `json:"latency_ms"`
+	UserID       int               `json:"user_id,omitempty"`
+	TraceID      string            `json:"trace_id,omitempty"`
+	RequestID    string            `json:"request_id,omitempty"`
+	IP           string            `json:"ip,omitempty"`
+	UserAgent    string            `json:"user_agent,omitempty"`
+	RequestSize  int64             `json:"request_size"`
+	ResponseSize int               `json:"response_size"`
+
+	// Body is the redacted body of requests that failed with a server
+	// error, it is left out otherwise.
+	Body interface{} `json:"body,omitempty"`
+}
+
+// These are the values of Entry.Level.
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Level returns the level of a response status.
+func Level(status int) string {
+	switch {
+	case status >= 500:
+		return LevelError
+	case status >= 400:
+		return LevelWarn
+	}
+
+	return LevelInfo
+}
+
+// Sink is a destination of entries.
+type Sink interface {
+	Write(entry Entry) error
+}
+
+type Logger struct {
+	sinks []Sink
+	log   *log.Logger
+}
+
+// New creates a logger writing to the sinks. Failing sinks are reported to
+// errLog.
+func New(errLog *log.Logger, sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks, log: errLog}
+}
+
+// Write writes the entry to every sink.
+func (l *Logger) Write(entry Entry) {
+	for _, sink := range l.sinks {
+		if err := sink.Write(entry); err != nil {
+			l.log.Printf("logger : writing entry : %v", err)
+		}
+	}
+}
+
+// sensitive are parts of the names of fields that are never logged.
+var sensitive = []string{"password", "token", "secret", "code", "key", "authorization", "otp"}
+
+// Redacted replaces the value of sensitive fields.
+const Redacted = "[REDACTED]"
+
+// Sensitive returns true if the field can hold a password, a token or a
+// secret.
+func Sensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, s := range sensitive {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact returns the value with the sensitive fields of its objects replaced,
+// at any depth. The value is a decoded JSON value.
+func Redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for field, value := range v {
+			if Sensitive(field) {
+				redacted[field] = Redacted
+				continue
+			}
+			redacted[field] = Redact(value)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = Redact(value)
+		}
+		return redacted
+	}
+
+	return value
+}
@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WriterSink writes entries as JSON lines, e.g. to stdout.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "encoding entry")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// FileSink writes entries as JSON lines to a file. The file is rotated when
+// it reaches MaxSize or when the day changes, the rotated files are named
+// after the time of the rotation and only the newest MaxBackups are kept.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	day  string
+}
+
+// NewFileSink opens the file at path, its folder is created when missing.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "creating log folder")
+	}
+
+	s := FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *FileSink) Write(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "encoding entry")
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(line)) > s.maxSize || time.Now().Format("2006-01-02") != s.day {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+
+	return err
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening log file")
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "reading log file")
+	}
+
+	s.file = file
+	s.size = info.Size()
+	s.day = info.ModTime().Format("2006-01-02")
+
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if s.size > 0 {
+		if err := s.file.Close(); err != nil {
+			return errors.Wrap(err, "closing log file")
+		}
+
+		ext := filepath.Ext(s.path)
+		backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(s.path, ext), time.Now().Format("2006-01-02T15-04-05.000"), ext)
+		if err := os.Rename(s.path, backup); err != nil {
+			return errors.Wrap(err, "renaming log file")
+		}
+
+		if err := s.open(); err != nil {
+			return err
+		}
+
+		if err := s.removeBackups(); err != nil {
+			return err
+		}
+	}
+
+	s.day = time.Now().Format("2006-01-02")
+
+	return nil
+}
+
+// removeBackups removes all but the newest maxBackups rotated files. Their
+// names sort by the time of the rotation.
+func (s *FileSink) removeBackups() error {
+	ext := filepath.Ext(s.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(s.path, ext) + "-*" + ext)
+	if err != nil {
+		return errors.Wrap(err, "listing rotated log files")
+	}
+
+	if len(backups) <= s.maxBackups {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-s.maxBackups] {
+		if err = os.Remove(backup); err != nil {
+			return errors.Wrap(err, "removing rotated log file")
+		}
+	}
+
+	return nil
+}
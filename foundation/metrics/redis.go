@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisHook counts the commands of a redis client and measures their
+// latency. The commands of a pipeline are counted one by one, the latency is
+// measured for the whole pipeline.
+type RedisHook struct {
+	commands *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func NewRedisHook(reg prometheus.Registerer) *RedisHook {
+	h := RedisHook{
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "redis_commands_total",
+			Help: "Number of redis commands by command and status.",
+		}, []string{"command", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "redis_command_duration_seconds",
+			Help:    "Latency of redis commands, pipelines are measured as the pipeline command.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"command"}),
+	}
+	reg.MustRegister(h.commands, h.duration)
+
+	return &h
+}
+
+func (h *RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+
+		h.duration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+		h.commands.WithLabelValues(cmd.Name(), redisStatus(err)).Inc()
+
+		return err
+	}
+}
+
+func (h *RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+
+		h.duration.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+		for _, cmd := range cmds {
+			h.commands.WithLabelValues(cmd.Name(), redisStatus(cmd.Err())).Inc()
+		}
+
+		return err
+	}
+}
+
+// redisStatus returns the status label of a command. redis.Nil is a missing
+// key, not a failure.
+func redisStatus(err error) string {
+	if err != nil && err != redis.Nil {
+		return "error"
+	}
+
+	return "ok"
+}
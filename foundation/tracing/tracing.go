@@ -0,0 +1,132 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are started by
+// web.App for requests and by hooks of the database and cache clients, the
+// trace context of callers is taken from the traceparent header.
+package tracing
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the spans of the service.
+const TracerName = "project"
+
+// These are the exporters that can be chosen in Config.
+const (
+	// ExporterNone exports nothing. Spans and trace ids are still created,
+	// so logs and responses carry the trace id.
+	ExporterNone = "none"
+
+	// ExporterOTLP sends spans to an OTLP collector over HTTP.
+	ExporterOTLP = "otlp"
+
+	// ExporterZipkin sends spans to a Zipkin collector.
+	ExporterZipkin = "zipkin"
+
+	// ExporterMemory keeps spans in memory, see Provider.Memory. It works
+	// offline and is meant for tests.
+	ExporterMemory = "memory"
+)
+
+type Config struct {
+	ServiceName string
+	Version     string
+	Exporter    string
+
+	// Endpoint is the host:port of the OTLP collector or the span URL of
+	// the Zipkin collector.
+	Endpoint string
+
+	// Insecure sends OTLP over plain HTTP.
+	Insecure bool
+
+	// Probability is the share of traces that are sampled. The decision of
+	// the caller is kept for traces continued from a traceparent header.
+	Probability float64
+}
+
+type Provider struct {
+	*sdktrace.TracerProvider
+
+	// Memory holds the ended spans when the exporter is ExporterMemory.
+	Memory *tracetest.InMemoryExporter
+}
+
+// New creates the provider of the exporter and installs it, together with the
+// W3C trace context propagator, as the global provider of OpenTelemetry. It
+// must be shut down to flush the spans that were not exported yet.
+func New(cfg Config) (*Provider, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.Version),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating resource")
+	}
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Probability))),
+	}
+
+	var p Provider
+
+	switch strings.ToLower(cfg.Exporter) {
+	case ExporterNone, "":
+	case ExporterOTLP:
+		otlpOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			otlpOptions = append(otlpOptions, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err := otlptracehttp.New(context.Background(), otlpOptions...)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating otlp exporter")
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case ExporterZipkin:
+		exporter, err := zipkin.New(cfg.Endpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating zipkin exporter")
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case ExporterMemory:
+		p.Memory = tracetest.NewInMemoryExporter()
+		options = append(options, sdktrace.WithSyncer(p.Memory))
+	default:
+		return nil, errors.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	p.TracerProvider = sdktrace.NewTracerProvider(options...)
+
+	otel.SetTracerProvider(p.TracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return &p, nil
+}
+
+// Shutdown exports the remaining spans, waiting up to the timeout.
+func (p *Provider) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return p.TracerProvider.Shutdown(ctx)
+}
+
+// Tracer returns the tracer of the service from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
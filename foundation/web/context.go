@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"log"
 	"net/http"
 	"reflect"
@@ -23,17 +26,6 @@ func NewContext(context *gin.Context, ctx context.Context) *Context {
 }
 
 func (c *Context) Respond(data interface{}, statusCode int) error {
-	//if statusCode >= 400 {
-	//	logger := NewLogger("logs")
-	//
-	//	if err := logger.WriteLog(c, data); err != nil {
-	//		log.Println(err)
-	//	}
-	//}
-	// ###############################
-	//ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "foundation.web.respond")
-	//defer span.End()
-
 	// Set the status code for the request logger middleware.
 	// If the context is missing this value, request the service
 	// to be shutdown gracefully.
@@ -43,6 +35,12 @@ func (c *Context) Respond(data interface{}, statusCode int) error {
 	}
 	v.StatusCode = statusCode
 
+	span := trace.SpanFromContext(c.Ctx)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+	if statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+
 	// If there is nothing to marshal then set status code and return.
 	if statusCode == http.StatusNoContent {
 		c.AbortWithStatus(statusCode)
@@ -55,6 +53,7 @@ func (c *Context) Respond(data interface{}, statusCode int) error {
 }
 
 func (c *Context) RespondError(err error) error {
+	trace.SpanFromContext(c.Ctx).RecordError(err)
 
 	// If the error was of the type *Error, the handler has
 	// a specific status code and error to return.
@@ -64,16 +63,28 @@ func (c *Context) RespondError(err error) error {
 			Error:  webErr.Err.Error(),
 			Fields: webErr.Fields,
 		}
+		if webErr.Status >= http.StatusInternalServerError {
+			er.TraceID = c.traceID()
+		}
 		return c.Respond(er, webErr.Status)
 	}
 
 	// If not, the handler sent any arbitrary error value so use 500.
 	er := ErrorResponse{
-		Error: err.Error(),
+		Error:   err.Error(),
+		TraceID: c.traceID(),
 	}
 	return c.Respond(er, http.StatusInternalServerError)
 }
 
+// traceID returns the trace id of the request.
+func (c *Context) traceID() string {
+	if v, ok := c.Ctx.Value(KeyValues).(*Values); ok {
+		return v.TraceID
+	}
+	return ""
+}
+
 func (c *Context) RespondMobileError(err error) error {
 
 	// If the error was of the type *Error, the handler has
@@ -12,6 +12,9 @@ type ErrorResponse struct {
 	Fields []FieldError `json:"fields,omitempty"`
 	Data   interface{}  `json:"data"`
 	Status bool         `json:"status"`
+
+	// TraceID is sent with server errors, so they can be found in the logs.
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 // MobileErrorResponse is the form area for API responses from failures in the API.
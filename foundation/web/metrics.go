@@ -0,0 +1,58 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics counts the requests of the handlers and measures their latency by
+// route template, method and status. The route template keeps the number of
+// series small, /user/:id is one route for every user.
+func Metrics(reg prometheus.Registerer) Middleware {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of handled requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of handled requests by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	reg.MustRegister(requests, duration)
+
+	// This is the actual middleware function to be executed.
+	m := func(handler Handler) Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(c *Context) error {
+			v, ok := c.Ctx.Value(KeyValues).(*Values)
+			if !ok {
+				return NewShutdownError("web value missing from context")
+			}
+
+			err := handler(c)
+
+			// Errors the handler did not respond to get a 500 when the
+			// middlewares return.
+			status := v.StatusCode
+			if err != nil && status == 0 {
+				status = http.StatusInternalServerError
+			}
+
+			labels := []string{c.FullPath(), c.Request.Method, strconv.Itoa(status)}
+			requests.WithLabelValues(labels...).Inc()
+			duration.WithLabelValues(labels...).Observe(time.Since(v.Now).Seconds())
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
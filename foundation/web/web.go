@@ -2,10 +2,18 @@ package web
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"os"
+	"project/foundation/tracing"
 	"syscall"
 	"time"
 )
@@ -19,10 +27,16 @@ const KeyValues ctxKey = 1
 // Values represent state for each request.
 type Values struct {
 	TraceID    string
+	RequestID  string
+	UserID     int
 	Now        time.Time
 	StatusCode int
 }
 
+// RequestIDHeader carries the id of a request. It is taken from the caller
+// when sent, the trace id is used otherwise, and it is sent back.
+const RequestIDHeader = "X-Request-ID"
+
 // A Handler is a type that handles a http request within our own little mini framework.
 type Handler func(c *Context) error
 
@@ -45,7 +59,9 @@ type App struct {
 
 // NewApp creates an App value that handle a set of routes for the application.
 func NewApp(shutdown chan os.Signal, defaultLang string, mw ...Middleware) *App {
-	engine := gin.Default()
+	// Requests are logged by the logging middleware of the application,
+	// panics are recovered by its panics middleware.
+	engine := gin.New()
 
 	// cors
 	engine.Use(cors.New(cors.Config{
@@ -71,10 +87,13 @@ func NewApp(shutdown chan os.Signal, defaultLang string, mw ...Middleware) *App
 }
 
 // SignalShutdown is used to gracefully shutdown the app when an integrity
-// issue is identified.
-
+// issue is identified. It does not block, a shutdown that is already
+// signaled is not signaled again.
 func (a *App) SignalShutdown() {
-	a.shutdown <- syscall.SIGTERM
+	select {
+	case a.shutdown <- syscall.SIGTERM:
+	default:
+	}
 }
 
 // handle performs the real work of applying boilerplate and framework code
@@ -97,28 +116,42 @@ func (a *App) handle(debug bool, method string, path string, handler Handler, mw
 
 	// The function execute for each request.
 	h := func(c *gin.Context) {
+		// Start or expand a distributed trace.
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, method+" "+path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.HTTPRoute(path),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+				semconv.ClientAddress(c.ClientIP()),
+			),
+		)
+		defer span.End()
+
+		traceID := span.SpanContext().TraceID().String()
+		if !span.SpanContext().HasTraceID() {
+			traceID = newTraceID()
+		}
 
-		//defer func() {
-		//	if r := recover(); r != nil {
-		//		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-		//			"error":  fmt.Sprintf("Recovered error: %v", r),
-		//			"status": false,
-		//		})
-		//	}
-		//}()
-
-		// ###########################################
-		//// Start or expand a distributed trace.
-		ctx := c.Request.Context()
-		//ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, r.URL.Path)
-		//defer span.End()
-		// ###########################################
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = traceID
+		}
+		span.SetAttributes(attribute.String("http.request_id", requestID))
+
+		// The caller can continue the trace with the traceparent header of
+		// the response.
+		c.Header(RequestIDHeader, requestID)
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
 
 		// Set the context with required values to
 		// process the request.
 		v := Values{
-			//TraceID: span.SpanContext().TraceID.String(),
-			Now: time.Now(),
+			TraceID:   traceID,
+			RequestID: requestID,
+			Now:       time.Now(),
 		}
 
 		lang := a.DefaultLang
@@ -134,8 +167,15 @@ func (a *App) handle(debug bool, method string, path string, handler Handler, mw
 
 		webContext := NewContext(c, ctx)
 		if err := handler(webContext); err != nil {
-			a.SignalShutdown()
-			return
+			// The error gets a response if the handler did not send one.
+			if !c.Writer.Written() {
+				_ = webContext.RespondError(err)
+			}
+
+			// Only integrity errors stop the service.
+			if IsShutdown(err) {
+				a.SignalShutdown()
+			}
 		}
 	}
 
@@ -172,3 +212,26 @@ func (a *App) Delete(path string, handler Handler, mw ...Middleware) {
 func (a *App) GroupFunc(path string) *App {
 	return a
 }
+
+// newTraceID returns a random trace id for requests that are not traced.
+func newTraceID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID returns true for ids that can be logged and sent back as
+// they are.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
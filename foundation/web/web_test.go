@@ -0,0 +1,127 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"project/foundation/tracing"
+	"project/foundation/web"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	provider, err := tracing.New(tracing.Config{ServiceName: "test", Exporter: tracing.ExporterMemory, Probability: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Shutdown(time.Second)
+
+	app := web.NewApp(make(chan os.Signal, 1), "uz")
+	app.Get("/users/:id", func(c *web.Context) error {
+		return c.Respond(map[string]interface{}{"status": true}, http.StatusOK)
+	})
+
+	const (
+		parentTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID  = "00f067aa0ba902b7"
+	)
+
+	tests := []struct {
+		name        string
+		traceparent string
+		requestID   string
+
+		// keepRequestID is set when the id of the caller is sent back,
+		// the trace id is used otherwise.
+		keepRequestID bool
+	}{
+		{name: "new trace"},
+		{name: "continued trace", traceparent: "00-" + parentTraceID + "-" + parentSpanID + "-01"},
+		{name: "request id of the caller", requestID: "client-42", keepRequestID: true},
+		{name: "request id with spaces", requestID: "client 42"},
+		{name: "request id too long", requestID: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.Memory.Reset()
+
+			r := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+			if tt.traceparent != "" {
+				r.Header.Set("traceparent", tt.traceparent)
+			}
+			if tt.requestID != "" {
+				r.Header.Set(web.RequestIDHeader, tt.requestID)
+			}
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+
+			spans := provider.Memory.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			traceID := span.SpanContext.TraceID().String()
+
+			if span.Name != "GET /users/:id" {
+				t.Errorf("span name %q, want %q", span.Name, "GET /users/:id")
+			}
+
+			wantRequestID := traceID
+			if tt.keepRequestID {
+				wantRequestID = tt.requestID
+			}
+
+			want := map[attribute.Key]string{
+				"http.request.method": http.MethodGet,
+				"http.route":          "/users/:id",
+				"url.path":            "/users/5",
+				"http.request_id":     wantRequestID,
+			}
+			got := attributes(span)
+			for key, value := range want {
+				if got[key] != value {
+					t.Errorf("attribute %s %q, want %q", key, got[key], value)
+				}
+			}
+
+			if id := w.Header().Get(web.RequestIDHeader); id != wantRequestID {
+				t.Errorf("response request id %q, want %q", id, wantRequestID)
+			}
+
+			if tt.traceparent != "" {
+				if traceID != parentTraceID {
+					t.Errorf("trace id %s, want the one of the caller %s", traceID, parentTraceID)
+				}
+				if !span.Parent.IsRemote() || span.Parent.SpanID().String() != parentSpanID {
+					t.Errorf("parent %s, want the remote span %s", span.Parent.SpanID(), parentSpanID)
+				}
+			} else if span.Parent.IsValid() {
+				t.Errorf("span has the parent %s, want a root span", span.Parent.SpanID())
+			}
+
+			traceparent := w.Header().Get("traceparent")
+			if want := "00-" + traceID + "-" + span.SpanContext.SpanID().String() + "-01"; traceparent != want {
+				t.Errorf("response traceparent %q, want %q", traceparent, want)
+			}
+		})
+	}
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]string {
+	m := make(map[attribute.Key]string, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		m[kv.Key] = kv.Value.Emit()
+	}
+
+	return m
+}
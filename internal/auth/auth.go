@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"crypto/rsa"
 	"strings"
 	"sync"
@@ -11,8 +12,9 @@ import (
 
 // These are the expected values for Claims.Roles.
 const (
-	RoleAdmin    = "STUDENT"
+	RoleAdmin    = "ADMIN"
 	RoleEmployee = "EMPLOYEE"
+	RoleStudent  = "STUDENT"
 )
 
 // ctxKey represents the type of value for the context key.
@@ -24,9 +26,19 @@ const Key ctxKey = 1
 // Claims represents the authorization claims transmitted via a JWT.
 type Claims struct {
 	jwt.StandardClaims
-	UserId int    `json:"user_id"`
-	Role   string `json:"roles"`
-	Type   string `json:"type"`
+	UserId      int      `json:"user_id"`
+	Role        string   `json:"roles"`
+	Permissions []string `json:"permissions"`
+	Type        string   `json:"type"`
+	SessionID   string   `json:"sid,omitempty"`
+
+	// APIKeyID is set instead of SessionID for requests authenticated by
+	// an API key. UserId and Role are then the user that created the key and
+	// the role it had, so the key is scoped like its creator.
+	APIKeyID int `json:"api_key_id,omitempty"`
+
+	// ActorID is the admin impersonating the user of UserId.
+	ActorID int `json:"actor_id,omitempty"`
 }
 
 type ClaimsParse struct {
@@ -36,11 +48,22 @@ type ClaimsParse struct {
 	Type   *string `json:"type"`
 }
 
-// Authorized returns true if the claims has at least one of the provided roles.
-func (c Claims) Authorized(role ...string) bool {
+// Authorized returns true if the claims has all of the provided permissions.
+func (c Claims) Authorized(permission ...string) bool {
+	for _, p := range permission {
+		if !c.HasPermission(p) {
+			return false
+		}
+	}
+
+	return true
+}
 
-	for _, r := range role {
-		if strings.Compare(r, c.Role) == 0 {
+// HasPermission returns true if the permission was granted to the claims role
+// at the moment the token was issued.
+func (c Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if strings.Compare(p, permission) == 0 {
 			return true
 		}
 	}
@@ -48,6 +71,48 @@ func (c Claims) Authorized(role ...string) bool {
 	return false
 }
 
+// Actor returns the id of the impersonating admin, nil when the claims are
+// not impersonated. It is stored next to created_by, updated_by and
+// deleted_by.
+func (c Claims) Actor() *int {
+	if c.ActorID == 0 {
+		return nil
+	}
+
+	id := c.ActorID
+	return &id
+}
+
+// roleRanks orders the roles by what they are allowed to do.
+var roleRanks = map[string]int{
+	RoleStudent:  1,
+	RoleEmployee: 2,
+	RoleAdmin:    3,
+}
+
+// CanAssignRole returns true if the claims may give the role to a user or
+// change a user that has it. Admins and holders of PermUserRoleAssign may
+// give every role, everyone else only their own role and the ones below it,
+// and never ADMIN.
+func (c Claims) CanAssignRole(role string) bool {
+	if c.Role == RoleAdmin || c.HasPermission(PermUserRoleAssign) {
+		return true
+	}
+
+	rank, ok := roleRanks[role]
+	return ok && role != RoleAdmin && rank <= roleRanks[c.Role]
+}
+
+// ValidRole returns true if the role is one of the values of the user_role enum.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleEmployee, RoleStudent:
+		return true
+	}
+
+	return false
+}
+
 // Keys represents an in memory storage of keys.
 type Keys map[string]*rsa.PrivateKey
 
@@ -67,6 +132,17 @@ type Keys map[string]*rsa.PrivateKey
 // endpoint. See https://auth0.com/docs/jwks for more details.
 type PublicKeyLookup func(kid string) (*rsa.PublicKey, error)
 
+// ClaimsVerifier checks the claims of a token that was validated against the
+// state kept by the server, e.g. that the session of the token was not ended.
+type ClaimsVerifier func(ctx context.Context, claims Claims) error
+
+// APIKeyValidator returns the claims of an API key, or an error when the key
+// is unknown, revoked or expired.
+type APIKeyValidator func(ctx context.Context, key string) (Claims, error)
+
+// ErrAPIKeysDisabled is returned by ValidateAPIKey when no validator is set.
+var ErrAPIKeysDisabled = errors.New("api keys are not accepted")
+
 // Auth is used to authenticate clients. It can generate a token for a
 // set of area claims and recreate the claims by parsing the token.
 type Auth struct {
@@ -76,15 +152,31 @@ type Auth struct {
 	keyFunc   func(t *jwt.Token) (interface{}, error)
 	parser    *jwt.Parser
 	keys      Keys
+	activeKID string
+	verifiers []ClaimsVerifier
+	apiKeys   APIKeyValidator
+
+	keyVerifiers []ClaimsVerifier
 }
 
-// New creates an *Authenticator for use.
+// New creates an *Authenticator for use. If lookup is nil the public keys of
+// the keys held by the Auth are used, so keys added later are found too.
 func New(algorithm string, lookup PublicKeyLookup, keys Keys) (*Auth, error) {
 	method := jwt.GetSigningMethod(algorithm)
 	if method == nil {
 		return nil, errors.Errorf("unknown algorithm %v", algorithm)
 	}
 
+	a := Auth{
+		algorithm: algorithm,
+		method:    method,
+		keys:      keys,
+	}
+
+	if lookup == nil {
+		lookup = a.publicKey
+	}
+
 	keyFunc := func(t *jwt.Token) (interface{}, error) {
 		kid, ok := t.Header["kid"]
 		if !ok {
@@ -105,12 +197,14 @@ func New(algorithm string, lookup PublicKeyLookup, keys Keys) (*Auth, error) {
 		ValidMethods: []string{algorithm},
 	}
 
-	a := Auth{
-		algorithm: algorithm,
-		method:    method,
-		keyFunc:   keyFunc,
-		parser:    &parser,
-		keys:      keys,
+	a.keyFunc = keyFunc
+	a.parser = &parser
+
+	// A single key is the one used for signing.
+	if len(keys) == 1 {
+		for kid := range keys {
+			a.activeKID = kid
+		}
 	}
 
 	return &a, nil
@@ -130,21 +224,143 @@ func (a *Auth) RemoveKey(kid string) {
 	delete(a.keys, kid)
 }
 
+// SetKeys replaces every key of the store and the kid used for signing.
+func (a *Auth) SetKeys(keys Keys, activeKID string) error {
+	if _, ok := keys[activeKID]; !ok {
+		return errors.Errorf("active key %q is not in the keys", activeKID)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = keys
+	a.activeKID = activeKID
+
+	return nil
+}
+
+// SetActiveKID sets the kid of the key used for signing new tokens.
+func (a *Auth) SetActiveKID(kid string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.keys[kid]; !ok {
+		return errors.Errorf("active key %q is not in the keys", kid)
+	}
+	a.activeKID = kid
+
+	return nil
+}
+
+// ActiveKID returns the kid of the key used for signing new tokens.
+func (a *Auth) ActiveKID() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.activeKID
+}
+
+// PublicKeys returns the public key of every key in the store by kid.
+func (a *Auth) PublicKeys() map[string]*rsa.PublicKey {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	keys := make(map[string]*rsa.PublicKey, len(a.keys))
+	for kid, key := range a.keys {
+		keys[kid] = &key.PublicKey
+	}
+
+	return keys
+}
+
+func (a *Auth) publicKey(kid string) (*rsa.PublicKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	key, ok := a.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("no public key found for the specified kid: %s", kid)
+	}
+
+	return &key.PublicKey, nil
+}
+
+// AddVerifier registers a verifier that is run by VerifyClaims.
+func (a *Auth) AddVerifier(verifier ClaimsVerifier) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.verifiers = append(a.verifiers, verifier)
+}
+
+// VerifyClaims runs every registered verifier and returns the first error.
+func (a *Auth) VerifyClaims(ctx context.Context, claims Claims) error {
+	a.mu.RLock()
+	verifiers := a.verifiers
+	a.mu.RUnlock()
+
+	for _, verify := range verifiers {
+		if err := verify(ctx, claims); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddKeyVerifier registers a verifier that is run by VerifyKeyClaims.
+func (a *Auth) AddKeyVerifier(verifier ClaimsVerifier) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keyVerifiers = append(a.keyVerifiers, verifier)
+}
+
+// VerifyKeyClaims runs every verifier registered for API keys and returns the
+// first error.
+func (a *Auth) VerifyKeyClaims(ctx context.Context, claims Claims) error {
+	a.mu.RLock()
+	verifiers := a.keyVerifiers
+	a.mu.RUnlock()
+
+	for _, verify := range verifiers {
+		if err := verify(ctx, claims); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetAPIKeyValidator sets the validator used by ValidateAPIKey.
+func (a *Auth) SetAPIKeyValidator(validator APIKeyValidator) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.apiKeys = validator
+}
+
+// ValidateAPIKey returns the claims of the API key. The verifiers of
+// VerifyClaims are not run, they check tokens, the claims of keys are checked
+// by VerifyKeyClaims.
+func (a *Auth) ValidateAPIKey(ctx context.Context, key string) (Claims, error) {
+	a.mu.RLock()
+	validate := a.apiKeys
+	a.mu.RUnlock()
+
+	if validate == nil {
+		return Claims{}, ErrAPIKeysDisabled
+	}
+
+	return validate(ctx, key)
+}
+
 // GenerateToken generates a signed JWT token string representing the area Claims.
 func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
 	token := jwt.NewWithClaims(a.method, claims)
 	token.Header["kid"] = kid
 
-	var privateKey *rsa.PrivateKey
 	a.mu.RLock()
-	{
-		var ok bool
-		privateKey, ok = a.keys[kid]
-		if !ok {
-			return "", errors.New("kid lookup failed")
-		}
-	}
+	privateKey, ok := a.keys[kid]
 	a.mu.RUnlock()
+	if !ok {
+		return "", errors.New("kid lookup failed")
+	}
 
 	str, err := token.SignedString(privateKey)
 	if err != nil {
@@ -154,6 +370,20 @@ func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
 	return str, nil
 }
 
+// ValidateExpiredToken is like ValidateToken but accepts a token whose only
+// problem is that it expired.
+func (a *Auth) ValidateExpiredToken(tokenStr string) (Claims, error) {
+	var claims Claims
+	_, err := a.parser.ParseWithClaims(tokenStr, &claims, a.keyFunc)
+	if err != nil {
+		if vErr, ok := err.(*jwt.ValidationError); !ok || vErr.Errors != jwt.ValidationErrorExpired {
+			return Claims{}, errors.Wrap(err, "parsing token")
+		}
+	}
+
+	return claims, nil
+}
+
 // ValidateToken recreates the Claims that were used to generate a token. It
 // verifies that the token was signed using our key.
 func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
@@ -195,28 +425,3 @@ func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
 //	//	}
 //	//}
 //}
-
-//func (a *Auth) CheckClaimsDataFromDatabase(ctx context.Context, claims Claims) error {
-//	a.mu.Lock()
-//	defer a.mu.Unlock()
-//
-//	userDetail := entity.User{}
-//
-//	if err := a.postgresDB.
-//		NewSelect().
-//		Model(userDetail).
-//		Where(
-//			"id = ? AND organization_id = ? AND deleted_at IS NULL",
-//			claims.UserId,
-//			claims.OrganizationID,
-//		).
-//		Scan(ctx); err != nil {
-//		if err == sql.ErrNoRows {
-//			return web.NewRequestError(errors.New("area not found"), http.StatusUnauthorized)
-//		}
-//
-//		return web.NewRequestError(errors.Wrap(err, "area not found"), http.StatusUnauthorized)
-//	}
-//
-//	return nil
-//}
@@ -14,3 +14,27 @@ type AdminSetPasswordRequest struct {
 	SMSCode  string `json:"sms_code" xml:"sms_code" form:"sms_code"`
 	Password string `json:"password" xml:"password" form:"password"`
 }
+
+type IntrospectRequest struct {
+	Token         string `json:"token" xml:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" xml:"token_type_hint" form:"token_type_hint"`
+}
+
+// IntrospectResponse is the introspection response of RFC 7662. Only Active
+// is set for tokens that are not active.
+type IntrospectResponse struct {
+	Active      bool     `json:"active"`
+	Scope       string   `json:"scope,omitempty"`
+	TokenType   string   `json:"token_type,omitempty"`
+	Exp         int64    `json:"exp,omitempty"`
+	Iat         int64    `json:"iat,omitempty"`
+	Sub         string   `json:"sub,omitempty"`
+	Aud         string   `json:"aud,omitempty"`
+	Iss         string   `json:"iss,omitempty"`
+	Jti         string   `json:"jti,omitempty"`
+	UserID      int      `json:"user_id,omitempty"`
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	ActorID     int      `json:"actor_id,omitempty"`
+}
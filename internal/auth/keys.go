@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// KeyFolder is a folder of private keys. Every key is stored in its own
+// <kid>.pem file, so several keys can be published while only the newest one
+// signs new tokens.
+type KeyFolder struct {
+	Path string
+
+	// ActivationDelay is how old a key has to be before it signs tokens. Keys
+	// are published as soon as they are loaded, so every instance that reloads
+	// the folder within the delay already accepts tokens of a new key when the
+	// first instance starts signing with it.
+	ActivationDelay time.Duration
+
+	// Files are keys stored outside of the folder by kid, like the single
+	// private key file used before key folders.
+	Files map[string]string
+}
+
+// Load reads every key of the folder and returns the kid of the active key:
+// the newest key older than ActivationDelay, or the oldest key if none is.
+// The age of a key is the modification time of its file. A missing folder or
+// file is not an error, but at least one key must be found.
+func (f KeyFolder) Load() (Keys, string, error) {
+	paths := make(map[string]string, len(f.Files))
+	for kid, path := range f.Files {
+		paths[kid] = path
+	}
+
+	entries, err := os.ReadDir(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", errors.Wrap(err, "reading key folder")
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+
+		paths[strings.TrimSuffix(entry.Name(), ".pem")] = filepath.Join(f.Path, entry.Name())
+	}
+
+	type keyFile struct {
+		kid     string
+		modTime time.Time
+	}
+
+	keys := make(Keys)
+	files := make([]keyFile, 0, len(paths))
+
+	for kid, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "reading key %s info", kid)
+		}
+
+		privatePEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "reading key %s", kid)
+		}
+
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "parsing key %s", kid)
+		}
+
+		keys[kid] = privateKey
+		files = append(files, keyFile{kid: kid, modTime: info.ModTime()})
+	}
+
+	if len(files) == 0 {
+		return nil, "", errors.Errorf("no keys found in %s", f.Path)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	active := files[0].kid
+	activeBefore := time.Now().Add(-f.ActivationDelay)
+	for _, file := range files {
+		if file.modTime.After(activeBefore) {
+			break
+		}
+		active = file.kid
+	}
+
+	return keys, active, nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+// These are the permissions that can be granted to a role through the
+// role_permissions table. The codes must match the rows of the permissions
+// table created by the migrations.
+//
+// Tokens carry the permissions of the role at the time they were issued. The
+// state of the user is checked on every request, see userstate.Service, so a
+// permission taken from a role stops working within userstate.StateTTL, not
+// only once the tokens expire.
+const (
+	PermUserRead   = "user.read"
+	PermUserCreate = "user.create"
+	PermUserUpdate = "user.update"
+	PermUserDelete = "user.delete"
+
+	// PermUserRoleAssign allows giving users any role, including ADMIN.
+	// Without it only roles below the own one can be given, see
+	// Claims.CanAssignRole.
+	PermUserRoleAssign = "user.role.assign"
+
+	PermRepublicRead   = "republic.read"
+	PermRepublicCreate = "republic.create"
+	PermRepublicUpdate = "republic.update"
+	PermRepublicDelete = "republic.delete"
+
+	PermRegionRead   = "region.read"
+	PermRegionCreate = "region.create"
+	PermRegionUpdate = "region.update"
+	PermRegionDelete = "region.delete"
+
+	PermDistrictRead   = "district.read"
+	PermDistrictCreate = "district.create"
+	PermDistrictUpdate = "district.update"
+	PermDistrictDelete = "district.delete"
+
+	PermDepartmentRead   = "department.read"
+	PermDepartmentCreate = "department.create"
+	PermDepartmentUpdate = "department.update"
+	PermDepartmentDelete = "department.delete"
+
+	PermPositionRead   = "position.read"
+	PermPositionCreate = "position.create"
+	PermPositionUpdate = "position.update"
+	PermPositionDelete = "position.delete"
+
+	PermPermissionManage = "permission.manage"
+
+	PermSessionManage = "session.manage"
+
+	PermMFAManage = "mfa.manage"
+
+	PermStaffManage = "staff.manage"
+
+	PermAPIKeyManage = "api_key.manage"
+
+	PermUserImpersonate = "user.impersonate"
+	PermUserUnlock      = "user.unlock"
+	PermAuditRead       = "audit.read"
+
+	PermSignInRead = "sign_in.read"
+
+	PermUserStatus = "user.status"
+
+	PermTokenIntrospect = "token.introspect"
+)
@@ -7,6 +7,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 )
@@ -65,3 +66,54 @@ func GenKey() error {
 	fmt.Println("private and public key files generated")
 	return nil
 }
+
+// RotateKey creates a new private key in the key folder and returns its kid.
+// The key is published by the running services on their next reload and
+// starts signing tokens once it is older than the activation delay. Older
+// keys keep verifying tokens until they are retired.
+func RotateKey(folder string) (string, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", errors.Wrap(err, "generating private key")
+	}
+
+	if err = os.MkdirAll(folder, 0700); err != nil {
+		return "", errors.Wrap(err, "creating key folder")
+	}
+
+	kid := GenerateID()
+
+	privateFile, err := os.OpenFile(filepath.Join(folder, kid+".pem"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", errors.Wrap(err, "creating private file")
+	}
+	defer privateFile.Close()
+
+	privateBlock := pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}
+
+	if err := pem.Encode(privateFile, &privateBlock); err != nil {
+		return "", errors.Wrap(err, "encoding to private file")
+	}
+
+	fmt.Printf("key %s generated in %s\n", kid, folder)
+	return kid, nil
+}
+
+// RetireKey removes a key from the key folder. Tokens signed with it are
+// rejected once the services reload the folder, so a key should only be
+// retired after the refresh token lifetime passed since it stopped signing.
+func RetireKey(folder, kid string) error {
+	if kid == "" || filepath.Base(kid) != kid {
+		return errors.New("invalid kid")
+	}
+
+	if err := os.Remove(filepath.Join(folder, kid+".pem")); err != nil {
+		return errors.Wrap(err, "removing private file")
+	}
+
+	fmt.Printf("key %s retired from %s\n", kid, folder)
+	return nil
+}
@@ -130,6 +130,398 @@ var scheme = []Scheme{
                                            deleted_by int references users(id)
 				);
 			`,
+	}, {
+		Index:       10,
+		Description: "ALTER TYPE \"user_role\" ADD VALUE ADMIN",
+		Query: `
+				ALTER TYPE "user_role" ADD VALUE IF NOT EXISTS 'ADMIN';
+			`,
+	}, {
+		Index:       11,
+		Description: "Create table: permissions, role_permissions.",
+		Query: `
+				CREATE TABLE IF NOT EXISTS permissions (
+                                           id serial primary key,
+                                           code text not null unique,
+                                           description text
+				);
+				CREATE TABLE IF NOT EXISTS role_permissions (
+                                           role user_role not null,
+                                           permission_id int not null references permissions(id) on delete cascade,
+                                           primary key (role, permission_id)
+				);
+			`,
+	}, {
+		Index:       12,
+		Description: "Insert permissions and grant them to roles, make Admin an ADMIN",
+		Query: `
+				INSERT INTO permissions (code, description) VALUES
+					('user.read', 'View users'),
+					('user.create', 'Create users'),
+					('user.update', 'Update users'),
+					('user.delete', 'Delete users'),
+					('republic.read', 'View republics'),
+					('republic.create', 'Create republics'),
+					('republic.update', 'Update republics'),
+					('republic.delete', 'Delete republics'),
+					('region.read', 'View regions'),
+					('region.create', 'Create regions'),
+					('region.update', 'Update regions'),
+					('region.delete', 'Delete regions'),
+					('district.read', 'View districts'),
+					('district.create', 'Create districts'),
+					('district.update', 'Update districts'),
+					('district.delete', 'Delete districts'),
+					('department.read', 'View departments'),
+					('department.create', 'Create departments'),
+					('department.update', 'Update departments'),
+					('department.delete', 'Delete departments'),
+					('position.read', 'View positions'),
+					('position.create', 'Create positions'),
+					('position.update', 'Update positions'),
+					('position.delete', 'Delete positions'),
+					('permission.manage', 'Grant and revoke permissions of roles')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions
+				ON CONFLICT DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'EMPLOYEE', id FROM permissions
+				WHERE split_part(code, '.', 1) IN ('republic', 'region', 'district', 'department', 'position')
+				ON CONFLICT DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'STUDENT', id FROM permissions
+				WHERE split_part(code, '.', 1) IN ('republic', 'region', 'district', 'department', 'position')
+				  AND split_part(code, '.', 2) = 'read'
+				ON CONFLICT DO NOTHING;
+
+				UPDATE users SET role = 'ADMIN' WHERE username = 'Admin' AND deleted_at IS NULL;
+			`,
+	}, {
+		Index:       13,
+		Description: "Insert permission: session.manage",
+		Query: `
+				INSERT INTO permissions (code, description) VALUES
+					('session.manage', 'View and end sessions of any user')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'session.manage'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       14,
+		Description: "Alter table: users adding column phone",
+		Query: `
+				ALTER TABLE users
+				    ADD COLUMN IF NOT EXISTS phone text;
+				CREATE UNIQUE INDEX IF NOT EXISTS users_phone_key ON users (phone) WHERE deleted_at IS NULL;
+			`,
+	}, {
+		Index:       15,
+		Description: "Create table: user_mfa, user_recovery_codes, mfa_policies. Insert permission: mfa.manage",
+		Query: `
+				CREATE TABLE IF NOT EXISTS user_mfa (
+                                           user_id int primary key references users(id),
+                                           secret text not null,
+                                           enabled boolean not null default false,
+                                           enabled_at timestamp
+				);
+				CREATE TABLE IF NOT EXISTS user_recovery_codes (
+                                           id serial primary key,
+                                           user_id int not null references users(id),
+                                           code_hash text not null,
+                                           used_at timestamp
+				);
+				CREATE INDEX IF NOT EXISTS user_recovery_codes_user_id_idx ON user_recovery_codes (user_id);
+				CREATE TABLE IF NOT EXISTS mfa_policies (
+                                           role user_role primary key,
+                                           required boolean not null default false
+				);
+
+				INSERT INTO permissions (code, description) VALUES
+					('mfa.manage', 'Set two-factor policies and reset two-factor of users')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'mfa.manage'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       16,
+		Description: "Create table: user_departments. Insert permission: staff.manage",
+		Query: `
+				CREATE TABLE IF NOT EXISTS user_departments (
+                                           user_id int not null references users(id),
+                                           department_id int not null references department(id),
+                                           is_head boolean not null default false,
+                                           primary key (user_id, department_id)
+				);
+				CREATE INDEX IF NOT EXISTS user_departments_department_id_idx ON user_departments (department_id);
+
+				INSERT INTO permissions (code, description) VALUES
+					('staff.manage', 'Assign users to departments and appoint department heads')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'staff.manage'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       17,
+		Description: "Create table: api_keys, api_key_permissions. Insert permission: api_key.manage",
+		Query: `
+				CREATE TABLE IF NOT EXISTS api_keys (
+                                           id serial primary key,
+                                           name text not null,
+                                           prefix text not null unique,
+                                           key_hash text not null,
+                                           expires_at timestamp,
+                                           last_used_at timestamp,
+                                           created_at timestamp default now(),
+                                           created_by int references users(id),
+                                           updated_at timestamp,
+                                           updated_by int references users(id),
+                                           deleted_at timestamp,
+                                           deleted_by int references users(id)
+				);
+				CREATE TABLE IF NOT EXISTS api_key_permissions (
+                                           api_key_id int not null references api_keys(id) on delete cascade,
+                                           permission_id int not null references permissions(id) on delete cascade,
+                                           primary key (api_key_id, permission_id)
+				);
+
+				INSERT INTO permissions (code, description) VALUES
+					('api_key.manage', 'Create and revoke API keys of integrations')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'api_key.manage'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       18,
+		Description: "Alter tables adding columns *_by_actor, create table: audit_log. Insert permissions: user.impersonate, audit.read",
+		Query: `
+				ALTER TABLE users
+				    ADD COLUMN IF NOT EXISTS created_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS updated_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS deleted_by_actor int references users(id);
+				ALTER TABLE republic
+				    ADD COLUMN IF NOT EXISTS created_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS updated_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS deleted_by_actor int references users(id);
+				ALTER TABLE region
+				    ADD COLUMN IF NOT EXISTS created_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS updated_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS deleted_by_actor int references users(id);
+				ALTER TABLE district
+				    ADD COLUMN IF NOT EXISTS created_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS updated_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS deleted_by_actor int references users(id);
+				ALTER TABLE position
+				    ADD COLUMN IF NOT EXISTS created_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS updated_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS deleted_by_actor int references users(id);
+				ALTER TABLE department
+				    ADD COLUMN IF NOT EXISTS created_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS updated_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS deleted_by_actor int references users(id);
+				ALTER TABLE api_keys
+				    ADD COLUMN IF NOT EXISTS created_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS updated_by_actor int references users(id),
+				    ADD COLUMN IF NOT EXISTS deleted_by_actor int references users(id);
+
+				CREATE TABLE IF NOT EXISTS audit_log (
+                                           id bigserial primary key,
+                                           actor_id int not null references users(id),
+                                           user_id int not null references users(id),
+                                           operation text not null,
+                                           query text not null,
+                                           created_at timestamp not null default now()
+				);
+				CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
+				CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id);
+
+				INSERT INTO permissions (code, description) VALUES
+					('user.impersonate', 'Sign in as another user'),
+					('audit.read', 'View the audit log')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code IN ('user.impersonate', 'audit.read')
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       19,
+		Description: "Alter table users adding column password_change_required, create table: password_history",
+		Query: `
+				ALTER TABLE users
+				    ADD COLUMN IF NOT EXISTS password_change_required boolean not null default false;
+
+				UPDATE users SET password_change_required = true WHERE username = 'Admin' AND created_by IS NULL;
+
+				CREATE TABLE IF NOT EXISTS password_history (
+                                           id bigserial primary key,
+                                           user_id int not null references users(id),
+                                           password text not null,
+                                           created_at timestamp not null default now()
+				);
+				CREATE INDEX IF NOT EXISTS password_history_user_id_idx ON password_history (user_id, id);
+			`,
+	}, {
+		Index:       20,
+		Description: "Create table: sign_in_history. Insert permission: sign_in.read",
+		Query: `
+				CREATE TABLE IF NOT EXISTS sign_in_history (
+                                           id bigserial primary key,
+                                           user_id int references users(id),
+                                           username text,
+                                           ip text not null,
+                                           ip_range text not null,
+                                           user_agent text,
+                                           event text not null,
+                                           result text not null,
+                                           created_at timestamp not null default now()
+				);
+				CREATE INDEX IF NOT EXISTS sign_in_history_user_id_idx ON sign_in_history (user_id, id);
+				CREATE INDEX IF NOT EXISTS sign_in_history_created_at_idx ON sign_in_history (created_at);
+
+				INSERT INTO permissions (code, description) VALUES
+					('sign_in.read', 'View the sign-in history and report')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'sign_in.read'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       21,
+		Description: "Alter table users adding column oidc_subject",
+		Query: `
+				ALTER TABLE users
+				    ADD COLUMN IF NOT EXISTS oidc_subject text;
+
+				CREATE UNIQUE INDEX IF NOT EXISTS users_oidc_subject_idx ON users (oidc_subject) WHERE deleted_at IS NULL;
+			`,
+	}, {
+		Index:       22,
+		Description: "CREATE TYPE \"user_status\" AS ENUM. Alter table users adding column status. Create table: user_invitations",
+		Query: `
+				DO $$ BEGIN
+				    CREATE TYPE "user_status" AS ENUM ('ACTIVE', 'PENDING');
+				EXCEPTION
+				    WHEN duplicate_object THEN NULL;
+				END $$;
+
+				ALTER TABLE users
+				    ADD COLUMN IF NOT EXISTS status user_status not null default 'ACTIVE';
+
+				CREATE TABLE IF NOT EXISTS user_invitations (
+                                           id bigserial primary key,
+                                           user_id int not null references users(id),
+                                           token_hash text not null unique,
+                                           expires_at timestamp not null,
+                                           used_at timestamp,
+                                           revoked_at timestamp,
+                                           created_at timestamp not null default now(),
+                                           created_by int references users(id)
+				);
+				CREATE INDEX IF NOT EXISTS user_invitations_user_id_idx ON user_invitations (user_id);
+			`,
+	}, {
+		Index:       23,
+		Description: "ALTER TYPE \"user_status\" ADD VALUE BLOCKED, GRADUATED, ON_LEAVE",
+		Query: `
+				ALTER TYPE "user_status" ADD VALUE IF NOT EXISTS 'BLOCKED';
+				ALTER TYPE "user_status" ADD VALUE IF NOT EXISTS 'GRADUATED';
+				ALTER TYPE "user_status" ADD VALUE IF NOT EXISTS 'ON_LEAVE';
+			`,
+	}, {
+		Index:       24,
+		Description: "Alter table users adding columns status_reason, status_until. Insert permission: user.status",
+		Query: `
+				ALTER TABLE users
+				    ADD COLUMN IF NOT EXISTS status_reason text,
+				    ADD COLUMN IF NOT EXISTS status_until date;
+
+				CREATE INDEX IF NOT EXISTS users_status_idx ON users (status) WHERE deleted_at IS NULL;
+
+				INSERT INTO permissions (code, description) VALUES
+				    ('user.status', 'Block, unblock and change the status of users')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'user.status'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       25,
+		Description: "Insert permission: token.introspect",
+		Query: `
+				INSERT INTO permissions (code, description) VALUES
+				    ('token.introspect', 'Introspect access tokens, granted to API keys of other services')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'token.introspect'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       26,
+		Description: "Alter table api_keys adding column created_role",
+		Query: `
+				ALTER TABLE api_keys
+				    ADD COLUMN IF NOT EXISTS created_role user_role;
+
+				UPDATE api_keys AS k SET created_role = u.role
+				FROM users AS u
+				WHERE u.id = k.created_by AND k.created_role IS NULL;
+			`,
+	}, {
+		Index:       27,
+		Description: "Alter table user_mfa adding column last_step",
+		Query: `
+				ALTER TABLE user_mfa
+				    ADD COLUMN IF NOT EXISTS last_step bigint;
+			`,
+	}, {
+		Index:       28,
+		Description: "Alter table audit_log adding columns table_name, record_id, changed_columns and dropping column query",
+		Query: `
+				ALTER TABLE audit_log
+				    ADD COLUMN IF NOT EXISTS table_name text not null default '',
+				    ADD COLUMN IF NOT EXISTS record_id bigint,
+				    ADD COLUMN IF NOT EXISTS changed_columns text[] not null default '{}',
+				    DROP COLUMN IF EXISTS query;
+			`,
+	}, {
+		Index:       29,
+		Description: "Insert permission: user.role.assign",
+		Query: `
+				INSERT INTO permissions (code, description) VALUES
+					('user.role.assign', 'Give users any role, including ADMIN')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'user.role.assign'
+				ON CONFLICT DO NOTHING;
+			`,
+	}, {
+		Index:       30,
+		Description: "Insert permission: user.unlock",
+		Query: `
+				INSERT INTO permissions (code, description) VALUES
+					('user.unlock', 'Remove the sign-in lock of users')
+				ON CONFLICT (code) DO NOTHING;
+
+				INSERT INTO role_permissions (role, permission_id)
+				SELECT 'ADMIN', id FROM permissions WHERE code = 'user.unlock'
+				ON CONFLICT DO NOTHING;
+			`,
 	},
 }
 
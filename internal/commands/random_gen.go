@@ -2,6 +2,7 @@ package commands
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"io"
 )
 
@@ -19,3 +20,13 @@ func EncodeToString(max int) string {
 	}
 	return string(b)
 }
+
+// GenerateID returns a random 128 bit identifier encoded as hex.
+func GenerateID() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,131 @@
+package apikey
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"project/internal/repository/postgres/apikey"
+	"reflect"
+)
+
+type Controller struct {
+	apiKey APIKey
+}
+
+func NewController(apiKey APIKey) *Controller {
+	return &Controller{apiKey}
+}
+
+func (ac Controller) GetList(c *web.Context) error {
+	var filter apikey.Filter
+	if limit, ok := c.GetQueryFunc(reflect.Int, "limit").(*int); ok {
+		filter.Limit = limit
+	}
+	if offset, ok := c.GetQueryFunc(reflect.Int, "offset").(*int); ok {
+		filter.Offset = offset
+	}
+	if page, ok := c.GetQueryFunc(reflect.Int, "page").(*int); ok {
+		filter.Page = page
+	}
+	if search, ok := c.GetQueryFunc(reflect.String, "search").(*string); ok {
+		filter.Search = search
+	}
+
+	if err := c.ValidQuery(); err != nil {
+		return c.RespondError(err)
+	}
+
+	list, count, err := ac.apiKey.GetList(c.Ctx, filter)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   count,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+func (ac Controller) GetDetailById(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	response, err := ac.apiKey.GetDetailById(c.Ctx, id)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   response,
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Create responds with the key, it can not be read again later.
+func (ac Controller) Create(c *web.Context) error {
+	var request apikey.CreateRequest
+
+	if err := c.BindFunc(&request, "Name", "Permissions"); err != nil {
+		return c.RespondError(err)
+	}
+
+	response, err := ac.apiKey.Create(c.Ctx, request)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   response,
+		"status": true,
+	}, http.StatusOK)
+}
+
+func (ac Controller) UpdateColumns(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	var request apikey.UpdateRequest
+
+	if err := c.BindFunc(&request); err != nil {
+		return c.RespondError(err)
+	}
+
+	request.ID = id
+
+	err := ac.apiKey.UpdateColumns(c.Ctx, request)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Delete revokes the key.
+func (ac Controller) Delete(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	err := ac.apiKey.Delete(c.Ctx, id)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
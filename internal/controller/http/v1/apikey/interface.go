@@ -0,0 +1,14 @@
+package apikey
+
+import (
+	"context"
+	"project/internal/repository/postgres/apikey"
+)
+
+type APIKey interface {
+	GetList(ctx context.Context, filter apikey.Filter) ([]apikey.GetListResponse, int, error)
+	GetDetailById(ctx context.Context, id int) (apikey.GetDetailByIdResponse, error)
+	Create(ctx context.Context, request apikey.CreateRequest) (apikey.CreateResponse, error)
+	UpdateColumns(ctx context.Context, request apikey.UpdateRequest) error
+	Delete(ctx context.Context, id int) error
+}
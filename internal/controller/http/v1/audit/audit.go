@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"project/internal/repository/postgres/audit"
+	"reflect"
+)
+
+type Controller struct {
+	audit Audit
+}
+
+func NewController(audit Audit) *Controller {
+	return &Controller{audit}
+}
+
+func (ac Controller) GetList(c *web.Context) error {
+	var filter audit.Filter
+	if limit, ok := c.GetQueryFunc(reflect.Int, "limit").(*int); ok {
+		filter.Limit = limit
+	}
+	if offset, ok := c.GetQueryFunc(reflect.Int, "offset").(*int); ok {
+		filter.Offset = offset
+	}
+	if page, ok := c.GetQueryFunc(reflect.Int, "page").(*int); ok {
+		filter.Page = page
+	}
+	if actorID, ok := c.GetQueryFunc(reflect.Int, "actor_id").(*int); ok {
+		filter.ActorID = actorID
+	}
+	if userID, ok := c.GetQueryFunc(reflect.Int, "user_id").(*int); ok {
+		filter.UserID = userID
+	}
+
+	if err := c.ValidQuery(); err != nil {
+		return c.RespondError(err)
+	}
+
+	list, count, err := ac.audit.GetList(c.Ctx, filter)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   count,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
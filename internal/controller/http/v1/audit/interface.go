@@ -0,0 +1,10 @@
+package audit
+
+import (
+	"context"
+	"project/internal/repository/postgres/audit"
+)
+
+type Audit interface {
+	GetList(ctx context.Context, filter audit.Filter) ([]audit.GetListResponse, int, error)
+}
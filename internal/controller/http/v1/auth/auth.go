@@ -1,23 +1,63 @@
 package auth
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"log"
 	"net/http"
 	"project/foundation/web"
+	"project/internal/auth"
 	"project/internal/commands"
+	"project/internal/entity"
+	"project/internal/repository/postgres"
+	"project/internal/repository/postgres/signin"
 	"project/internal/repository/postgres/user"
+	"project/internal/repository/redis/lockout"
+	oidc_redis "project/internal/repository/redis/oidc"
+	"project/internal/repository/redis/session"
+	"project/internal/service/oidc"
+	"project/internal/service/sms"
+	"project/internal/service/token"
+	"reflect"
+	"time"
 
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidCredentials is the only error of a failed sign-in, it does not
+// tell whether the username exists.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrUserInactive is returned when a blocked, graduated or on leave user
+// signs in or refreshes tokens.
+var ErrUserInactive = errors.New("user is not active")
+
+// ErrOIDCDisabled is returned by the OpenID Connect handlers when no provider
+// is configured.
+var ErrOIDCDisabled = errors.New("sign-in through the identity provider is not enabled")
+
 // Controller represents the controller for authentication operations.
 type Controller struct {
-	user User
+	token       Token
+	user        User
+	permission  Permission
+	session     Session
+	otp         OTP
+	sms         sms.Sender
+	lockout     Lockout
+	mfa         MFA
+	mfaAttempts MFAAttempts
+	history     SignInHistory
+	oidc        OIDC
+	oidcStates  OIDCStates
+	log         *log.Logger
 }
 
-// NewController creates a new authentication controller.
-func NewController(user User) *Controller {
-	return &Controller{user: user}
+// NewController creates a new authentication controller. oidc is nil when
+// signing in through an OpenID Connect provider is disabled. log receives the
+// errors that are not told to the client.
+func NewController(token Token, user User, permission Permission, session Session, otp OTP, sender sms.Sender, lockout Lockout, mfa MFA, mfaAttempts MFAAttempts, history SignInHistory, oidc OIDC, oidcStates OIDCStates, log *log.Logger) *Controller {
+	return &Controller{token: token, user: user, permission: permission, session: session, otp: otp, sms: sender, lockout: lockout, mfa: mfa, mfaAttempts: mfaAttempts, history: history, oidc: oidc, oidcStates: oidcStates, log: log}
 }
 
 // SignIn handles the sign-in operation.
@@ -29,41 +69,475 @@ func (uc Controller) SignIn(c *web.Context) error {
 		return c.RespondError(err)
 	}
 
+	ip := c.ClientIP()
+
+	if err = uc.lockout.Check(c.Ctx, data.Username, ip); err != nil {
+		if isLocked(err) {
+			if err := uc.record(c, signin.EventSignIn, 0, data.Username, signin.ResultLocked); err != nil {
+				return c.RespondError(err)
+			}
+		}
+		return c.RespondError(err)
+	}
+
 	detail, err := uc.user.GetByUsername(c.Ctx, data.Username)
+	if err != nil && !isNotFound(err) {
+		return c.RespondError(err)
+	}
+
+	// Unknown usernames are compared with a dummy hash, so they take as long
+	// as wrong passwords and get the same error.
+	found := err == nil
+
+	if !uc.user.ComparePassword(detail, data.Password) || !found {
+		if err = uc.record(c, signin.EventSignIn, detail.ID, data.Username, signin.ResultFailed); err != nil {
+			return c.RespondError(err)
+		}
+
+		if err = uc.lockout.Fail(c.Ctx, data.Username, ip); err != nil {
+			return c.RespondError(err)
+		}
+
+		return c.RespondError(web.NewRequestError(ErrInvalidCredentials, http.StatusUnauthorized))
+	}
+
+	if err = uc.lockout.Reset(c.Ctx, data.Username); err != nil {
+		return c.RespondError(err)
+	}
+
+	// The status is told only to users who know the password.
+	if err = checkStatus(detail); err != nil {
+		if err := uc.record(c, signin.EventSignIn, detail.ID, data.Username, signin.ResultInactive); err != nil {
+			return c.RespondError(err)
+		}
+		return c.RespondError(err)
+	}
+
+	if err = uc.user.RehashPassword(c.Ctx, detail, data.Password); err != nil {
+		return c.RespondError(err)
+	}
+
+	// Seeded users and users whose password was set by an admin choose a
+	// new one before anything else, SignInPassword continues the sign-in.
+	if detail.PasswordChangeRequired {
+		if err = uc.record(c, signin.EventSignIn, detail.ID, data.Username, signin.ResultPasswordChangeRequired); err != nil {
+			return c.RespondError(err)
+		}
+
+		passwordToken, err := uc.token.IssuePasswordChange(token.Subject{
+			UserID:  detail.ID,
+			Role:    *detail.Role,
+			TokenID: commands.GenerateID(),
+		})
+		if err != nil {
+			return c.RespondError(web.NewRequestError(errors.Wrap(err, "generating password change token"), http.StatusInternalServerError))
+		}
+
+		return c.Respond(map[string]interface{}{
+			"status": true,
+			"data": map[string]interface{}{
+				"password_change_required": true,
+				"password_token":           passwordToken,
+			},
+			"error": nil,
+		}, http.StatusOK)
+	}
+
+	return uc.completeSignIn(c, signin.EventSignIn, detail.ID, data.Username, *detail.Role)
+}
+
+// SignInPassword sets the new password of a user who has to change it and
+// continues the sign-in. It is authorized by the password change token of
+// SignIn, the token can be used only while the change is required.
+func (uc Controller) SignInPassword(c *web.Context) error {
+	var data user.SignInPasswordRequest
+
+	err := c.BindFunc(&data, "PasswordToken", "NewPassword")
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	claims, err := uc.token.ParsePasswordChange(data.PasswordToken)
+	if err != nil {
+		return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+	}
+
+	detail, err := uc.user.GetById(c.Ctx, claims.UserId)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if !detail.PasswordChangeRequired || detail.Role == nil {
+		return c.RespondError(web.NewRequestError(errors.New("invalid password change token"), http.StatusUnauthorized))
+	}
+
+	if err = checkStatus(detail); err != nil {
+		return c.RespondError(err)
+	}
+
+	if uc.user.ComparePassword(detail, data.NewPassword) {
+		return c.RespondError(web.NewRequestError(errors.New("new password must differ from the current one"), http.StatusBadRequest))
+	}
+
+	if err = uc.user.SetPassword(c.Ctx, detail.ID, data.NewPassword); err != nil {
+		return c.RespondError(err)
+	}
+
+	var username string
+	if detail.Username != nil {
+		username = *detail.Username
+	}
+
+	return uc.completeSignIn(c, signin.EventPasswordChange, detail.ID, username, *detail.Role)
+}
+
+// completeSignIn responds to a user whose password is checked with the
+// tokens, or with the mfa pending token when two-factor authentication is
+// enabled or required. The attempt is recorded as the event.
+func (uc Controller) completeSignIn(c *web.Context, event string, userID int, username, role string) error {
+	state, err := uc.mfa.State(c.Ctx, userID, role)
 	if err != nil {
 		return c.RespondError(err)
 	}
 
-	if detail.Password == nil {
-		return c.RespondError(&web.Error{
-			Err:    errors.New("user not found"),
-			Status: http.StatusNotFound,
+	// The tokens are issued by SignInMFA once the second factor is verified.
+	if state.Enabled || state.Required {
+		if err = uc.record(c, event, userID, username, signin.ResultMFARequired); err != nil {
+			return c.RespondError(err)
+		}
+
+		mfaToken, err := uc.token.IssueMFA(token.Subject{
+			UserID:  userID,
+			Role:    role,
+			TokenID: commands.GenerateID(),
 		})
+		if err != nil {
+			return c.RespondError(web.NewRequestError(errors.Wrap(err, "generating mfa token"), http.StatusInternalServerError))
+		}
+
+		return c.Respond(map[string]interface{}{
+			"status": true,
+			"data": map[string]interface{}{
+				"mfa_required": true,
+				"mfa_enrolled": state.Enabled,
+				"mfa_token":    mfaToken,
+			},
+			"error": nil,
+		}, http.StatusOK)
+	}
+
+	pair, err := uc.startSession(c, userID, role)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.record(c, event, userID, username, signin.ResultSuccess); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data":   pair,
+		"error":  nil,
+	}, http.StatusOK)
+}
+
+// SignInMFAEnroll creates the secret of a user whose role requires two-factor
+// authentication but who did not enroll yet. It is authorized by the mfa
+// pending token of SignIn.
+func (uc Controller) SignInMFAEnroll(c *web.Context) error {
+	var data user.SignInMFAEnrollRequest
+
+	err := c.BindFunc(&data, "MFAToken")
+	if err != nil {
+		return c.RespondError(err)
 	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(*detail.Password), []byte(data.Password)); err != nil {
-		return c.RespondError(web.NewRequestError(errors.New("incorrect password"), http.StatusBadRequest))
+	claims, err := uc.token.ParseMFA(data.MFAToken)
+	if err != nil {
+		return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
 	}
 
-	accessToken, refreshToken, err := commands.GenToken(user.AuthClaims{
-		ID:   detail.ID,
-		Role: *detail.Role,
-	}, "./private.pem")
+	detail, err := uc.user.GetById(c.Ctx, claims.UserId)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	account := fmt.Sprint(detail.ID)
+	if detail.Username != nil {
+		account = *detail.Username
+	}
 
+	enrollment, err := uc.mfa.Enroll(c.Ctx, detail.ID, account)
 	if err != nil {
 		return c.RespondError(err)
 	}
 
 	return c.Respond(map[string]interface{}{
 		"status": true,
-		"data": map[string]string{
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
+		"data":   enrollment,
+		"error":  nil,
+	}, http.StatusOK)
+}
+
+// SignInMFA exchanges the mfa pending token of SignIn and a two-factor code,
+// or a recovery code, for the access and refresh tokens. Users that enrolled
+// by SignInMFAEnroll get their recovery codes with the tokens.
+func (uc Controller) SignInMFA(c *web.Context) error {
+	var data user.SignInMFARequest
+
+	err := c.BindFunc(&data, "MFAToken")
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	claims, err := uc.token.ParseMFA(data.MFAToken)
+	if err != nil {
+		return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+	}
+
+	if err = uc.mfaAttempts.Attempt(c.Ctx, claims.Id, uc.token.MFALifetime()); err != nil {
+		return c.RespondError(err)
+	}
+
+	detail, err := uc.user.GetById(c.Ctx, claims.UserId)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	var username string
+	if detail.Username != nil {
+		username = *detail.Username
+	}
+
+	// Failed codes lock the user like failed passwords, new mfa pending
+	// tokens do not give more attempts.
+	ip := c.ClientIP()
+	if err = uc.lockout.Check(c.Ctx, username, ip); err != nil {
+		if isLocked(err) {
+			if err := uc.record(c, signin.EventMFA, claims.UserId, username, signin.ResultLocked); err != nil {
+				return c.RespondError(err)
+			}
+		}
+		return c.RespondError(err)
+	}
+
+	state, err := uc.mfa.State(c.Ctx, claims.UserId, claims.Role)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	var recoveryCodes []string
+	if state.Enabled {
+		err = uc.mfa.Verify(c.Ctx, claims.UserId, data.Code, data.RecoveryCode)
+	} else {
+		recoveryCodes, err = uc.mfa.Confirm(c.Ctx, claims.UserId, data.Code)
+	}
+	if err != nil {
+		if err := uc.record(c, signin.EventMFA, claims.UserId, username, signin.ResultFailed); err != nil {
+			return c.RespondError(err)
+		}
+
+		if isRejected(err) {
+			if err := uc.lockout.Fail(c.Ctx, username, ip); err != nil {
+				return c.RespondError(err)
+			}
+		}
+
+		return c.RespondError(err)
+	}
+
+	if err = uc.lockout.Reset(c.Ctx, username); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.mfaAttempts.Consume(c.Ctx, claims.Id, uc.token.MFALifetime()); err != nil {
+		return c.RespondError(err)
+	}
+
+	pair, err := uc.startSession(c, claims.UserId, claims.Role)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.record(c, signin.EventMFA, claims.UserId, username, signin.ResultSuccess); err != nil {
+		return c.RespondError(err)
+	}
+
+	response := map[string]interface{}{
+		"access_token":  pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+	}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data":   response,
+		"error":  nil,
+	}, http.StatusOK)
+}
+
+// OIDCAuthorize starts signing in through the OpenID Connect provider. It
+// responds with the URL of the provider the user is sent to, the provider
+// sends the user back to the redirect URL with the code and the state for
+// OIDCCallback.
+func (uc Controller) OIDCAuthorize(c *web.Context) error {
+	if uc.oidc == nil {
+		return c.RespondError(web.NewRequestError(ErrOIDCDisabled, http.StatusNotFound))
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		return c.RespondError(web.NewRequestError(err, http.StatusInternalServerError))
+	}
+
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return c.RespondError(web.NewRequestError(err, http.StatusInternalServerError))
+	}
+
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return c.RespondError(web.NewRequestError(err, http.StatusInternalServerError))
+	}
+
+	authURL, err := uc.oidc.AuthCodeURL(c.Ctx, state, nonce, verifier)
+	if err != nil {
+		return c.RespondError(web.NewRequestError(errors.Wrap(err, "building authorization url"), http.StatusBadGateway))
+	}
+
+	if err = uc.oidcStates.Create(c.Ctx, state, oidc_redis.State{Verifier: verifier, Nonce: nonce}); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data": map[string]interface{}{
+			"authorization_url": authURL,
+			"state":             state,
 		},
 		"error": nil,
 	}, http.StatusOK)
 }
 
+// OIDCCallback redeems the code of the provider and responds with the tokens
+// of the user of the identity. The second factor of the provider is not
+// known, so users with two-factor authentication continue with SignInMFA
+// like after a password, see completeSignIn.
+func (uc Controller) OIDCCallback(c *web.Context) error {
+	if uc.oidc == nil {
+		return c.RespondError(web.NewRequestError(ErrOIDCDisabled, http.StatusNotFound))
+	}
+
+	var data user.OIDCCallbackRequest
+
+	err := c.BindFunc(&data, "Code", "State")
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	state, err := uc.oidcStates.Consume(c.Ctx, data.State)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	identity, err := uc.oidc.Exchange(c.Ctx, data.Code, state.Verifier)
+	if err != nil {
+		if err := uc.record(c, signin.EventOIDC, 0, "", signin.ResultFailed); err != nil {
+			return c.RespondError(err)
+		}
+		return c.RespondError(web.NewRequestError(errors.Wrap(err, "exchanging oidc code"), http.StatusUnauthorized))
+	}
+
+	if subtle.ConstantTimeCompare([]byte(identity.Nonce), []byte(state.Nonce)) != 1 {
+		return c.RespondError(web.NewRequestError(errors.New("invalid oidc nonce"), http.StatusUnauthorized))
+	}
+
+	provision, role := uc.oidc.Provision()
+
+	request := user.OIDCRequest{
+		Subject:   identity.Subject,
+		FullName:  identity.Name,
+		Role:      role,
+		Provision: provision,
+	}
+
+	// Unverified emails are not trusted to match or name users.
+	switch {
+	case identity.Email != "" && identity.EmailVerified:
+		request.Email = identity.Email
+		request.Username = identity.Email
+	case identity.PreferredUsername != "":
+		request.Username = identity.PreferredUsername
+	default:
+		request.Username = "oidc:" + identity.Subject
+	}
+
+	detail, err := uc.user.GetByOIDC(c.Ctx, request)
+	if err != nil {
+		if err := uc.record(c, signin.EventOIDC, 0, request.Username, signin.ResultFailed); err != nil {
+			return c.RespondError(err)
+		}
+		return c.RespondError(err)
+	}
+
+	if detail.Role == nil {
+		return c.RespondError(web.NewRequestError(errors.New("user has no role"), http.StatusForbidden))
+	}
+
+	var username string
+	if detail.Username != nil {
+		username = *detail.Username
+	}
+
+	if err = checkStatus(detail); err != nil {
+		if err := uc.record(c, signin.EventOIDC, detail.ID, username, signin.ResultInactive); err != nil {
+			return c.RespondError(err)
+		}
+		return c.RespondError(err)
+	}
+
+	return uc.completeSignIn(c, signin.EventOIDC, detail.ID, username, *detail.Role)
+}
+
+// startSession issues the tokens of a signed in user. Every sign-in starts a
+// new session, that is a new refresh token family.
+func (uc Controller) startSession(c *web.Context, userID int, role string) (token.Pair, error) {
+	permissions, err := uc.permission.GetByRole(c.Ctx, role)
+	if err != nil {
+		return token.Pair{}, err
+	}
+
+	subject := token.Subject{
+		UserID:      userID,
+		Role:        role,
+		Permissions: permissions,
+		SessionID:   commands.GenerateID(),
+		TokenID:     commands.GenerateID(),
+	}
+
+	pair, err := uc.token.Issue(subject)
+	if err != nil {
+		return token.Pair{}, web.NewRequestError(errors.Wrap(err, "generating tokens"), http.StatusInternalServerError)
+	}
+
+	err = uc.session.Create(c.Ctx, session.CreateRequest{
+		Family:    subject.SessionID,
+		TokenID:   subject.TokenID,
+		UserID:    userID,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		TTL:       uc.token.RefreshLifetime(),
+	})
+	if err != nil {
+		return token.Pair{}, err
+	}
+
+	return pair, nil
+}
+
 // Refresh handles the refresh token operation.
 func (uc Controller) Refresh(c *web.Context) error {
 	var data user.RefreshRequest
@@ -74,28 +548,341 @@ func (uc Controller) Refresh(c *web.Context) error {
 	}
 
 	// Parse the incoming tokens
-	_, refreshTokenClaims, err := commands.VerifyTokens(data.AccessToken, data.RefreshToken, "./private.pem")
+	refreshTokenClaims, err := uc.token.ParseRefresh(data.AccessToken, data.RefreshToken)
 	if err != nil {
+		if err := uc.record(c, signin.EventRefresh, 0, "", signin.ResultFailed); err != nil {
+			return c.RespondError(err)
+		}
 		return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
 	}
-	// Generate new tokens
-	userClaims := user.AuthClaims{
-		ID:   refreshTokenClaims.UserId,
-		Role: refreshTokenClaims.Role,
+
+	detail, err := uc.user.GetById(c.Ctx, refreshTokenClaims.UserId)
+	if err != nil {
+		if isNotFound(err) {
+			if err := uc.record(c, signin.EventRefresh, 0, "", signin.ResultFailed); err != nil {
+				return c.RespondError(err)
+			}
+			return c.RespondError(web.NewRequestError(errors.New("user of the token does not exist"), http.StatusUnauthorized))
+		}
+		return c.RespondError(err)
+	}
+
+	if err = checkStatus(detail); err != nil {
+		if err := uc.record(c, signin.EventRefresh, detail.ID, "", signin.ResultInactive); err != nil {
+			return c.RespondError(err)
+		}
+		return c.RespondError(err)
+	}
+
+	if detail.Role == nil {
+		return c.RespondError(web.NewRequestError(errors.New("user has no role"), http.StatusForbidden))
 	}
 
-	accessToken, refreshToken, err := commands.GenToken(userClaims, "./private.pem")
+	// The presented refresh token is consumed, reusing it revokes the family.
+	tokenID := commands.GenerateID()
+	family, err := uc.session.Rotate(c.Ctx, session.RotateRequest{
+		TokenID:    refreshTokenClaims.Id,
+		NewTokenID: tokenID,
+		UserID:     refreshTokenClaims.UserId,
+		TTL:        uc.token.RefreshLifetime(),
+	})
+	if err != nil {
+		if err := uc.record(c, signin.EventRefresh, refreshTokenClaims.UserId, "", signin.ResultFailed); err != nil {
+			return c.RespondError(err)
+		}
+		return c.RespondError(err)
+	}
+
+	// The role and its permissions are loaded again so that changes of them
+	// take effect
+	permissions, err := uc.permission.GetByRole(c.Ctx, *detail.Role)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	// Generate new tokens
+	pair, err := uc.token.Issue(token.Subject{
+		UserID:      refreshTokenClaims.UserId,
+		Role:        *detail.Role,
+		Permissions: permissions,
+		SessionID:   family.Family,
+		TokenID:     tokenID,
+	})
 	if err != nil {
 		return c.RespondError(web.NewRequestError(errors.Wrap(err, "generating new tokens"), http.StatusInternalServerError))
 	}
 
+	if err = uc.record(c, signin.EventRefresh, refreshTokenClaims.UserId, "", signin.ResultSuccess); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data":   pair,
+		"error":  nil,
+	}, http.StatusOK)
+
+}
+
+// SendSMSCode sends a one-time code for resetting the password. The response
+// is the same whether the phone belongs to a user or not, whether a code was
+// sent recently and whether sending failed, failures are only logged.
+func (uc Controller) SendSMSCode(c *web.Context) error {
+	var data auth.AgentSendSMSCodeRequest
+
+	err := c.BindFunc(&data, "Phone")
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	phone := sms.NormalizePhone(data.Phone)
+
+	ok, err := uc.otp.Throttle(c.Ctx, phone)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if ok {
+		if err = uc.sendSMSCode(c, phone); err != nil {
+			return c.RespondError(err)
+		}
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data":   "ok!",
+		"error":  nil,
+	}, http.StatusOK)
+}
+
+// sendSMSCode creates and sends a code when the phone belongs to a user. Only
+// errors of the storage are returned.
+func (uc Controller) sendSMSCode(c *web.Context, phone string) error {
+	_, err := uc.user.GetByPhone(c.Ctx, phone)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	code := commands.EncodeToString(6)
+
+	if err = uc.otp.Create(c.Ctx, phone, code); err != nil {
+		return err
+	}
+
+	if err = uc.sms.Send(c.Ctx, phone, fmt.Sprintf("Password reset code: %s", code)); err != nil {
+		uc.log.Printf("auth : sending password reset code : %v", err)
+	}
+
+	return nil
+}
+
+// CheckSMSCode checks the code without consuming it, so the client can ask
+// for the new password only after a correct code.
+func (uc Controller) CheckSMSCode(c *web.Context) error {
+	var data auth.AgentCheckSMSCodeRequest
+
+	err := c.BindFunc(&data, "Phone", "SMSCode")
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.otp.Check(c.Ctx, sms.NormalizePhone(data.Phone), data.SMSCode); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data":   "ok!",
+		"error":  nil,
+	}, http.StatusOK)
+}
+
+// SetPassword sets the new password and consumes the code. The code is
+// consumed only once the password passed the policy, so a rejected password
+// can be corrected with the same code. Every session of the user is ended.
+func (uc Controller) SetPassword(c *web.Context) error {
+	var data auth.AdminSetPasswordRequest
+
+	err := c.BindFunc(&data, "Phone", "SMSCode", "Password")
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	phone := sms.NormalizePhone(data.Phone)
+
+	if err = uc.otp.Check(c.Ctx, phone, data.SMSCode); err != nil {
+		return c.RespondError(err)
+	}
+
+	detail, err := uc.user.GetByPhone(c.Ctx, phone)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.user.CheckPassword(c.Ctx, detail, data.Password); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.otp.Consume(c.Ctx, phone, data.SMSCode); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.user.SetPassword(c.Ctx, detail.ID, data.Password); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.session.RevokeAll(c.Ctx, detail.ID); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data":   "ok!",
+		"error":  nil,
+	}, http.StatusOK)
+}
+
+// JWKS publishes the public keys that verify our tokens.
+func (uc Controller) JWKS(c *web.Context) error {
+	c.Header("Cache-Control", "public, max-age=300")
+
+	return c.Respond(uc.token.JWKS(), http.StatusOK)
+}
+
+// Unlock removes the sign-in lock of the user.
+func (uc Controller) Unlock(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	detail, err := uc.user.GetDetailById(c.Ctx, id)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if detail.Username == nil {
+		return c.RespondError(web.NewRequestError(errors.New("user has no username"), http.StatusBadRequest))
+	}
+
+	if err = uc.lockout.Unlock(c.Ctx, *detail.Username); err != nil {
+		return c.RespondError(err)
+	}
+
 	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
 		"status": true,
-		"data": map[string]string{
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
+	}, http.StatusOK)
+}
+
+// Impersonate issues a short-lived access token of the user for the admin of
+// the request. Writes made with it record the admin next to the user. Admins
+// can not be impersonated.
+func (uc Controller) Impersonate(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	claims, ok := c.Ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return c.RespondError(web.NewRequestError(errors.New("claims missing from context"), http.StatusUnauthorized))
+	}
+
+	// The token lives in the session of the admin, keys have none.
+	if claims.SessionID == "" || claims.ActorID != 0 {
+		return c.RespondError(web.NewRequestError(errors.New("impersonation requires a signed in admin"), http.StatusForbidden))
+	}
+
+	if id == claims.UserId {
+		return c.RespondError(web.NewRequestError(errors.New("can not impersonate yourself"), http.StatusBadRequest))
+	}
+
+	detail, err := uc.user.GetById(c.Ctx, id)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if detail.Role == nil || *detail.Role == auth.RoleAdmin {
+		return c.RespondError(web.NewRequestError(errors.New("admins can not be impersonated"), http.StatusForbidden))
+	}
+
+	if err = checkStatus(detail); err != nil {
+		return c.RespondError(err)
+	}
+
+	permissions, err := uc.permission.GetByRole(c.Ctx, *detail.Role)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	accessToken, err := uc.token.IssueImpersonation(token.Subject{
+		UserID:      detail.ID,
+		Role:        *detail.Role,
+		Permissions: permissions,
+		SessionID:   claims.SessionID,
+		ActorID:     claims.UserId,
+	})
+	if err != nil {
+		return c.RespondError(web.NewRequestError(errors.Wrap(err, "generating impersonation token"), http.StatusInternalServerError))
+	}
+
+	return c.Respond(map[string]interface{}{
+		"status": true,
+		"data": map[string]interface{}{
+			"access_token": accessToken,
+			"expires_in":   int(uc.token.ImpersonationLifetime().Seconds()),
 		},
 		"error": nil,
 	}, http.StatusOK)
+}
+
+// record stores an attempt in the sign-in history. userID is 0 for unknown
+// users.
+func (uc Controller) record(c *web.Context, event string, userID int, username, result string) error {
+	request := signin.CreateRequest{
+		Username:  username,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Event:     event,
+		Result:    result,
+	}
+	if userID != 0 {
+		request.UserID = &userID
+	}
+
+	return uc.history.Create(c.Ctx, request)
+}
+
+// checkStatus returns ErrUserInactive with status 403 for users that are not
+// active today.
+func checkStatus(detail entity.User) error {
+	status := detail.StatusAt(time.Now())
+	if status == entity.UserStatusActive {
+		return nil
+	}
+
+	return web.NewRequestError(errors.Wrapf(ErrUserInactive, "status %s", status), http.StatusForbidden)
+}
+
+func isNotFound(err error) bool {
+	webErr, ok := err.(*web.Error)
+	return ok && webErr.Err == postgres.ErrNotFound
+}
+
+// isRejected reports whether the error is about the request, e.g. an
+// incorrect code, and not about the service.
+func isRejected(err error) bool {
+	webErr, ok := err.(*web.Error)
+	return ok && webErr.Status < http.StatusInternalServerError
+}
 
+func isLocked(err error) bool {
+	webErr, ok := err.(*web.Error)
+	return ok && webErr.Err == lockout.ErrLocked
 }
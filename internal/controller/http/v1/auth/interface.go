@@ -2,9 +2,91 @@ package auth
 
 import (
 	"context"
+	"project/internal/auth"
 	"project/internal/entity"
+	"project/internal/repository/postgres/signin"
+	"project/internal/repository/postgres/user"
+	oidc_redis "project/internal/repository/redis/oidc"
+	"project/internal/repository/redis/session"
+	"project/internal/service/mfa"
+	"project/internal/service/oidc"
+	"project/internal/service/token"
+	"time"
 )
 
+type Token interface {
+	Issue(subject token.Subject) (token.Pair, error)
+	IssueMFA(subject token.Subject) (string, error)
+	IssueImpersonation(subject token.Subject) (string, error)
+	IssuePasswordChange(subject token.Subject) (string, error)
+	ParseRefresh(accessToken, refreshToken string) (auth.Claims, error)
+	ParseMFA(mfaToken string) (auth.Claims, error)
+	ParsePasswordChange(passwordToken string) (auth.Claims, error)
+	RefreshLifetime() time.Duration
+	MFALifetime() time.Duration
+	ImpersonationLifetime() time.Duration
+	JWKS() auth.JWKS
+}
+
 type User interface {
 	GetByUsername(ctx context.Context, username string) (entity.User, error)
+	GetById(ctx context.Context, id int) (entity.User, error)
+	GetByPhone(ctx context.Context, phone string) (entity.User, error)
+	GetDetailById(ctx context.Context, id int) (user.GetDetailByIdResponse, error)
+	GetByOIDC(ctx context.Context, request user.OIDCRequest) (entity.User, error)
+	SetPassword(ctx context.Context, id int, password string) error
+	CheckPassword(ctx context.Context, detail entity.User, password string) error
+	ComparePassword(detail entity.User, password string) bool
+	RehashPassword(ctx context.Context, detail entity.User, password string) error
+}
+
+type Permission interface {
+	GetByRole(ctx context.Context, role string) ([]string, error)
+}
+
+type Session interface {
+	Create(ctx context.Context, request session.CreateRequest) error
+	Rotate(ctx context.Context, request session.RotateRequest) (session.Token, error)
+	RevokeAll(ctx context.Context, userID int) error
+}
+
+type OTP interface {
+	Throttle(ctx context.Context, phone string) (bool, error)
+	Create(ctx context.Context, phone, code string) error
+	Check(ctx context.Context, phone, code string) error
+	Consume(ctx context.Context, phone, code string) error
+}
+
+type Lockout interface {
+	Check(ctx context.Context, username, ip string) error
+	Fail(ctx context.Context, username, ip string) error
+	Reset(ctx context.Context, username string) error
+	Unlock(ctx context.Context, username string) error
+}
+
+type MFA interface {
+	State(ctx context.Context, userID int, role string) (mfa.State, error)
+	Enroll(ctx context.Context, userID int, account string) (mfa.Enrollment, error)
+	Confirm(ctx context.Context, userID int, code string) ([]string, error)
+	Verify(ctx context.Context, userID int, code, recoveryCode string) error
+}
+
+type MFAAttempts interface {
+	Attempt(ctx context.Context, tokenID string, ttl time.Duration) error
+	Consume(ctx context.Context, tokenID string, ttl time.Duration) error
+}
+
+type SignInHistory interface {
+	Create(ctx context.Context, request signin.CreateRequest) error
+}
+
+type OIDC interface {
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Exchange(ctx context.Context, code, verifier string) (oidc.Identity, error)
+	Provision() (bool, string)
+}
+
+type OIDCStates interface {
+	Create(ctx context.Context, state string, request oidc_redis.State) error
+	Consume(ctx context.Context, state string) (oidc_redis.State, error)
 }
@@ -0,0 +1,469 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/entity"
+	"project/internal/repository/postgres/signin"
+	"project/internal/repository/postgres/user"
+	oidc_redis "project/internal/repository/redis/oidc"
+	"project/internal/repository/redis/session"
+	"project/internal/service/mfa"
+	"project/internal/service/oidc"
+	"project/internal/service/oidc/oidctest"
+	"project/internal/service/token"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+func TestOIDCCallback(t *testing.T) {
+	verified := oidctest.User{Subject: "sub-1", Email: "Ali@Example.com", EmailVerified: true, Name: "Ali"}
+	unverified := oidctest.User{Subject: "sub-1", Email: "ali@example.com", PreferredUsername: "ali.v"}
+
+	blocked := newUser(1, "ali")
+	blocked.Status = "BLOCKED"
+
+	admin := newUser(3, "ali@example.com")
+	role := auth.RoleAdmin
+	admin.Role = &role
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		provision bool
+		users     []entity.User
+		subjects  map[int]string
+		user      oidctest.User
+
+		// prepare changes the provider or the stored state before the
+		// callback.
+		prepare func(p *oidctest.Provider, states *memoryStates, state string)
+
+		// state replaces the state of the callback when set.
+		state string
+
+		status int
+		userID int
+
+		// mfa is set when the callback continues with SignInMFA.
+		mfa bool
+	}{
+		{
+			name:     "linked subject",
+			users:    []entity.User{newUser(1, "ali")},
+			subjects: map[int]string{1: "sub-1"},
+			user:     verified,
+			status:   http.StatusOK,
+			userID:   1,
+		},
+		{
+			name:   "link by verified email",
+			users:  []entity.User{newUser(2, "ali@example.com")},
+			user:   verified,
+			status: http.StatusOK,
+			userID: 2,
+		},
+		{
+			name:   "unverified email is not linked",
+			users:  []entity.User{newUser(2, "ali@example.com")},
+			user:   unverified,
+			status: http.StatusForbidden,
+		},
+		{
+			name:     "email of a user linked to another identity",
+			users:    []entity.User{newUser(2, "ali@example.com")},
+			subjects: map[int]string{2: "sub-2"},
+			user:     verified,
+			status:   http.StatusForbidden,
+		},
+		{
+			name:   "email of an admin is not linked",
+			users:  []entity.User{admin},
+			user:   verified,
+			status: http.StatusForbidden,
+		},
+		{
+			name:     "linked admin continues with the second factor",
+			users:    []entity.User{admin},
+			subjects: map[int]string{3: "sub-1"},
+			user:     verified,
+			status:   http.StatusOK,
+			userID:   3,
+			mfa:      true,
+		},
+		{
+			name:      "provisioning",
+			provision: true,
+			user:      verified,
+			status:    http.StatusOK,
+			userID:    100,
+		},
+		{
+			name:      "provisioning with an unverified email",
+			provision: true,
+			users:     []entity.User{newUser(2, "ali@example.com")},
+			user:      unverified,
+			status:    http.StatusOK,
+			userID:    100,
+		},
+		{
+			name:   "provisioning off",
+			user:   verified,
+			status: http.StatusForbidden,
+		},
+		{
+			name:     "inactive user",
+			users:    []entity.User{blocked},
+			subjects: map[int]string{1: "sub-1"},
+			user:     verified,
+			status:   http.StatusForbidden,
+		},
+		{
+			name:     "state mismatch",
+			users:    []entity.User{newUser(1, "ali")},
+			subjects: map[int]string{1: "sub-1"},
+			user:     verified,
+			state:    "other",
+			status:   http.StatusBadRequest,
+		},
+		{
+			name:     "nonce mismatch",
+			users:    []entity.User{newUser(1, "ali")},
+			subjects: map[int]string{1: "sub-1"},
+			user:     verified,
+			prepare: func(p *oidctest.Provider, states *memoryStates, state string) {
+				states.setNonce(state, "other")
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:     "bad audience",
+			users:    []entity.User{newUser(1, "ali")},
+			subjects: map[int]string{1: "sub-1"},
+			user:     verified,
+			prepare: func(p *oidctest.Provider, states *memoryStates, state string) {
+				p.SetAudience("other-client")
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:     "bad signature",
+			users:    []entity.User{newUser(1, "ali")},
+			subjects: map[int]string{1: "sub-1"},
+			user:     verified,
+			prepare: func(p *oidctest.Provider, states *memoryStates, state string) {
+				p.SetSigningKey(otherKey)
+			},
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := oidctest.New("client", "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer provider.Close()
+
+			cfg := provider.Config("http://localhost/callback")
+			cfg.Provision = tt.provision
+			cfg.ProvisionRole = "STUDENT"
+
+			subjects := make(map[int]string)
+			for id, subject := range tt.subjects {
+				subjects[id] = subject
+			}
+			users := &memoryUsers{users: tt.users, subjects: subjects, nextID: 100}
+			states := &memoryStates{states: make(map[string]oidc_redis.State)}
+			history := &memoryHistory{}
+
+			app := newOIDCApp(oidc.NewService(cfg, nil), users, states, history)
+
+			var authorized struct {
+				Data struct {
+					AuthorizationURL string `json:"authorization_url"`
+					State            string `json:"state"`
+				} `json:"data"`
+			}
+			if status := request(t, app, "/authorize", nil, &authorized); status != http.StatusOK {
+				t.Fatalf("authorize: status %d", status)
+			}
+
+			provider.SetUser(tt.user)
+			code, state, err := provider.Authorize(authorized.Data.AuthorizationURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != authorized.Data.State {
+				t.Fatalf("provider returned state %q, want %q", state, authorized.Data.State)
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(provider, states, state)
+			}
+			if tt.state != "" {
+				state = tt.state
+			}
+
+			var response struct {
+				Data struct {
+					token.Pair
+					MFARequired bool   `json:"mfa_required"`
+					MFAToken    string `json:"mfa_token"`
+				} `json:"data"`
+				Error string `json:"error"`
+			}
+			status := request(t, app, "/callback", user.OIDCCallbackRequest{Code: code, State: state}, &response)
+			if status != tt.status {
+				t.Fatalf("callback: status %d, want %d, error %q", status, tt.status, response.Error)
+			}
+
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			result := signin.ResultSuccess
+			if tt.mfa {
+				result = signin.ResultMFARequired
+				if !response.Data.MFARequired || response.Data.MFAToken != "mfa" || response.Data.AccessToken != "" {
+					t.Errorf("response %+v, want the mfa pending token only", response.Data)
+				}
+			} else if response.Data.AccessToken != "access" {
+				t.Errorf("access token %q, want the issued one", response.Data.AccessToken)
+			}
+
+			last := history.last()
+			if last.Result != result || last.UserID == nil || *last.UserID != tt.userID {
+				t.Errorf("recorded %+v, want %s of user %d", last, result, tt.userID)
+			}
+
+			if linked := users.subject(tt.userID); linked != tt.user.Subject {
+				t.Errorf("user %d linked to %q, want %q", tt.userID, linked, tt.user.Subject)
+			}
+		})
+	}
+}
+
+// newOIDCApp serves the OIDC handlers of a controller with the fakes.
+func newOIDCApp(provider OIDC, users User, states OIDCStates, history SignInHistory) *web.App {
+	gin.SetMode(gin.TestMode)
+
+	controller := NewController(fakeToken{}, users, fakePermission{}, fakeSession{}, nil, nil, nil, fakeMFA{}, nil, history, provider, states, log.New(io.Discard, "", 0))
+
+	app := web.NewApp(make(chan os.Signal, 1), "uz")
+	app.Post("/authorize", controller.OIDCAuthorize)
+	app.Post("/callback", controller.OIDCCallback)
+
+	return app
+}
+
+func request(t *testing.T, app *web.App, path string, body interface{}, response interface{}) int {
+	t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	r.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, r)
+
+	if err = json.Unmarshal(w.Body.Bytes(), response); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body.String(), err)
+	}
+
+	return w.Code
+}
+
+func newUser(id int, username string) entity.User {
+	role := "EMPLOYEE"
+	u := entity.User{Username: &username, Role: &role, Status: entity.UserStatusActive}
+	u.ID = id
+	return u
+}
+
+// memoryUsers keeps the users and the subjects they are linked to in
+// memory. GetByOIDC follows the rules of user.Repository.GetByOIDC: subjects
+// first, then verified emails of unlinked users other than admins, then
+// provisioning.
+type memoryUsers struct {
+	User
+
+	mu       sync.Mutex
+	users    []entity.User
+	subjects map[int]string
+	nextID   int
+}
+
+func (m *memoryUsers) subject(id int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.subjects[id]
+}
+
+func (m *memoryUsers) GetByOIDC(ctx context.Context, request user.OIDCRequest) (entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if m.subjects[u.ID] == request.Subject {
+			return u, nil
+		}
+	}
+
+	if request.Email != "" {
+		for _, u := range m.users {
+			if !strings.EqualFold(*u.Username, request.Email) {
+				continue
+			}
+			if *u.Role == auth.RoleAdmin {
+				return entity.User{}, web.NewRequestError(errors.New("privileged users are not linked by email"), http.StatusForbidden)
+			}
+			if m.subjects[u.ID] != "" {
+				return entity.User{}, web.NewRequestError(errors.New("user is linked to another identity"), http.StatusForbidden)
+			}
+			m.subjects[u.ID] = request.Subject
+			return u, nil
+		}
+	}
+
+	if !request.Provision {
+		return entity.User{}, web.NewRequestError(errors.New("no user for the identity"), http.StatusForbidden)
+	}
+
+	for _, u := range m.users {
+		if strings.EqualFold(*u.Username, request.Username) {
+			return entity.User{}, web.NewRequestError(errors.New("username is used"), http.StatusConflict)
+		}
+	}
+
+	username, role := request.Username, request.Role
+	u := entity.User{Username: &username, Role: &role, Status: entity.UserStatusActive}
+	u.ID = m.nextID
+	m.nextID++
+	m.users = append(m.users, u)
+	m.subjects[u.ID] = request.Subject
+
+	return u, nil
+}
+
+type memoryStates struct {
+	mu     sync.Mutex
+	states map[string]oidc_redis.State
+}
+
+func (m *memoryStates) Create(ctx context.Context, state string, request oidc_redis.State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.states[state] = request
+	return nil
+}
+
+func (m *memoryStates) Consume(ctx context.Context, state string) (oidc_redis.State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.states[state]
+	if !ok {
+		return oidc_redis.State{}, web.NewRequestError(oidc_redis.ErrInvalidState, http.StatusBadRequest)
+	}
+	delete(m.states, state)
+
+	return s, nil
+}
+
+func (m *memoryStates) setNonce(state, nonce string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.states[state]
+	s.Nonce = nonce
+	m.states[state] = s
+}
+
+type memoryHistory struct {
+	mu       sync.Mutex
+	requests []signin.CreateRequest
+}
+
+func (m *memoryHistory) Create(ctx context.Context, request signin.CreateRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests = append(m.requests, request)
+	return nil
+}
+
+func (m *memoryHistory) last() signin.CreateRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.requests) == 0 {
+		return signin.CreateRequest{}
+	}
+	return m.requests[len(m.requests)-1]
+}
+
+type fakeToken struct {
+	Token
+}
+
+func (fakeToken) Issue(subject token.Subject) (token.Pair, error) {
+	return token.Pair{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+func (fakeToken) RefreshLifetime() time.Duration {
+	return time.Hour
+}
+
+func (fakeToken) IssueMFA(subject token.Subject) (string, error) {
+	return "mfa", nil
+}
+
+// fakeMFA requires two-factor authentication of admins.
+type fakeMFA struct {
+	MFA
+}
+
+func (fakeMFA) State(ctx context.Context, userID int, role string) (mfa.State, error) {
+	return mfa.State{Required: role == auth.RoleAdmin}, nil
+}
+
+type fakePermission struct{}
+
+func (fakePermission) GetByRole(ctx context.Context, role string) ([]string, error) {
+	return nil, nil
+}
+
+type fakeSession struct {
+	Session
+}
+
+func (fakeSession) Create(ctx context.Context, request session.CreateRequest) error {
+	return nil
+}
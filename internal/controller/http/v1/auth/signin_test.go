@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/entity"
+	"project/internal/repository/postgres"
+	"project/internal/repository/postgres/signin"
+	"project/internal/repository/postgres/user"
+	"project/internal/repository/redis/session"
+	"project/internal/service/token"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignInStatus(t *testing.T) {
+	past := time.Now().AddDate(0, 0, -2)
+	future := time.Now().AddDate(0, 0, 2)
+
+	tests := []struct {
+		name   string
+		status string
+		until  *time.Time
+
+		// active is set when the user signs in and refreshes.
+		active bool
+	}{
+		{name: "active", status: entity.UserStatusActive, active: true},
+		{name: "blocked", status: entity.UserStatusBlocked},
+		{name: "blocked until a later day", status: entity.UserStatusBlocked, until: &future},
+		{name: "block ended", status: entity.UserStatusBlocked, until: &past, active: true},
+		{name: "on leave", status: entity.UserStatusOnLeave},
+		{name: "graduated", status: entity.UserStatusGraduated},
+		{name: "pending", status: entity.UserStatusPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detail := newUser(1, "ali")
+			detail.Status, detail.StatusUntil = tt.status, tt.until
+
+			history := &memoryHistory{}
+			app := newSignInApp(&passwordUsers{user: detail, password: "secret"}, history)
+
+			want, result := http.StatusForbidden, signin.ResultInactive
+			if tt.active {
+				want, result = http.StatusOK, signin.ResultSuccess
+			}
+
+			var response struct {
+				Data  token.Pair `json:"data"`
+				Error string     `json:"error"`
+			}
+
+			status := request(t, app, "/signin", user.SignInRequest{Username: "ali", Password: "secret"}, &response)
+			if status != want {
+				t.Fatalf("sign-in: status %d, want %d, error %q", status, want, response.Error)
+			}
+			if last := history.last(); last.Result != result || last.Event != signin.EventSignIn {
+				t.Errorf("sign-in recorded %+v, want %s", last, result)
+			}
+
+			status = request(t, app, "/refresh", user.RefreshRequest{AccessToken: "access", RefreshToken: "refresh"}, &response)
+			if status != want {
+				t.Fatalf("refresh: status %d, want %d, error %q", status, want, response.Error)
+			}
+			if last := history.last(); last.Result != result || last.Event != signin.EventRefresh {
+				t.Errorf("refresh recorded %+v, want %s", last, result)
+			}
+		})
+	}
+}
+
+func TestSignInStatusWrongPassword(t *testing.T) {
+	// the status is told only to users who know the password
+	detail := newUser(1, "ali")
+	detail.Status = entity.UserStatusBlocked
+
+	history := &memoryHistory{}
+	app := newSignInApp(&passwordUsers{user: detail, password: "secret"}, history)
+
+	var response struct {
+		Error string `json:"error"`
+	}
+	if status := request(t, app, "/signin", user.SignInRequest{Username: "ali", Password: "wrong"}, &response); status != http.StatusUnauthorized {
+		t.Fatalf("status %d, want %d, error %q", status, http.StatusUnauthorized, response.Error)
+	}
+	if last := history.last(); last.Result != signin.ResultFailed {
+		t.Errorf("recorded %+v, want %s", last, signin.ResultFailed)
+	}
+}
+
+// newSignInApp serves the sign-in and refresh handlers of a controller with
+// the fakes.
+func newSignInApp(users User, history SignInHistory) *web.App {
+	gin.SetMode(gin.TestMode)
+
+	controller := NewController(refreshToken{}, users, fakePermission{}, rotatingSession{}, nil, nil, fakeLockout{}, fakeMFA{}, nil, history, nil, nil, log.New(io.Discard, "", 0))
+
+	app := web.NewApp(make(chan os.Signal, 1), "uz")
+	app.Post("/signin", controller.SignIn)
+	app.Post("/refresh", controller.Refresh)
+
+	return app
+}
+
+// passwordUsers holds one user with its password.
+type passwordUsers struct {
+	User
+
+	user     entity.User
+	password string
+}
+
+func (p *passwordUsers) GetByUsername(ctx context.Context, username string) (entity.User, error) {
+	if *p.user.Username != username {
+		return entity.User{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	return p.user, nil
+}
+
+func (p *passwordUsers) GetById(ctx context.Context, id int) (entity.User, error) {
+	if p.user.ID != id {
+		return entity.User{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	return p.user, nil
+}
+
+func (p *passwordUsers) ComparePassword(detail entity.User, password string) bool {
+	return detail.ID == p.user.ID && password == p.password
+}
+
+func (p *passwordUsers) RehashPassword(ctx context.Context, detail entity.User, password string) error {
+	return nil
+}
+
+// refreshToken accepts every refresh token as the one of user 1.
+type refreshToken struct {
+	fakeToken
+}
+
+func (refreshToken) ParseRefresh(accessToken, refreshToken string) (auth.Claims, error) {
+	return auth.Claims{StandardClaims: jwt.StandardClaims{Id: "refresh"}, UserId: 1, Role: auth.RoleEmployee}, nil
+}
+
+type rotatingSession struct {
+	fakeSession
+}
+
+func (rotatingSession) Rotate(ctx context.Context, request session.RotateRequest) (session.Token, error) {
+	return session.Token{Family: "family", TokenID: request.NewTokenID, UserID: request.UserID}, nil
+}
+
+type fakeLockout struct {
+	Lockout
+}
+
+func (fakeLockout) Check(ctx context.Context, username, ip string) error {
+	return nil
+}
+
+func (fakeLockout) Fail(ctx context.Context, username, ip string) error {
+	return nil
+}
+
+func (fakeLockout) Reset(ctx context.Context, username string) error {
+	return nil
+}
@@ -0,0 +1,11 @@
+package introspect
+
+import (
+	"context"
+	"project/internal/auth"
+)
+
+type Auth interface {
+	ValidateToken(tokenStr string) (auth.Claims, error)
+	VerifyClaims(ctx context.Context, claims auth.Claims) error
+}
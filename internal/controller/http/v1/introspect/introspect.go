@@ -0,0 +1,56 @@
+package introspect
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"strings"
+)
+
+type Controller struct {
+	auth Auth
+}
+
+func NewController(auth Auth) *Controller {
+	return &Controller{auth}
+}
+
+// Introspect tells other services whether an access token of ours is active
+// and whom it belongs to, as described by RFC 7662. A token is active when it
+// is signed by us, not expired and passes the checks of every request, e.g.
+// its session was not ended. The response is not wrapped in data, clients
+// of the RFC expect its fields at the top level.
+func (ic Controller) Introspect(c *web.Context) error {
+	var request auth.IntrospectRequest
+
+	if err := c.BindFunc(&request, "Token"); err != nil {
+		return c.RespondError(err)
+	}
+
+	// Inactive tokens get no details, not even why they are inactive.
+	claims, err := ic.auth.ValidateToken(request.Token)
+	if err != nil {
+		return c.Respond(auth.IntrospectResponse{Active: false}, http.StatusOK)
+	}
+
+	if err = ic.auth.VerifyClaims(c.Ctx, claims); err != nil {
+		return c.Respond(auth.IntrospectResponse{Active: false}, http.StatusOK)
+	}
+
+	return c.Respond(auth.IntrospectResponse{
+		Active:      true,
+		Scope:       strings.Join(claims.Permissions, " "),
+		TokenType:   "Bearer",
+		Exp:         claims.ExpiresAt,
+		Iat:         claims.IssuedAt,
+		Sub:         claims.Subject,
+		Aud:         claims.Audience,
+		Iss:         claims.Issuer,
+		Jti:         claims.Id,
+		UserID:      claims.UserId,
+		Role:        claims.Role,
+		Permissions: claims.Permissions,
+		SessionID:   claims.SessionID,
+		ActorID:     claims.ActorID,
+	}, http.StatusOK)
+}
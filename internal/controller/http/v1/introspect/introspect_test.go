@@ -0,0 +1,153 @@
+package introspect
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"project/foundation/web"
+	"project/internal/auth"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+func TestIntrospect(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := auth.New("RS256", nil, auth.Keys{"kid": key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the checks of every request: sessions that ended and users that are
+	// blocked are not active
+	a.AddVerifier(func(ctx context.Context, claims auth.Claims) error {
+		if claims.SessionID == "ended" {
+			return errors.New("session is revoked")
+		}
+		return nil
+	})
+	a.AddVerifier(func(ctx context.Context, claims auth.Claims) error {
+		if claims.UserId == 3 {
+			return errors.New("user of the token is not active")
+		}
+		return nil
+	})
+
+	other, err := auth.New("RS256", nil, auth.Keys{"kid": otherKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(userID int, sessionID string, expiresAt time.Time) auth.Claims {
+		return auth.Claims{
+			StandardClaims: jwt.StandardClaims{
+				Subject:   "2",
+				Id:        "jti",
+				IssuedAt:  now.Unix(),
+				ExpiresAt: expiresAt.Unix(),
+			},
+			UserId:      userID,
+			Role:        auth.RoleEmployee,
+			Permissions: []string{auth.PermUserRead, auth.PermUserUpdate},
+			SessionID:   sessionID,
+		}
+	}
+	sign := func(a *auth.Auth, claims auth.Claims) string {
+		s, err := a.GenerateToken("kid", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	app := web.NewApp(make(chan os.Signal, 1), "uz")
+	app.Post("/introspect", NewController(a).Introspect)
+
+	tests := []struct {
+		name   string
+		token  string
+		active bool
+	}{
+		{name: "active", token: sign(a, claims(2, "session", now.Add(time.Hour))), active: true},
+		{name: "expired", token: sign(a, claims(2, "session", now.Add(-time.Minute)))},
+		{name: "signed by another key", token: sign(other, claims(2, "session", now.Add(time.Hour)))},
+		{name: "ended session", token: sign(a, claims(2, "ended", now.Add(time.Hour)))},
+		{name: "blocked user", token: sign(a, claims(3, "session", now.Add(time.Hour)))},
+		{name: "not a token", token: "token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(auth.IntrospectRequest{Token: tt.token})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/introspect", bytes.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+
+			// inactive tokens are not an error of the request
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+
+			var fields map[string]interface{}
+			if err = json.Unmarshal(w.Body.Bytes(), &fields); err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.active {
+				// nothing but active is told of inactive tokens
+				if len(fields) != 1 || fields["active"] != false {
+					t.Errorf("response %s, want only active false", w.Body.String())
+				}
+				return
+			}
+
+			var response auth.IntrospectResponse
+			if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+
+			want := auth.IntrospectResponse{
+				Active:      true,
+				Scope:       "user.read user.update",
+				TokenType:   "Bearer",
+				Exp:         now.Add(time.Hour).Unix(),
+				Iat:         now.Unix(),
+				Sub:         "2",
+				Jti:         "jti",
+				UserID:      2,
+				Role:        auth.RoleEmployee,
+				Permissions: []string{auth.PermUserRead, auth.PermUserUpdate},
+				SessionID:   "session",
+			}
+			if !reflect.DeepEqual(response, want) {
+				t.Errorf("response %+v, want %+v", response, want)
+			}
+		})
+	}
+}
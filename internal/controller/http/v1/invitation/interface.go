@@ -0,0 +1,12 @@
+package invitation
+
+import (
+	"context"
+	"project/internal/repository/postgres/user"
+)
+
+type User interface {
+	Invite(ctx context.Context, request user.CreateRequest) (user.CreateResponse, error)
+	CreateInvitation(ctx context.Context, id int) (user.Invitation, error)
+	Activate(ctx context.Context, request user.ActivateRequest) error
+}
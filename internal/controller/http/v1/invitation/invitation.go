@@ -0,0 +1,120 @@
+package invitation
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"project/internal/commands"
+	"project/internal/repository/postgres/user"
+	"project/internal/service/notify"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type Controller struct {
+	user     User
+	notifier notify.Notifier
+}
+
+func NewController(user User, notifier notify.Notifier) *Controller {
+	return &Controller{user, notifier}
+}
+
+// Invite creates a pending user without a password and sends the user an
+// activation token.
+func (ic Controller) Invite(c *web.Context) error {
+	var request user.CreateRequest
+
+	if err := c.BindFunc(&request, "Username", "Role", "FullName"); err != nil {
+		return c.RespondError(err)
+	}
+
+	if request.Avatar != nil {
+		if ok := commands.CheckFileType(c.Ctx, request.Avatar, "image"); !ok {
+			return c.RespondError(web.NewRequestError(errors.New("avatar must be image"), http.StatusBadRequest))
+		}
+		fileUrl, _, _, err := commands.Upload(c.Ctx, request.Avatar, "users/avatar", commands.AvatarSize)
+		if err != nil {
+			return c.RespondError(web.NewRequestError(errors.Wrap(err, "upload avatar"), http.StatusBadRequest))
+		}
+		request.AvatarLink = &fileUrl
+	}
+
+	response, err := ic.user.Invite(c.Ctx, request)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	invitation, err := ic.send(c, response.ID)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"user":       response,
+			"expires_at": invitation.ExpiresAt,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Resend replaces the activation token of a pending user and sends it again.
+func (ic Controller) Resend(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	invitation, err := ic.send(c, id)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"expires_at": invitation.ExpiresAt,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Activate sets the password of an invited user with the activation token.
+func (ic Controller) Activate(c *web.Context) error {
+	var request user.ActivateRequest
+
+	if err := c.BindFunc(&request, "Token", "Password"); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err := ic.user.Activate(c.Ctx, request); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+func (ic Controller) send(c *web.Context, id int) (user.Invitation, error) {
+	invitation, err := ic.user.CreateInvitation(c.Ctx, id)
+	if err != nil {
+		return user.Invitation{}, err
+	}
+
+	// the user is kept when sending fails, the invitation can be resent
+	if err = ic.notifier.Invite(c.Ctx, notify.Invitation{
+		UserID:    invitation.UserID,
+		Username:  invitation.Username,
+		FullName:  invitation.FullName,
+		Phone:     invitation.Phone,
+		Token:     invitation.Token,
+		ExpiresAt: invitation.ExpiresAt,
+	}); err != nil {
+		return user.Invitation{}, web.NewRequestError(errors.Wrap(err, "sending invitation"), http.StatusInternalServerError)
+	}
+
+	return invitation, nil
+}
@@ -0,0 +1,26 @@
+package mfa
+
+import (
+	"context"
+	"project/internal/entity"
+	"project/internal/repository/postgres/mfa"
+	mfa_service "project/internal/service/mfa"
+)
+
+type MFA interface {
+	State(ctx context.Context, userID int, role string) (mfa_service.State, error)
+	Enroll(ctx context.Context, userID int, account string) (mfa_service.Enrollment, error)
+	Confirm(ctx context.Context, userID int, code string) ([]string, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error)
+	Disable(ctx context.Context, userID int, role, code, recoveryCode string) error
+}
+
+type Policy interface {
+	GetPolicies(ctx context.Context) ([]entity.MFAPolicy, error)
+	SetPolicy(ctx context.Context, request mfa.SetPolicyRequest) error
+	Reset(ctx context.Context, userID int) error
+}
+
+type User interface {
+	GetById(ctx context.Context, id int) (entity.User, error)
+}
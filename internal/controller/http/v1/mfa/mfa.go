@@ -0,0 +1,223 @@
+package mfa
+
+import (
+	"fmt"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/repository/postgres/mfa"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type Controller struct {
+	mfa    MFA
+	policy Policy
+	user   User
+}
+
+func NewController(mfa MFA, policy Policy, user User) *Controller {
+	return &Controller{mfa, policy, user}
+}
+
+// GetState returns whether the current user has two-factor authentication
+// and whether the role requires it.
+func (mc Controller) GetState(c *web.Context) error {
+	claims, err := getClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	state, err := mc.mfa.State(c.Ctx, claims.UserId, claims.Role)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"enabled":  state.Enabled,
+			"required": state.Required,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Enroll creates a new secret for the current user and returns it with the
+// provisioning URI to show as a QR code.
+func (mc Controller) Enroll(c *web.Context) error {
+	claims, err := getOwnClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	detail, err := mc.user.GetById(c.Ctx, claims.UserId)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	account := fmt.Sprint(detail.ID)
+	if detail.Username != nil {
+		account = *detail.Username
+	}
+
+	enrollment, err := mc.mfa.Enroll(c.Ctx, detail.ID, account)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   enrollment,
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Confirm enables the enrolled secret and returns the recovery codes.
+func (mc Controller) Confirm(c *web.Context) error {
+	claims, err := getOwnClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	var request mfa.CodeRequest
+
+	if err = c.BindFunc(&request, "Code"); err != nil {
+		return c.RespondError(err)
+	}
+
+	codes, err := mc.mfa.Confirm(c.Ctx, claims.UserId, request.Code)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user.
+func (mc Controller) RegenerateRecoveryCodes(c *web.Context) error {
+	claims, err := getOwnClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	var request mfa.CodeRequest
+
+	if err = c.BindFunc(&request, "Code"); err != nil {
+		return c.RespondError(err)
+	}
+
+	codes, err := mc.mfa.RegenerateRecoveryCodes(c.Ctx, claims.UserId, request.Code)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Disable turns two-factor authentication of the current user off.
+func (mc Controller) Disable(c *web.Context) error {
+	claims, err := getOwnClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	var request mfa.CodeRequest
+
+	if err = c.BindFunc(&request); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = mc.mfa.Disable(c.Ctx, claims.UserId, claims.Role, request.Code, request.RecoveryCode); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+func (mc Controller) GetPolicies(c *web.Context) error {
+	list, err := mc.policy.GetPolicies(c.Ctx)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   len(list),
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+func (mc Controller) SetPolicy(c *web.Context) error {
+	var request mfa.SetPolicyRequest
+
+	if err := c.BindFunc(&request, "Role", "Required"); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err := mc.policy.SetPolicy(c.Ctx, request); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// ResetUser turns two-factor authentication off for a user that lost the
+// device and the recovery codes.
+func (mc Controller) ResetUser(c *web.Context) error {
+	userID := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err := mc.policy.Reset(c.Ctx, userID); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+func getClaims(c *web.Context) (auth.Claims, error) {
+	claims, ok := c.Ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return auth.Claims{}, web.NewRequestError(errors.New("claims missing from context"), http.StatusUnauthorized)
+	}
+
+	return claims, nil
+}
+
+// getOwnClaims returns the claims of a user acting for itself. Two-factor
+// settings can not be changed while impersonating.
+func getOwnClaims(c *web.Context) (auth.Claims, error) {
+	claims, err := getClaims(c)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	if claims.ActorID != 0 {
+		return auth.Claims{}, web.NewRequestError(errors.New("two-factor authentication can not be changed while impersonating"), http.StatusForbidden)
+	}
+
+	return claims, nil
+}
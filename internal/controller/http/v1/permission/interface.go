@@ -0,0 +1,12 @@
+package permission
+
+import (
+	"context"
+	"project/internal/repository/postgres/permission"
+)
+
+type Permission interface {
+	GetList(ctx context.Context) ([]permission.GetListResponse, error)
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
+	SetRolePermissions(ctx context.Context, request permission.SetRolePermissionsRequest) error
+}
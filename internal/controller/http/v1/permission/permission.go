@@ -0,0 +1,75 @@
+package permission
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"project/internal/repository/postgres/permission"
+	"reflect"
+)
+
+type Controller struct {
+	permission Permission
+}
+
+func NewController(permission Permission) *Controller {
+	return &Controller{permission}
+}
+
+func (pc Controller) GetList(c *web.Context) error {
+	list, err := pc.permission.GetList(c.Ctx)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   len(list),
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+func (pc Controller) GetRolePermissions(c *web.Context) error {
+	role := c.GetParam(reflect.String, "role").(string)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	response, err := pc.permission.GetRolePermissions(c.Ctx, role)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   response,
+		"status": true,
+	}, http.StatusOK)
+}
+
+func (pc Controller) SetRolePermissions(c *web.Context) error {
+	role := c.GetParam(reflect.String, "role").(string)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	var request permission.SetRolePermissionsRequest
+
+	if err := c.BindFunc(&request); err != nil {
+		return c.RespondError(err)
+	}
+
+	request.Role = role
+
+	err := pc.permission.SetRolePermissions(c.Ctx, request)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
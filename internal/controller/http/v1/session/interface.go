@@ -0,0 +1,13 @@
+package session
+
+import (
+	"context"
+	"project/internal/repository/redis/session"
+)
+
+type Session interface {
+	GetList(ctx context.Context, userID int) ([]session.GetListResponse, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeForUser(ctx context.Context, userID int, id string) error
+	RevokeAll(ctx context.Context, userID int) error
+}
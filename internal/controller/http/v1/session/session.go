@@ -0,0 +1,165 @@
+package session
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type Controller struct {
+	session Session
+}
+
+func NewController(session Session) *Controller {
+	return &Controller{session}
+}
+
+// Logout ends the session of the token used for the request.
+func (sc Controller) Logout(c *web.Context) error {
+	claims, err := sessionClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = sc.session.Revoke(c.Ctx, claims.SessionID); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// GetList returns the sessions of the current user.
+func (sc Controller) GetList(c *web.Context) error {
+	claims, err := sessionClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	list, err := sc.session.GetList(c.Ctx, claims.UserId)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	for i := range list {
+		list[i].Current = list[i].ID == claims.SessionID
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   len(list),
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// Revoke ends one of the sessions of the current user.
+func (sc Controller) Revoke(c *web.Context) error {
+	id := c.GetParam(reflect.String, "id").(string)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	claims, err := sessionClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = sc.session.RevokeForUser(c.Ctx, claims.UserId, id); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// RevokeAll logs the current user out everywhere.
+func (sc Controller) RevokeAll(c *web.Context) error {
+	claims, err := sessionClaims(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = sc.session.RevokeAll(c.Ctx, claims.UserId); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// GetUserList returns the sessions of any user.
+func (sc Controller) GetUserList(c *web.Context) error {
+	userID := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	list, err := sc.session.GetList(c.Ctx, userID)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   len(list),
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// RevokeUserAll force-logs out any user.
+func (sc Controller) RevokeUserAll(c *web.Context) error {
+	userID := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	if err := sc.session.RevokeAll(c.Ctx, userID); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// sessionClaims returns the claims of a request on the sessions of the
+// current user. Impersonation tokens carry the session of the admin, not one
+// of the user, so they are refused.
+func sessionClaims(c *web.Context) (auth.Claims, error) {
+	claims, err := getClaims(c)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	if claims.ActorID != 0 {
+		return auth.Claims{}, web.NewRequestError(errors.New("sessions are not available while impersonating"), http.StatusForbidden)
+	}
+
+	return claims, nil
+}
+
+func getClaims(c *web.Context) (auth.Claims, error) {
+	claims, ok := c.Ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return auth.Claims{}, web.NewRequestError(errors.New("claims missing from context"), http.StatusUnauthorized)
+	}
+
+	return claims, nil
+}
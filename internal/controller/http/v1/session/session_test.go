@@ -0,0 +1,97 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/repository/redis/session"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestImpersonation(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodPost, path: "/logout"},
+		{method: http.MethodGet, path: "/sessions"},
+		{method: http.MethodDelete, path: "/sessions"},
+		{method: http.MethodDelete, path: "/sessions/admin-session"},
+	}
+
+	for _, tt := range tests {
+		for _, actorID := range []int{0, 1} {
+			t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+				sessions := &recordedSessions{}
+				app := newApp(sessions, auth.Claims{UserId: 2, Role: auth.RoleEmployee, SessionID: "admin-session", ActorID: actorID})
+
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+				// impersonation tokens carry the session of the admin, it
+				// must not be ended or taken for one of the user
+				want := http.StatusOK
+				if actorID != 0 {
+					want = http.StatusForbidden
+				}
+				if w.Code != want {
+					t.Fatalf("actor %d: status %d, want %d: %s", actorID, w.Code, want, w.Body.String())
+				}
+				if actorID != 0 && sessions.calls != 0 {
+					t.Errorf("sessions used %d times while impersonating", sessions.calls)
+				}
+			})
+		}
+	}
+}
+
+// newApp serves the routes of the current user with the claims.
+func newApp(sessions Session, claims auth.Claims) *web.App {
+	gin.SetMode(gin.TestMode)
+
+	authenticated := func(handler web.Handler) web.Handler {
+		return func(c *web.Context) error {
+			c.Ctx = context.WithValue(c.Ctx, auth.Key, claims)
+			return handler(c)
+		}
+	}
+
+	controller := NewController(sessions)
+
+	app := web.NewApp(make(chan os.Signal, 1), "uz")
+	app.Post("/logout", controller.Logout, authenticated)
+	app.Get("/sessions", controller.GetList, authenticated)
+	app.Delete("/sessions", controller.RevokeAll, authenticated)
+	app.Delete("/sessions/:id", controller.Revoke, authenticated)
+
+	return app
+}
+
+type recordedSessions struct {
+	calls int
+}
+
+func (r *recordedSessions) GetList(ctx context.Context, userID int) ([]session.GetListResponse, error) {
+	r.calls++
+	return nil, nil
+}
+
+func (r *recordedSessions) Revoke(ctx context.Context, id string) error {
+	r.calls++
+	return nil
+}
+
+func (r *recordedSessions) RevokeForUser(ctx context.Context, userID int, id string) error {
+	r.calls++
+	return nil
+}
+
+func (r *recordedSessions) RevokeAll(ctx context.Context, userID int) error {
+	r.calls++
+	return nil
+}
@@ -0,0 +1,12 @@
+package signin
+
+import (
+	"context"
+	"project/internal/repository/postgres/signin"
+)
+
+type SignIn interface {
+	GetList(ctx context.Context, filter signin.Filter) ([]signin.GetListResponse, int, error)
+	GetMyList(ctx context.Context, filter signin.Filter) ([]signin.GetListResponse, int, error)
+	GetReport(ctx context.Context, filter signin.ReportFilter) (signin.ReportResponse, error)
+}
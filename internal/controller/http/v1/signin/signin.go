@@ -0,0 +1,108 @@
+package signin
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"project/internal/repository/postgres/signin"
+	"reflect"
+)
+
+type Controller struct {
+	signIn SignIn
+}
+
+func NewController(signIn SignIn) *Controller {
+	return &Controller{signIn}
+}
+
+// GetUserList returns the sign-in history of the user of the id.
+func (sc Controller) GetUserList(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	filter, err := getFilter(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+	filter.UserID = &id
+
+	list, count, err := sc.signIn.GetList(c.Ctx, filter)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   count,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// GetMyList returns the sign-in history of the current user.
+func (sc Controller) GetMyList(c *web.Context) error {
+	filter, err := getFilter(c)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	list, count, err := sc.signIn.GetMyList(c.Ctx, filter)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   count,
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// GetReport returns the suspicious sign-in patterns of the last hours.
+func (sc Controller) GetReport(c *web.Context) error {
+	var filter signin.ReportFilter
+	if hours, ok := c.GetQueryFunc(reflect.Int, "hours").(*int); ok {
+		filter.Hours = hours
+	}
+	if threshold, ok := c.GetQueryFunc(reflect.Int, "threshold").(*int); ok {
+		filter.Threshold = threshold
+	}
+
+	if err := c.ValidQuery(); err != nil {
+		return c.RespondError(err)
+	}
+
+	response, err := sc.signIn.GetReport(c.Ctx, filter)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   response,
+		"status": true,
+	}, http.StatusOK)
+}
+
+func getFilter(c *web.Context) (signin.Filter, error) {
+	var filter signin.Filter
+	if limit, ok := c.GetQueryFunc(reflect.Int, "limit").(*int); ok {
+		filter.Limit = limit
+	}
+	if offset, ok := c.GetQueryFunc(reflect.Int, "offset").(*int); ok {
+		filter.Offset = offset
+	}
+	if page, ok := c.GetQueryFunc(reflect.Int, "page").(*int); ok {
+		filter.Page = page
+	}
+	if result, ok := c.GetQueryFunc(reflect.String, "result").(*string); ok {
+		filter.Result = result
+	}
+
+	return filter, c.ValidQuery()
+}
@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"project/internal/entity"
 	"project/internal/repository/postgres/user"
 )
 
@@ -12,4 +13,25 @@ type User interface {
 	UpdateAll(ctx context.Context, request user.UpdateRequest) error
 	UpdateColumns(ctx context.Context, request user.UpdateRequest) error
 	Delete(ctx context.Context, id int) error
+	GetMe(ctx context.Context) (user.GetDetailByIdResponse, error)
+	GetById(ctx context.Context, id int) (entity.User, error)
+	ComparePassword(detail entity.User, password string) bool
+	UpdateMe(ctx context.Context, request user.UpdateMeRequest) error
+	ChangePassword(ctx context.Context, request user.ChangePasswordRequest) error
+	GetDepartments(ctx context.Context, userID int) ([]user.DepartmentResponse, error)
+	SetDepartments(ctx context.Context, request user.SetDepartmentsRequest) error
+	SetStatus(ctx context.Context, request user.SetStatusRequest) error
+}
+
+type Session interface {
+	RevokeOthers(ctx context.Context, userID int, id string) error
+	RevokeAll(ctx context.Context, userID int) error
+}
+
+type UserState interface {
+	Invalidate(ctx context.Context, userID int) error
+}
+
+type MFA interface {
+	Verify(ctx context.Context, userID int, code, recoveryCode string) error
 }
@@ -3,19 +3,26 @@ package user
 import (
 	"net/http"
 	"project/foundation/web"
+	"project/internal/auth"
 	"project/internal/commands"
+	"project/internal/entity"
 	"project/internal/repository/postgres/user"
+	"project/internal/service/sms"
 	"reflect"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
 type Controller struct {
-	user User
+	user      User
+	session   Session
+	userState UserState
+	mfa       MFA
 }
 
-func NewController(user User) *Controller {
-	return &Controller{user}
+func NewController(user User, session Session, userState UserState, mfa MFA) *Controller {
+	return &Controller{user, session, userState, mfa}
 }
 
 // user
@@ -38,6 +45,9 @@ func (uc Controller) GetList(c *web.Context) error {
 	if role, ok := c.GetQueryFunc(reflect.String, "role").(*string); ok {
 		filter.Role = role
 	}
+	if status, ok := c.GetQueryFunc(reflect.String, "status").(*string); ok {
+		filter.Status = status
+	}
 	if err := c.ValidQuery(); err != nil {
 		return c.RespondError(err)
 	}
@@ -134,6 +144,10 @@ func (uc Controller) UpdateAll(c *web.Context) error {
 		return c.RespondError(err)
 	}
 
+	if err = uc.userState.Invalidate(c.Ctx, id); err != nil {
+		return c.RespondError(err)
+	}
+
 	return c.Respond(map[string]interface{}{
 		"data":   "ok!",
 		"status": true,
@@ -171,6 +185,10 @@ func (uc Controller) UpdateColumns(c *web.Context) error {
 		return c.RespondError(err)
 	}
 
+	if err = uc.userState.Invalidate(c.Ctx, id); err != nil {
+		return c.RespondError(err)
+	}
+
 	return c.Respond(map[string]interface{}{
 		"data":   "ok!",
 		"status": true,
@@ -189,6 +207,213 @@ func (uc Controller) Delete(c *web.Context) error {
 		return c.RespondError(err)
 	}
 
+	if err = uc.userState.Invalidate(c.Ctx, id); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// SetStatus blocks, unblocks or changes the status of the user. Users that
+// are not active are signed out of every session.
+func (uc Controller) SetStatus(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	var request user.SetStatusRequest
+
+	if err := c.BindFunc(&request, "Status"); err != nil {
+		return c.RespondError(err)
+	}
+
+	request.ID = id
+
+	err := uc.user.SetStatus(c.Ctx, request)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.userState.Invalidate(c.Ctx, id); err != nil {
+		return c.RespondError(err)
+	}
+
+	if !strings.EqualFold(*request.Status, entity.UserStatusActive) {
+		if err = uc.session.RevokeAll(c.Ctx, id); err != nil {
+			return c.RespondError(err)
+		}
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// GetDepartments returns the departments the user is assigned to.
+func (uc Controller) GetDepartments(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	list, err := uc.user.GetDepartments(c.Ctx, id)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data": map[string]interface{}{
+			"results": list,
+			"count":   len(list),
+		},
+		"status": true,
+	}, http.StatusOK)
+}
+
+// SetDepartments replaces the departments the user is assigned to.
+func (uc Controller) SetDepartments(c *web.Context) error {
+	id := c.GetParam(reflect.Int, "id").(int)
+
+	if err := c.ValidParam(); err != nil {
+		return c.RespondError(err)
+	}
+
+	var request user.SetDepartmentsRequest
+
+	if err := c.BindFunc(&request); err != nil {
+		return c.RespondError(err)
+	}
+
+	request.UserID = id
+
+	if err := uc.user.SetDepartments(c.Ctx, request); err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// me
+
+// GetMe returns the profile of the current user.
+func (uc Controller) GetMe(c *web.Context) error {
+	response, err := uc.user.GetMe(c.Ctx)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   response,
+		"status": true,
+	}, http.StatusOK)
+}
+
+// UpdateMe updates the full name, phone and avatar of the current user. The
+// password reset codes are sent to the phone, so a new phone needs the current
+// password or a two-factor code.
+func (uc Controller) UpdateMe(c *web.Context) error {
+	var request user.UpdateMeRequest
+
+	if err := c.BindFunc(&request); err != nil {
+		return c.RespondError(err)
+	}
+
+	if request.Phone != nil {
+		if err := uc.checkPhoneChange(c, request); err != nil {
+			return c.RespondError(err)
+		}
+	}
+
+	if request.Avatar != nil {
+		if ok := commands.CheckFileType(c.Ctx, request.Avatar, "image"); !ok {
+			return c.RespondError(web.NewRequestError(errors.New("avatar must be image"), http.StatusBadRequest))
+		}
+		fileUrl, _, _, err := commands.Upload(c.Ctx, request.Avatar, "users/avatar", commands.AvatarSize)
+		if err != nil {
+			return c.RespondError(web.NewRequestError(errors.Wrap(err, "upload avatar"), http.StatusBadRequest))
+		}
+		request.AvatarLink = &fileUrl
+	}
+
+	err := uc.user.UpdateMe(c.Ctx, request)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	return c.Respond(map[string]interface{}{
+		"data":   "ok!",
+		"status": true,
+	}, http.StatusOK)
+}
+
+// checkPhoneChange checks the current password or the two-factor code of the
+// request when the phone of the current user changes.
+func (uc Controller) checkPhoneChange(c *web.Context, request user.UpdateMeRequest) error {
+	claims, ok := c.Ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewRequestError(errors.New("claims missing from context"), http.StatusUnauthorized)
+	}
+
+	detail, err := uc.user.GetById(c.Ctx, claims.UserId)
+	if err != nil {
+		return err
+	}
+
+	if detail.Phone != nil && *detail.Phone == sms.NormalizePhone(*request.Phone) {
+		return nil
+	}
+
+	switch {
+	case request.MFACode != nil && *request.MFACode != "":
+		return uc.mfa.Verify(c.Ctx, claims.UserId, *request.MFACode, "")
+	case request.CurrentPassword != nil:
+		if !uc.user.ComparePassword(detail, *request.CurrentPassword) {
+			return web.NewRequestError(errors.New("incorrect current password"), http.StatusBadRequest)
+		}
+		return nil
+	}
+
+	return web.NewRequestError(errors.New("current password or two-factor code is required to change the phone"), http.StatusForbidden)
+}
+
+// ChangePassword changes the password of the current user. Every other
+// session of the user is ended, so it is refused while impersonating, the
+// token carries the session of the admin.
+func (uc Controller) ChangePassword(c *web.Context) error {
+	var request user.ChangePasswordRequest
+
+	if err := c.BindFunc(&request, "CurrentPassword", "NewPassword"); err != nil {
+		return c.RespondError(err)
+	}
+
+	claims, ok := c.Ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return c.RespondError(web.NewRequestError(errors.New("claims missing from context"), http.StatusUnauthorized))
+	}
+
+	if claims.ActorID != 0 {
+		return c.RespondError(web.NewRequestError(errors.New("password can not be changed while impersonating"), http.StatusForbidden))
+	}
+
+	err := uc.user.ChangePassword(c.Ctx, request)
+	if err != nil {
+		return c.RespondError(err)
+	}
+
+	if err = uc.session.RevokeOthers(c.Ctx, claims.UserId, claims.SessionID); err != nil {
+		return c.RespondError(err)
+	}
+
 	return c.Respond(map[string]interface{}{
 		"data":   "ok!",
 		"status": true,
@@ -0,0 +1,123 @@
+// Package debug serves the endpoints for operators: profiles, expvar values,
+// runtime statistics of the stores and the probes of the orchestrator. It is
+// served on its own host, away from the API.
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"project/foundation/metrics"
+	"project/internal/pkg/repository/postgresql"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config holds what the endpoints report on.
+type Config struct {
+	Build string
+	Log   *log.Logger
+	DB    *postgresql.Database
+	Redis *redis.Client
+
+	// Metrics are served in the Prometheus text format at /metrics.
+	Metrics *prometheus.Registry
+}
+
+// StandardLibraryMux registers the pprof and expvar endpoints on a new mux.
+// The default mux is not used, so packages can not add endpoints to the debug
+// server by importing them.
+func StandardLibraryMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return mux
+}
+
+// Mux returns the mux of the debug server. Besides the endpoints of
+// StandardLibraryMux it publishes the goroutine count and the pool statistics
+// of the stores under /debug/vars and serves the probes.
+func Mux(cfg Config) *http.ServeMux {
+	mux := StandardLibraryMux()
+
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("database", expvar.Func(func() interface{} {
+		return cfg.DB.Stats()
+	}))
+	expvar.Publish("cache", expvar.Func(func() interface{} {
+		return cfg.Redis.PoolStats()
+	}))
+
+	mux.Handle("/metrics", metrics.Handler(cfg.Metrics))
+
+	c := checks{cfg: cfg}
+	mux.HandleFunc("/debug/liveness", c.liveness)
+	mux.HandleFunc("/debug/readiness", c.readiness)
+
+	return mux
+}
+
+type checks struct {
+	cfg Config
+}
+
+// liveness returns 200 while the service runs. It does not check the stores,
+// the service is not restarted when they are down.
+func (c checks) liveness(w http.ResponseWriter, r *http.Request) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unavailable"
+	}
+
+	c.respond(w, http.StatusOK, map[string]interface{}{
+		"status":     "up",
+		"build":      c.cfg.Build,
+		"host":       host,
+		"goroutines": runtime.NumGoroutine(),
+	})
+}
+
+// readiness returns 200 when the database and the cache answer, 503
+// otherwise, so no requests are routed to the service.
+func (c checks) readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	status, code := map[string]string{"database": "ok", "cache": "ok"}, http.StatusOK
+
+	if err := c.cfg.DB.PingContext(ctx); err != nil {
+		c.cfg.Log.Printf("debug : readiness : database : %v", err)
+		status["database"], code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	if err := c.cfg.Redis.Ping(ctx).Err(); err != nil {
+		c.cfg.Log.Printf("debug : readiness : cache : %v", err)
+		status["cache"], code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	c.respond(w, code, status)
+}
+
+func (c checks) respond(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		c.cfg.Log.Printf("debug : responding : %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type UserMFA struct {
+	bun.BaseModel `bun:"table:user_mfa"`
+
+	UserID    int        `json:"user_id"    bun:"user_id,pk"`
+	Secret    string     `json:"-"          bun:"secret"`
+	Enabled   bool       `json:"enabled"    bun:"enabled"`
+	EnabledAt *time.Time `json:"enabled_at" bun:"enabled_at"`
+}
+
+type MFAPolicy struct {
+	bun.BaseModel `bun:"table:mfa_policies"`
+
+	Role     string `json:"role"     bun:"role,pk"`
+	Required bool   `json:"required" bun:"required"`
+}
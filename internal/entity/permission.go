@@ -0,0 +1,13 @@
+package entity
+
+import (
+	"github.com/uptrace/bun"
+)
+
+type Permission struct {
+	bun.BaseModel `bun:"table:permissions"`
+
+	ID          int     `json:"id"          bun:"id"`
+	Code        string  `json:"code"        bun:"code"`
+	Description *string `json:"description" bun:"description"`
+}
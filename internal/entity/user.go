@@ -6,15 +6,40 @@ import (
 	"github.com/uptrace/bun"
 )
 
+// These are the values of User.Status. Only active users can sign in.
+const (
+	UserStatusActive    = "ACTIVE"
+	UserStatusPending   = "PENDING"
+	UserStatusBlocked   = "BLOCKED"
+	UserStatusGraduated = "GRADUATED"
+	UserStatusOnLeave   = "ON_LEAVE"
+)
+
 type User struct {
 	bun.BaseModel `bun:"table:users"`
 
 	BasicEntity
 	Avatar        *string    `json:"avatar"     bun:"avatar"`
 	Username      *string    `json:"username"   bun:"username"`
+	Phone         *string    `json:"phone"      bun:"phone"`
 	Password      *string    `json:"password"   bun:"password"`
 	FullName      *string    `json:"full_name"  bun:"full_name"`
 	Role          *string    `json:"role"       bun:"role"`
 	BirthDistrict *int       `json:"birth_district_id" bun:"birth_district_id"`
 	BirthDate     *time.Time `json:"birth_date" bun:"birth_date"`
+
+	PasswordChangeRequired bool       `json:"password_change_required" bun:"password_change_required"`
+	Status                 string     `json:"status" bun:"status"`
+	StatusReason           *string    `json:"status_reason" bun:"status_reason"`
+	StatusUntil            *time.Time `json:"status_until" bun:"status_until"`
+}
+
+// StatusAt returns the status of the user at the time. A status with an end
+// date is over after its last day, the user is active again then.
+func (u User) StatusAt(t time.Time) string {
+	if u.StatusUntil != nil && u.Status != UserStatusPending && !t.Before(u.StatusUntil.AddDate(0, 0, 1)) {
+		return UserStatusActive
+	}
+
+	return u.Status
 }
@@ -9,38 +9,79 @@ import (
 	"strings"
 )
 
-func Authenticate(a *auth.Auth, role ...string) web.Middleware {
+// Authenticate validates the bearer token or the API key of the request and
+// checks that its claims hold every one of the provided permissions.
+func Authenticate(a *auth.Auth, permission ...string) web.Middleware {
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
 
 		// Create the handler that will be attached in the middleware chain.
 		h := func(c *web.Context) error {
 
-			// Expecting: Bearer <token>
-			authStr := c.Request.Header.Get("authorization")
+			var (
+				claims auth.Claims
+				err    error
+			)
 
-			// Parse the authorization header.
-			parts := strings.Split(authStr, " ")
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				err := errors.New("expected authorization header format: Bearer <token>")
-				return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+			// Integrations send an API key instead of a token, either in the
+			// header or as the client credentials of basic authentication:
+			// the client id is the ak_<prefix> part of the key, the client
+			// secret the rest.
+			key := c.Request.Header.Get("X-API-Key")
+			if clientID, clientSecret, ok := c.Request.BasicAuth(); ok && key == "" {
+				key = clientID + "_" + clientSecret
 			}
 
-			// Validate the token is signed by us.
-			claims, err := a.ValidateToken(parts[1])
-			if err != nil {
-				return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+			if key != "" {
+				claims, err = a.ValidateAPIKey(c.Ctx, key)
+				if err != nil {
+					return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+				}
+
+				// check the creator of the key against the state kept by
+				// the server
+				if err = a.VerifyKeyClaims(c.Ctx, claims); err != nil {
+					return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+				}
+
+				// Routes without permissions act on the current user, a key
+				// has no user of its own.
+				if len(permission) == 0 {
+					err := errors.New("api keys are not accepted by this route")
+					return c.RespondError(web.NewRequestError(err, http.StatusForbidden))
+				}
+			} else {
+				// Expecting: Bearer <token>
+				authStr := c.Request.Header.Get("authorization")
+
+				// Parse the authorization header.
+				parts := strings.Split(authStr, " ")
+				if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+					err := errors.New("expected authorization header format: Bearer <token>, Basic <client credentials> or X-API-Key: <key>")
+					return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+				}
+
+				// Validate the token is signed by us.
+				claims, err = a.ValidateToken(parts[1])
+				if err != nil {
+					return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+				}
+
+				// check claims against the state kept by the server
+				if err = a.VerifyClaims(c.Ctx, claims); err != nil {
+					return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+				}
 			}
 
-			//check role inside token data
-			if ok := claims.Authorized(role...); !ok && (len(role) > 0) {
-				return c.RespondError(web.NewRequestError(errors.New("attempted action is not allowed"), http.StatusUnauthorized))
+			//check permissions inside token data
+			if ok := claims.Authorized(permission...); !ok {
+				return c.RespondError(web.NewRequestError(errors.New("attempted action is not allowed"), http.StatusForbidden))
 			}
 
-			// check if claims from database
-			//if err = a.CheckClaimsDataFromDatabase(c.Ctx, claims); err != nil {
-			//	return c.RespondError(err)
-			//}
+			// The request logger reports the user.
+			if v, ok := c.Ctx.Value(web.KeyValues).(*web.Values); ok {
+				v.UserID = claims.UserId
+			}
 
 			// Add claims to the context so that they can be retrieved later.
 			c.Ctx = context.WithValue(c.Ctx, auth.Key, claims)
@@ -54,3 +95,28 @@ func Authenticate(a *auth.Auth, role ...string) web.Middleware {
 
 	return m
 }
+
+// ClientCredentials accepts only requests authenticated by an API key, e.g.
+// other services. It runs after Authenticate.
+func ClientCredentials() web.Middleware {
+	m := func(handler web.Handler) web.Handler {
+		h := func(c *web.Context) error {
+			claims, ok := c.Ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				err := errors.New("claims missing from context")
+				return c.RespondError(web.NewRequestError(err, http.StatusUnauthorized))
+			}
+
+			if claims.APIKeyID == 0 {
+				err := errors.New("route accepts only the client credentials of an api key")
+				return c.RespondError(web.NewRequestError(err, http.StatusForbidden))
+			}
+
+			return handler(c)
+		}
+
+		return h
+	}
+
+	return m
+}
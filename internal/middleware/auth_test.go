@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"project/foundation/web"
+	"project/internal/auth"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	// keys hold the role their creator had when it was created
+	keys := map[string]auth.Claims{
+		"ak_employee_secret": {UserId: 2, Role: auth.RoleEmployee, Permissions: []string{auth.PermUserRead}, APIKeyID: 10},
+		"ak_admin_secret":    {UserId: 1, Role: auth.RoleAdmin, Permissions: []string{auth.PermUserRead, auth.PermUserDelete}, APIKeyID: 11},
+		"ak_demoted_secret":  {UserId: 3, Role: auth.RoleEmployee, Permissions: []string{auth.PermUserRead}, APIKeyID: 12},
+	}
+
+	// the creator 3 is a student by now
+	roles := map[int]string{1: auth.RoleAdmin, 2: auth.RoleEmployee, 3: auth.RoleStudent}
+
+	a, err := auth.New("RS256", nil, auth.Keys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetAPIKeyValidator(func(ctx context.Context, key string) (auth.Claims, error) {
+		claims, ok := keys[key]
+		if !ok {
+			return auth.Claims{}, errors.New("invalid api key")
+		}
+		return claims, nil
+	})
+	a.AddKeyVerifier(func(ctx context.Context, claims auth.Claims) error {
+		if roles[claims.UserId] != claims.Role {
+			return errors.New("role of the user changed")
+		}
+		return nil
+	})
+
+	gin.SetMode(gin.TestMode)
+
+	app := web.NewApp(make(chan os.Signal, 1), "uz")
+	handler := func(c *web.Context) error {
+		claims := c.Ctx.Value(auth.Key).(auth.Claims)
+		return c.Respond(claims, http.StatusOK)
+	}
+	app.Get("/users", handler, Authenticate(a, auth.PermUserRead))
+	app.Delete("/users", handler, Authenticate(a, auth.PermUserDelete))
+	app.Get("/me", handler, Authenticate(a))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		basic  bool
+
+		status int
+
+		// role and userID are the ones of the claims the handler sees.
+		role   string
+		userID int
+	}{
+		{
+			name:   "key of an employee acts as its creator",
+			method: http.MethodGet, path: "/users", key: "ak_employee_secret",
+			status: http.StatusOK, role: auth.RoleEmployee, userID: 2,
+		},
+		{
+			name:   "key of an admin",
+			method: http.MethodDelete, path: "/users", key: "ak_admin_secret",
+			status: http.StatusOK, role: auth.RoleAdmin, userID: 1,
+		},
+		{
+			name:   "client credentials",
+			method: http.MethodGet, path: "/users", key: "ak_employee_secret", basic: true,
+			status: http.StatusOK, role: auth.RoleEmployee, userID: 2,
+		},
+		{
+			name:   "permission the key does not have",
+			method: http.MethodDelete, path: "/users", key: "ak_employee_secret",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "route of the current user",
+			method: http.MethodGet, path: "/me", key: "ak_admin_secret",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "creator with another role",
+			method: http.MethodGet, path: "/users", key: "ak_demoted_secret",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown key",
+			method: http.MethodGet, path: "/users", key: "ak_unknown_secret",
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.basic {
+				// the client id is the ak_<prefix> part of the key
+				i := strings.LastIndex(tt.key, "_")
+				r.SetBasicAuth(tt.key[:i], tt.key[i+1:])
+			} else {
+				r.Header.Set("X-API-Key", tt.key)
+			}
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var claims auth.Claims
+			if err := json.Unmarshal(w.Body.Bytes(), &claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.Role != tt.role || claims.UserId != tt.userID || claims.APIKeyID == 0 {
+				t.Errorf("claims %+v, want the key of user %d with the role %s", claims, tt.userID, tt.role)
+			}
+		})
+	}
+}
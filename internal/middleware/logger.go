@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"project/foundation/logger"
+	"project/foundation/web"
+	"strings"
+	"time"
+)
+
+// maxLoggedBody is the size of the request body kept for the log of a server
+// error, longer bodies are not logged.
+const maxLoggedBody = 64 << 10
+
+// Logger writes a structured log of every request to the logger. Sensitive
+// query parameters and body fields are redacted, the body is only logged for
+// server errors.
+func Logger(l *logger.Logger) web.Middleware {
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(c *web.Context) error {
+			v, ok := c.Ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			body := peekBody(c.Request)
+
+			err := handler(c)
+
+			// Errors the handler did not respond to get a 500 when the
+			// middlewares return.
+			status := v.StatusCode
+			if err != nil && status == 0 {
+				status = http.StatusInternalServerError
+			}
+
+			entry := logger.Entry{
+				Time:         v.Now,
+				Level:        logger.Level(status),
+				Method:       c.Request.Method,
+				Path:         c.Request.URL.Path,
+				Route:        c.FullPath(),
+				Query:        redactQuery(c.Request.URL.Query()),
+				Status:       status,
+				LatencyMS:    float64(time.Since(v.Now).Microseconds()) / 1000,
+				UserID:       v.UserID,
+				TraceID:      v.TraceID,
+				RequestID:    v.RequestID,
+				IP:           c.ClientIP(),
+				UserAgent:    c.Request.UserAgent(),
+				RequestSize:  c.Request.ContentLength,
+				ResponseSize: c.Writer.Size(),
+			}
+
+			if entry.RequestSize < 0 {
+				entry.RequestSize = 0
+			}
+			if entry.ResponseSize < 0 {
+				entry.ResponseSize = 0
+			}
+
+			if status >= http.StatusInternalServerError {
+				entry.Body = redactBody(c.ContentType(), body)
+			}
+
+			l.Write(entry)
+
+			// Return the error so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// peekBody returns the body of JSON and form requests without consuming it.
+func peekBody(r *http.Request) []byte {
+	if r.Body == nil || r.ContentLength > maxLoggedBody {
+		return nil
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/json") && !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil || len(body) > maxLoggedBody {
+		return nil
+	}
+
+	return body
+}
+
+func redactBody(contentType string, body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+
+	if contentType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		return redactQuery(values)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil
+	}
+
+	return logger.Redact(value)
+}
+
+func redactQuery(values url.Values) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	query := make(map[string]string, len(values))
+	for key := range values {
+		if logger.Sensitive(key) {
+			query[key] = logger.Redacted
+			continue
+		}
+		query[key] = strings.Join(values[key], ",")
+	}
+
+	return query
+}
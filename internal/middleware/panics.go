@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"project/foundation/web"
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Panics recovers from panics of the handlers. The stack is logged, the panic
+// is counted by route in panics_total and the caller gets a 500 with the
+// trace id of the request, the server keeps running.
+func Panics(log *log.Logger, reg prometheus.Registerer) web.Middleware {
+	panics := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "panics_total",
+		Help: "Number of recovered panics of the handlers by route.",
+	}, []string{"route"})
+
+	reg.MustRegister(panics)
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(c *web.Context) (err error) {
+
+			// Defer a function to recover from a panic and set the err return
+			// variable after the fact.
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+
+				panics.WithLabelValues(c.FullPath()).Inc()
+
+				var traceID string
+				if v, ok := c.Ctx.Value(web.KeyValues).(*web.Values); ok {
+					traceID = v.TraceID
+				}
+
+				log.Printf("%s : PANIC : %s %s : %v\n%s", traceID, c.Request.Method, c.Request.URL.Path, r, debug.Stack())
+				trace.SpanFromContext(c.Ctx).RecordError(errors.Errorf("panic : %v", r))
+
+				// The response can not be changed once it is written.
+				if c.Writer.Written() {
+					return
+				}
+
+				err = c.RespondError(web.NewRequestError(errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError))
+			}()
+
+			// Call the next handler and set its return value in the err variable.
+			return handler(c)
+		}
+
+		return h
+	}
+
+	return m
+}
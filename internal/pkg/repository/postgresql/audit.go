@@ -0,0 +1,215 @@
+package postgresql
+
+import (
+	"fmt"
+	"project/internal/auth"
+	"strconv"
+	"strings"
+)
+
+// Every INSERT, UPDATE and DELETE made under impersonation is written to the
+// audit_log table together with the ids of the admin and of the impersonated
+// user. Like the scope, the audit is added to the statements by the driver,
+// so no repository has to log by hand.
+//
+// The row is written by a CTE of the audited statement, so it is written in
+// the same transaction: a rolled back write is not in the log, and a write
+// whose row can not be written fails.
+//
+// Only the table, the id of the row and the names of the changed columns are
+// written, the values of the statement are not, they hold password hashes and
+// personal data.
+
+// auditCTE returns the CTE writing the audit row of the statement made with
+// the claims, "" if it is not audited.
+func auditCTE(claims auth.Claims, query string) string {
+	if claims.ActorID == 0 {
+		return ""
+	}
+
+	tokens := lex(query)
+
+	statement := mainStatement(tokens)
+	if statement < 0 {
+		return ""
+	}
+
+	operation := strings.ToUpper(tokens[statement].text)
+	switch operation {
+	case "INSERT", "UPDATE", "DELETE":
+	default:
+		return ""
+	}
+
+	change := auditedChange(query)
+
+	recordID := "NULL"
+	if change.recordID != nil {
+		recordID = strconv.FormatInt(*change.recordID, 10)
+	}
+
+	columns := make([]string, 0, len(change.columns))
+	for _, column := range change.columns {
+		columns = append(columns, quoteLiteral(column))
+	}
+
+	return fmt.Sprintf(`audit_entry AS (INSERT INTO %s.audit_log (actor_id, user_id, operation, table_name, record_id, changed_columns) VALUES (%d, %d, %s, %s, %s, ARRAY[%s]::text[]))`,
+		schema, claims.ActorID, claims.UserId, quoteLiteral(operation), quoteLiteral(change.table), recordID, strings.Join(columns, ", "))
+}
+
+// quoteLiteral returns s as an SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// change is what the audit log keeps of a statement.
+type change struct {
+	table    string
+	recordID *int64
+	columns  []string
+}
+
+// auditedChange returns the table changed by the statement, the id its WHERE
+// clause compares with a number and the columns it sets. The id is nil for
+// inserts and for changes that do not name a row.
+func auditedChange(query string) change {
+	c := change{columns: make([]string, 0)}
+
+	tokens := lex(query)
+
+	statement := mainStatement(tokens)
+	if statement < 0 {
+		return c
+	}
+
+	i := statement + 1
+	switch tokens[statement].text {
+	case "select":
+		return c
+	case "delete", "insert":
+		if i >= len(tokens) || (tokens[i].text != "from" && tokens[i].text != "into") {
+			return c
+		}
+		i++
+	}
+	if i < len(tokens) && tokens[i].text == "only" {
+		i++
+	}
+	if i >= len(tokens) || (tokens[i].kind != tokenWord && tokens[i].kind != tokenIdent) {
+		return c
+	}
+
+	// schema qualified tables are logged without the schema
+	if i+2 < len(tokens) && tokens[i+1].kind == tokenDot {
+		i += 2
+	}
+	c.table = tokens[i].text
+	depth := tokens[i].depth
+
+	switch tokens[statement].text {
+	case "insert":
+		// the column list directly follows the table and its alias
+		start := i + 1
+		if start+1 < len(tokens) && tokens[start].text == "as" {
+			start += 2
+		}
+		for j := start; j < len(tokens) && tokens[j].depth == depth+1; j++ {
+			if tokens[j].kind == tokenWord || tokens[j].kind == tokenIdent {
+				c.columns = append(c.columns, tokens[j].text)
+			}
+		}
+		for j := i + 1; j+2 < len(tokens); j++ {
+			if tokens[j].depth == depth && tokens[j].text == "do" && tokens[j+1].text == "update" && tokens[j+2].text == "set" {
+				c.columns = appendSet(c.columns, query, tokens, j+2, depth)
+				break
+			}
+		}
+	case "update":
+		for j := i + 1; j < len(tokens); j++ {
+			if tokens[j].depth == depth && tokens[j].text == "set" {
+				c.columns = appendSet(c.columns, query, tokens, j, depth)
+				break
+			}
+		}
+		c.recordID = whereID(query, tokens, i+1, depth)
+	case "delete":
+		c.recordID = whereID(query, tokens, i+1, depth)
+	}
+
+	return c
+}
+
+// appendSet appends the columns assigned by the SET clause starting at the
+// token set that are not in columns yet. A column starts the clause or
+// follows a comma and is followed by "=".
+func appendSet(columns []string, query string, tokens []token, set, depth int) []string {
+	for j := set + 1; j < len(tokens); j++ {
+		t := tokens[j]
+		if t.depth < depth || (t.depth == depth && clauseKeywords[t.text]) {
+			break
+		}
+		if t.depth != depth || (t.kind != tokenWord && t.kind != tokenIdent) {
+			continue
+		}
+
+		before := strings.TrimSpace(query[tokens[j-1].end:t.start])
+		after := strings.TrimSpace(query[t.end:])
+		if (j-1 == set || strings.HasSuffix(before, ",")) && strings.HasPrefix(after, "=") && !contains(columns, t.text) {
+			columns = append(columns, t.text)
+		}
+	}
+
+	return columns
+}
+
+// whereID returns the id the WHERE clause starting after the token from
+// compares with a number, nil if there is none.
+func whereID(query string, tokens []token, from, depth int) *int64 {
+	where := -1
+	for j := from; j < len(tokens); j++ {
+		if tokens[j].depth == depth && tokens[j].text == "where" {
+			where = j
+			break
+		}
+	}
+	if where < 0 {
+		return nil
+	}
+
+	for j := where + 1; j < len(tokens); j++ {
+		t := tokens[j]
+		if t.depth == depth && t.text == "returning" {
+			break
+		}
+		// bun wraps every condition in parentheses
+		if t.depth > depth+1 || t.text != "id" {
+			continue
+		}
+
+		after := strings.TrimSpace(query[t.end:])
+		if !strings.HasPrefix(after, "=") {
+			continue
+		}
+		after = strings.TrimSpace(after[1:])
+
+		end := 0
+		for end < len(after) && after[end] >= '0' && after[end] <= '9' {
+			end++
+		}
+		if id, err := strconv.ParseInt(after[:end], 10, 64); err == nil {
+			return &id
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,159 @@
+package postgresql
+
+import (
+	"context"
+	"project/internal/auth"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditedChange(t *testing.T) {
+	id := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name     string
+		query    string
+		table    string
+		recordID *int64
+		columns  []string
+	}{
+		{
+			name:    "insert",
+			query:   `INSERT INTO "users" AS "user" ("username", "password") VALUES ('ali', '$2a$10$hash') RETURNING "id"`,
+			table:   "users",
+			columns: []string{"username", "password"},
+		},
+		{
+			name:    "insert without columns",
+			query:   `INSERT INTO password_history VALUES (3, '$2a$10$hash', now())`,
+			table:   "password_history",
+			columns: []string{},
+		},
+		{
+			name:     "update",
+			query:    `UPDATE "users" SET "full_name" = 'a, b = c', phone = '998901234567', updated_at = now() WHERE (deleted_at IS NULL AND id = 3) RETURNING id`,
+			table:    "users",
+			recordID: id(3),
+			columns:  []string{"full_name", "phone", "updated_at"},
+		},
+		{
+			name:    "update with an expression",
+			query:   `UPDATE user_mfa SET attempts = CASE WHEN attempts = 1 THEN 2 ELSE 3 END WHERE user_id = 4`,
+			table:   "user_mfa",
+			columns: []string{"attempts"},
+		},
+		{
+			name:     "qualified delete",
+			query:    `DELETE FROM public.department WHERE "department"."id" = 12`,
+			table:    "department",
+			recordID: id(12),
+			columns:  []string{},
+		},
+		{
+			name:    "insert on conflict",
+			query:   `INSERT INTO user_mfa (user_id, secret) VALUES (3, 'secret') ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled = false`,
+			table:   "user_mfa",
+			columns: []string{"user_id", "secret", "enabled"},
+		},
+		{
+			name:    "with",
+			query:   `WITH x AS (SELECT 1) UPDATE region SET name = 'a' WHERE id IN (SELECT * FROM x)`,
+			table:   "region",
+			columns: []string{"name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := auditedChange(tt.query)
+
+			if got.table != tt.table {
+				t.Errorf("table %q, want %q", got.table, tt.table)
+			}
+			if !reflect.DeepEqual(got.recordID, tt.recordID) {
+				t.Errorf("record id %v, want %v", got.recordID, tt.recordID)
+			}
+			if !reflect.DeepEqual(got.columns, tt.columns) {
+				t.Errorf("columns %q, want %q", got.columns, tt.columns)
+			}
+		})
+	}
+}
+
+func TestAuditCTE(t *testing.T) {
+	impersonated := auth.Claims{UserId: 7, Role: auth.RoleEmployee, ActorID: 1}
+
+	tests := []struct {
+		name   string
+		claims auth.Claims
+		query  string
+		want   string
+	}{
+		{
+			name:   "update",
+			claims: impersonated,
+			query:  `UPDATE region SET name = 'a' WHERE id = 3`,
+			want:   `audit_entry AS (INSERT INTO public.audit_log (actor_id, user_id, operation, table_name, record_id, changed_columns) VALUES (1, 7, 'UPDATE', 'region', 3, ARRAY['name']::text[]))`,
+		},
+		{
+			name:   "insert",
+			claims: impersonated,
+			query:  `INSERT INTO position (name) VALUES ('{}')`,
+			want:   `audit_entry AS (INSERT INTO public.audit_log (actor_id, user_id, operation, table_name, record_id, changed_columns) VALUES (1, 7, 'INSERT', 'position', NULL, ARRAY['name']::text[]))`,
+		},
+		{
+			name:   "select",
+			claims: impersonated,
+			query:  `SELECT id FROM region FOR UPDATE`,
+		},
+		{
+			name:   "not impersonated",
+			claims: auth.Claims{UserId: 7, Role: auth.RoleEmployee},
+			query:  `UPDATE region SET name = 'a' WHERE id = 3`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auditCTE(tt.claims, tt.query); got != tt.want {
+				t.Errorf("auditCTE:\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedConnAudits(t *testing.T) {
+	claims := auth.Claims{UserId: 7, Role: auth.RoleEmployee, ActorID: 1}
+	ctx := context.WithValue(context.Background(), auth.Key, claims)
+
+	query := `UPDATE users SET full_name = 'a' WHERE id = 9`
+	scoped, err := scopeQuery(claims, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := scopedConn{}.scope(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the audit is of the statement as written, the conditions of the
+	// scope do not change the id of the row
+	want := "WITH " + auditCTE(claims, query) + ", " + strings.TrimPrefix(scoped, "WITH ")
+	if got != want {
+		t.Errorf("scope:\n got %s\nwant %s", got, want)
+	}
+	if !strings.Contains(got, "'users', 9, ARRAY['full_name']") {
+		t.Errorf("scope: %s does not audit user 9", got)
+	}
+
+	// unscoped writes under impersonation are audited too
+	got, err = scopedConn{}.scope(Unscoped(ctx), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "WITH " + auditCTE(claims, query) + " " + query; got != want {
+		t.Errorf("unscoped:\n got %s\nwant %s", got, want)
+	}
+}
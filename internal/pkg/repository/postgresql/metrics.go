@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uptrace/bun"
+)
+
+// statementTable matches the first table a statement reads or writes.
+var statementTable = regexp.MustCompile(`(?i)\b(?:from|into|update|table)\s+(?:if\s+(?:not\s+)?exists\s+)?"?([a-z_][a-z0-9_.]*)`)
+
+// MetricsHook counts the queries and measures their latency by table and
+// operation.
+type MetricsHook struct {
+	queries  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func NewMetricsHook(reg prometheus.Registerer) *MetricsHook {
+	h := MetricsHook{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "db_queries_total",
+			Help: "Number of database queries by table, operation and status.",
+		}, []string{"table", "operation", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Latency of database queries by table and operation.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"table", "operation"}),
+	}
+	reg.MustRegister(h.queries, h.duration)
+
+	return &h
+}
+
+func (h *MetricsHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *MetricsHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	operation := strings.ToUpper(event.Operation())
+	name := queryTable(event)
+
+	status := "ok"
+	if event.Err != nil && event.Err != sql.ErrNoRows {
+		status = "error"
+	}
+
+	h.queries.WithLabelValues(name, operation, status).Inc()
+	h.duration.WithLabelValues(name, operation).Observe(time.Since(event.StartTime).Seconds())
+}
+
+// queryTable returns the table of the model of the query, or the first table
+// of its statement for raw queries.
+func queryTable(event *bun.QueryEvent) string {
+	if model, ok := event.Model.(bun.TableModel); ok && model.Table() != nil {
+		return model.Table().Name
+	}
+
+	if match := statementTable.FindStringSubmatch(event.Query); match != nil {
+		return strings.ToLower(match[1])
+	}
+
+	return "unknown"
+}
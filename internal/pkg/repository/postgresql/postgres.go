@@ -14,7 +14,6 @@ import (
 	"project/foundation/web"
 	"project/internal/auth"
 	"reflect"
-	"strings"
 	"time"
 )
 
@@ -46,23 +45,34 @@ type Database struct {
 	DefaultLang   string
 }
 
-func NewDB(cfg Config) *Database {
+// NewDB connects to the database and checks that it is reachable.
+func NewDB(cfg Config) (*Database, error) {
 	dsn := fmt.Sprintf("postgres://%v:%v@localhost:5432/%v?sslmode=disable", cfg.User, cfg.Password, cfg.Name)
 
-	sqlDB := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
+	sqlDB := sql.OpenDB(scopedConnector{pgdriver.NewConnector(pgdriver.WithDSN(dsn))})
 
 	db := bun.NewDB(sqlDB, pgdialect.New())
 
+	// the span of a query covers the other hooks
+	db.AddQueryHook(NewTracingHook())
 	db.AddQueryHook(bundebug.NewQueryHook(
 		bundebug.WithVerbose(true),
 		bundebug.FromEnv("BUNDEBUG"),
 	))
 
-	return &Database{DB: db, DBName: cfg.Name, DBPassword: cfg.Password, DBUser: cfg.User, ServerBaseUrl: cfg.ServerBaseUrl, DefaultLang: cfg.DefaultLang}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "pinging db")
+	}
+
+	return &Database{DB: db, DBName: cfg.Name, DBPassword: cfg.Password, DBUser: cfg.User, ServerBaseUrl: cfg.ServerBaseUrl, DefaultLang: cfg.DefaultLang}, nil
 }
 
-func (d Database) DeleteRow(ctx context.Context, table string, id int) error {
-	claims, err := d.CheckClaims(ctx)
+func (d Database) DeleteRow(ctx context.Context, table string, id int, permission ...string) error {
+	claims, err := d.CheckClaims(ctx, permission...)
 	if err != nil {
 		return err
 	}
@@ -71,33 +81,34 @@ func (d Database) DeleteRow(ctx context.Context, table string, id int) error {
 		Table(table).
 		Where("id = ?", id).
 		Set("deleted_at = ?", time.Now()).
-		Set("deleted_by = ?", claims.UserId)
+		Set("deleted_by = ?", claims.UserId).
+		Set("deleted_by_actor = ?", claims.Actor())
 
-	_, err = q.Exec(ctx)
+	result, err := q.Exec(ctx)
 	if err != nil {
 		return web.NewRequestError(errors.Wrapf(err, "deleting %s", table), http.StatusBadRequest)
 	}
 
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(errors.Errorf("%s %d not found", table, id), http.StatusNotFound)
+	}
+
 	return nil
 }
 
-func (d Database) CheckClaims(ctx context.Context, role ...string) (auth.Claims, error) {
+// CheckClaims returns the claims stored in the context if they hold every one
+// of the provided permissions.
+func (d Database) CheckClaims(ctx context.Context, permission ...string) (auth.Claims, error) {
 	claims, ok := ctx.Value(auth.Key).(auth.Claims)
 	if !ok {
 		return auth.Claims{}, web.NewRequestError(errors.New("claims missing from context"), http.StatusBadRequest)
 	}
 
-	for _, r := range role {
-		if strings.Compare(r, claims.Role) == 0 {
-			return claims, nil
-		}
-	}
-
-	if len(role) == 0 {
-		return claims, nil
+	if !claims.Authorized(permission...) {
+		return auth.Claims{}, web.NewRequestError(errors.New("no permission"), http.StatusForbidden)
 	}
 
-	return auth.Claims{}, errors.New("no permission")
+	return claims, nil
 }
 
 func (d Database) GetLang(ctx context.Context) string {
@@ -0,0 +1,593 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"project/internal/auth"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Queries run with the claims of a request are limited to the rows in the
+// scope of the claims. The scope is applied to the statements by the driver,
+// so every query of the repositories is scoped, raw SQL and bun queries
+// alike:
+//
+//   - a scoped table read by a statement is replaced by a CTE of the same
+//     name holding the rows in scope,
+//   - UPDATE and DELETE statements, and the updates of INSERT on conflict,
+//     only change the rows in scope.
+//
+// Queries without claims, e.g. while signing in, and queries of admins are
+// not scoped.
+
+// ScopeFunc returns the SQL condition limiting the rows of a table to the ones
+// visible to the claims. alias is prepended to the column names, it ends with
+// a dot. Tables in the condition must be qualified with the schema, otherwise
+// they are scoped again.
+type ScopeFunc func(claims auth.Claims, alias string) string
+
+// schema is the schema of the tables, the condition of a scope qualifies
+// them with it.
+const schema = "public"
+
+// scopes holds the row-level scope of the tables owned by departments and by
+// their staff. Rows of other tables are not scoped:
+//
+//   - republic, region, district and position are the reference data every
+//     user picks from, e.g. for the birth district or the position of staff.
+//     They are not owned by a department or a user, they have no column a
+//     scope could use, and changing them takes the permissions of the
+//     reference data, not the ones of the staff.
+//   - permissions, role_permissions and mfa_policies are the configuration
+//     of the roles, they hold no data of the users.
+var scopes = map[string]ScopeFunc{
+	"department":          departmentScope,
+	"users":               staffScope,
+	"user_departments":    membershipScope,
+	"user_mfa":            staffOwned("user_id"),
+	"user_recovery_codes": staffOwned("user_id"),
+	"user_invitations":    staffOwned("user_id"),
+	"password_history":    staffOwned("user_id"),
+	"sign_in_history":     staffOwned("user_id"),
+	"audit_log":           staffOwned("user_id"),
+	"api_keys":            staffOwned("created_by"),
+	"api_key_permissions": apiKeyOwned,
+}
+
+// ErrUnscopable is returned for statements with claims that the scope can not
+// be applied to. They are not run, rather than run unscoped.
+var ErrUnscopable = errors.New("statement can not be scoped")
+
+type unscopedKey struct{}
+
+// Unscoped returns a context whose queries are not scoped. It is meant for
+// checks across all rows, e.g. that a username is not used yet, the results
+// must not be returned to the caller.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// scopeClaims returns the claims the queries of the context are scoped by,
+// false if they are not scoped.
+func scopeClaims(ctx context.Context) (auth.Claims, bool) {
+	if unscoped, _ := ctx.Value(unscopedKey{}).(bool); unscoped {
+		return auth.Claims{}, false
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return auth.Claims{}, false
+	}
+
+	// API keys carry the role their creator had, so only the keys of admins
+	// are unscoped.
+	if claims.Role == auth.RoleAdmin {
+		return auth.Claims{}, false
+	}
+
+	return claims, true
+}
+
+// departmentScope allows the departments the user is assigned to.
+func departmentScope(claims auth.Claims, alias string) string {
+	return fmt.Sprintf(`%sid IN (SELECT department_id FROM %s.user_departments WHERE user_id = %d)`, alias, schema, claims.UserId)
+}
+
+// staffScope allows the user itself and the staff of the departments the
+// user heads.
+func staffScope(claims auth.Claims, alias string) string {
+	return fmt.Sprintf(`%[1]sid = %[2]d OR %[1]sid IN (
+		SELECT staff.user_id
+		FROM %[3]s.user_departments AS staff
+		JOIN %[3]s.user_departments AS head ON head.department_id = staff.department_id
+		WHERE head.user_id = %[2]d AND head.is_head
+	)`, alias, claims.UserId, schema)
+}
+
+// membershipScope allows the assignments of the departments of the user and
+// the ones of the users in scope.
+func membershipScope(claims auth.Claims, alias string) string {
+	return fmt.Sprintf(`%[1]sdepartment_id IN (SELECT department_id FROM %[2]s.user_departments WHERE user_id = %[3]d) OR %[1]suser_id IN (
+		SELECT scoped.id FROM %[2]s.users AS scoped WHERE %[4]s
+	)`, alias, schema, claims.UserId, staffScope(claims, "scoped."))
+}
+
+// staffOwned allows the rows whose column references a user in scope.
+func staffOwned(column string) ScopeFunc {
+	return func(claims auth.Claims, alias string) string {
+		return fmt.Sprintf(`%s%s IN (SELECT scoped.id FROM %s.users AS scoped WHERE %s)`, alias, column, schema, staffScope(claims, "scoped."))
+	}
+}
+
+// apiKeyOwned allows the rows of the API keys created by the users in scope.
+func apiKeyOwned(claims auth.Claims, alias string) string {
+	return fmt.Sprintf(`%sapi_key_id IN (SELECT keys.id FROM %s.api_keys AS keys WHERE %s)`, alias, schema, staffOwned("created_by")(claims, "keys."))
+}
+
+// scopeQuery returns the statement limited to the rows in the scope of the
+// claims. Scoped tables qualified with a schema are rejected, the CTEs can
+// not replace them, see ScopeFunc.
+func scopeQuery(claims auth.Claims, query string) (string, error) {
+	tokens := lex(query)
+
+	for i, t := range tokens {
+		if _, ok := scopes[t.text]; ok && (t.kind == tokenWord || t.kind == tokenIdent) && i > 0 && tokens[i-1].kind == tokenDot {
+			return "", errors.Wrapf(ErrUnscopable, "qualified table %s", t.text)
+		}
+	}
+
+	tables := scopedTables(tokens)
+	if len(tables) == 0 {
+		return query, nil
+	}
+
+	statement := mainStatement(tokens)
+	if statement < 0 {
+		return "", errors.Wrapf(ErrUnscopable, "statement starts with %q", tokens[0].text)
+	}
+
+	for i, t := range tokens {
+		if t.kind == tokenSemicolon && i+1 < len(tokens) {
+			return "", errors.Wrap(ErrUnscopable, "statements are chained")
+		}
+
+		// CTEs are not applied to the tables changed by a statement, so
+		// the changes nested in another statement can not be scoped.
+		if t.depth > 0 && t.kind == tokenWord && (t.text == "update" || t.text == "delete" || t.text == "insert") && (i == 0 || !lockKeywords[tokens[i-1].text]) {
+			return "", errors.Wrapf(ErrUnscopable, "nested %s", t.text)
+		}
+	}
+
+	// The target of INSERT, UPDATE and DELETE is the table, not the CTE, so
+	// the scope is added to the WHERE clause of the change. This is done
+	// first, the CTEs are prepended and move the positions.
+	var err error
+	if query, err = scopeTarget(claims, query, tokens, statement); err != nil {
+		return "", err
+	}
+
+	ctes := make([]string, 0, len(tables))
+	for _, table := range tables {
+		ctes = append(ctes, fmt.Sprintf(`%[1]s AS (SELECT * FROM %[2]s.%[1]s AS %[1]s WHERE %[3]s)`, table, schema, scopes[table](claims, table+".")))
+	}
+
+	return prependCTEs(query, tokens, ctes), nil
+}
+
+// prependCTEs adds the CTEs before the ones of the statement. The CTEs of the
+// statement can read the scoped tables too, so the scoped ones go first.
+func prependCTEs(query string, tokens []token, ctes []string) string {
+	if tokens[0].text == "with" {
+		at := tokens[0].end
+		if len(tokens) > 1 && tokens[1].text == "recursive" {
+			at = tokens[1].end
+		}
+		return query[:at] + " " + strings.Join(ctes, ", ") + "," + query[at:]
+	}
+
+	return "WITH " + strings.Join(ctes, ", ") + " " + query
+}
+
+// lockKeywords precede UPDATE and DELETE when they are not a statement, e.g.
+// in SELECT ... FOR UPDATE or in the actions of a foreign key.
+var lockKeywords = map[string]bool{
+	"for": true, "key": true, "on": true, "do": true,
+}
+
+// scopeTarget adds the scope of the table changed by the statement to its
+// WHERE clause. The rows an INSERT adds are not scoped, the ones it updates
+// on conflict are.
+func scopeTarget(claims auth.Claims, query string, tokens []token, statement int) (string, error) {
+	i := statement + 1
+	switch tokens[statement].text {
+	case "select":
+		return query, nil
+	case "delete", "insert":
+		if i >= len(tokens) || (tokens[i].text != "from" && tokens[i].text != "into") {
+			return "", errors.Wrapf(ErrUnscopable, "missing target of %s", tokens[statement].text)
+		}
+		i++
+	}
+	if i < len(tokens) && tokens[i].text == "only" {
+		i++
+	}
+	if i >= len(tokens) || (tokens[i].kind != tokenWord && tokens[i].kind != tokenIdent) {
+		return "", errors.Wrap(ErrUnscopable, "missing target table")
+	}
+
+	target := tokens[i]
+	if i+1 < len(tokens) && tokens[i+1].kind == tokenDot {
+		// scoped tables qualified with a schema are rejected by scopeQuery,
+		// the other ones are not scoped
+		return query, nil
+	}
+
+	scope, ok := scopes[target.text]
+	if !ok {
+		return query, nil
+	}
+
+	ref := query[target.start:target.end]
+	if alias := i + 1; alias < len(tokens) {
+		if tokens[alias].text == "as" {
+			alias++
+		}
+		if alias < len(tokens) && tokens[alias].depth == 0 && (tokens[alias].kind == tokenIdent || (tokens[alias].kind == tokenWord && !clauseKeywords[tokens[alias].text])) {
+			ref = query[tokens[alias].start:tokens[alias].end]
+		}
+	}
+
+	from := i + 1
+	if tokens[statement].text == "insert" {
+		from = -1
+		for j := i + 1; j+1 < len(tokens); j++ {
+			if tokens[j].depth == 0 && tokens[j].text == "do" && tokens[j+1].text == "update" {
+				from = j + 2
+				break
+			}
+		}
+		if from < 0 {
+			return query, nil
+		}
+	}
+
+	return scopeWhere(query, tokens, from, "("+scope(claims, ref+".")+")"), nil
+}
+
+// scopeWhere adds the condition to the first top-level WHERE clause starting
+// at the token from, or adds the clause.
+func scopeWhere(query string, tokens []token, from int, condition string) string {
+	where, returning := -1, -1
+	for j := from; j < len(tokens); j++ {
+		if tokens[j].depth != 0 {
+			continue
+		}
+		switch {
+		case tokens[j].text == "where" && where < 0 && returning < 0:
+			where = j
+		case tokens[j].text == "returning":
+			returning = j
+		}
+	}
+
+	end := len(strings.TrimRight(query, "; \t\r\n"))
+	if returning >= 0 {
+		end = tokens[returning].start
+	}
+
+	if where < 0 {
+		return strings.TrimRight(query[:end], " \t\r\n") + " WHERE " + condition + " " + query[end:]
+	}
+
+	return query[:tokens[where].end] + " " + condition + " AND (" + query[tokens[where].end:end] + ") " + query[end:]
+}
+
+// clauseKeywords follow the target table of UPDATE and DELETE when it has no
+// alias.
+var clauseKeywords = map[string]bool{
+	"set": true, "where": true, "using": true, "returning": true, "from": true,
+}
+
+// scopedTables returns the scoped tables the statement references, sorted.
+// Names qualified with a schema are left out.
+func scopedTables(tokens []token) []string {
+	seen := make(map[string]bool)
+	for i, t := range tokens {
+		if t.kind != tokenWord && t.kind != tokenIdent {
+			continue
+		}
+		if _, ok := scopes[t.text]; !ok {
+			continue
+		}
+		if i > 0 && tokens[i-1].kind == tokenDot {
+			continue
+		}
+		seen[t.text] = true
+	}
+
+	tables := make([]string, 0, len(seen))
+	for table := range seen {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	return tables
+}
+
+// mainStatement returns the index of the keyword of the statement after its
+// CTEs, -1 if it is not a SELECT, INSERT, UPDATE or DELETE.
+func mainStatement(tokens []token) int {
+	for i, t := range tokens {
+		if t.depth != 0 || t.kind != tokenWord {
+			continue
+		}
+		switch t.text {
+		case "select", "insert", "update", "delete":
+			return i
+		}
+		if i == 0 && t.text != "with" {
+			return -1
+		}
+	}
+
+	return -1
+}
+
+const (
+	tokenWord = iota
+	tokenIdent
+	tokenDot
+	tokenSemicolon
+	tokenOther
+)
+
+// token is a word, a quoted identifier or a punctuation of a statement.
+// Literals and comments are skipped. depth is the nesting in parentheses.
+type token struct {
+	kind       int
+	text       string
+	start, end int
+	depth      int
+}
+
+// lex splits the statement into tokens. Words are lowercase, identifiers
+// unquoted.
+func lex(query string) []token {
+	var (
+		tokens []token
+		depth  int
+	)
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			i = skipString(query, i, false)
+		case (c == 'e' || c == 'E') && i+1 < len(query) && query[i+1] == '\'' && !wordByte(query, i-1):
+			i = skipString(query, i+1, true)
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				end = len(query) - i - 1
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: query[i+1 : i+1+end], start: i, end: i + end + 2, depth: depth})
+			i += end + 2
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			i += end
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i - 4
+			}
+			i += end + 4
+		case c == '$':
+			i = skipDollar(query, i)
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			depth--
+			i++
+		case c == '.':
+			tokens = append(tokens, token{kind: tokenDot, text: ".", start: i, end: i + 1, depth: depth})
+			i++
+		case c == ';':
+			tokens = append(tokens, token{kind: tokenSemicolon, text: ";", start: i, end: i + 1, depth: depth})
+			i++
+		case wordByte(query, i) && !(c >= '0' && c <= '9'):
+			start := i
+			for i < len(query) && wordByte(query, i) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToLower(query[start:i]), start: start, end: i, depth: depth})
+		case c >= '0' && c <= '9':
+			for i < len(query) && (wordByte(query, i) || query[i] == '.') {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func wordByte(query string, i int) bool {
+	if i < 0 || i >= len(query) {
+		return false
+	}
+	c := query[i]
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// skipString returns the position after the string literal at i. Quotes are
+// escaped by doubling them, and by a backslash in escape strings.
+func skipString(query string, i int, escapes bool) int {
+	for i++; i < len(query); i++ {
+		switch {
+		case escapes && query[i] == '\\':
+			i++
+		case query[i] == '\'':
+			if i+1 < len(query) && query[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+
+	return len(query)
+}
+
+// skipDollar returns the position after the dollar-quoted string or the
+// positional parameter at i.
+func skipDollar(query string, i int) int {
+	end := i + 1
+	for end < len(query) && wordByte(query, end) {
+		end++
+	}
+
+	if end >= len(query) || query[end] != '$' || (end > i+1 && query[i+1] >= '0' && query[i+1] <= '9') {
+		return end
+	}
+
+	tag := query[i : end+1]
+	close := strings.Index(query[end+1:], tag)
+	if close < 0 {
+		return len(query)
+	}
+
+	return end + 1 + close + len(tag)
+}
+
+// scopedConnector opens connections whose statements are scoped and audited
+// by the claims of their context.
+type scopedConnector struct {
+	driver.Connector
+}
+
+func (c scopedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return scopedConn{conn}, nil
+}
+
+type scopedConn struct {
+	driver.Conn
+}
+
+// scope returns the statement scoped by the claims of the context, with the
+// audit of impersonation. The change is audited as written, the scope adds
+// conditions the audit would read as the id of the row.
+func (c scopedConn) scope(ctx context.Context, query string) (string, error) {
+	var audit string
+	if claims, ok := ctx.Value(auth.Key).(auth.Claims); ok {
+		audit = auditCTE(claims, query)
+	}
+
+	if claims, ok := scopeClaims(ctx); ok {
+		var err error
+		if query, err = scopeQuery(claims, query); err != nil {
+			return "", err
+		}
+	}
+
+	if audit == "" {
+		return query, nil
+	}
+
+	return prependCTEs(query, lex(query), []string{audit}), nil
+}
+
+func (c scopedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	query, err := c.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c scopedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	query, err := c.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c scopedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query, err := c.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+
+	return c.Conn.Prepare(query)
+}
+
+func (c scopedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+
+	//lint:ignore SA1019 the driver does not support options
+	return c.Conn.Begin() //nolint:staticcheck
+}
+
+func (c scopedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (c scopedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c scopedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+
+	return true
+}
+
+func (c scopedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+
+	return driver.ErrSkip
+}
@@ -0,0 +1,216 @@
+package postgresql
+
+import (
+	"context"
+	"project/internal/auth"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestScopeQuery(t *testing.T) {
+	claims := auth.Claims{UserId: 7, Role: auth.RoleEmployee}
+	users := "users AS (SELECT * FROM public.users AS users WHERE " + staffScope(claims, "users.") + ")"
+	departments := "department AS (SELECT * FROM public.department AS department WHERE " + departmentScope(claims, "department.") + ")"
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "unscoped table",
+			query: `SELECT id FROM region WHERE deleted_at IS NULL`,
+			want:  `SELECT id FROM region WHERE deleted_at IS NULL`,
+		},
+		{
+			name:  "qualified unscoped table",
+			query: `SELECT id FROM public.region`,
+			want:  `SELECT id FROM public.region`,
+		},
+		{
+			name:  "position",
+			query: `SELECT id, name FROM position WHERE deleted_at IS NULL`,
+			want:  `SELECT id, name FROM position WHERE deleted_at IS NULL`,
+		},
+		{
+			name:  "region and district",
+			query: `SELECT d.id FROM district AS d JOIN region AS r ON r.id = d.region_id`,
+			want:  `SELECT d.id FROM district AS d JOIN region AS r ON r.id = d.region_id`,
+		},
+		{
+			name:  "update district",
+			query: `UPDATE district SET name = '{}' WHERE id = 1`,
+			want:  `UPDATE district SET name = '{}' WHERE id = 1`,
+		},
+		{
+			name:  "literals and comments",
+			query: `SELECT 'users', E'\'users', $$users$$, $tag$department$tag$ FROM region -- users` + "\n" + `/* department */`,
+			want:  `SELECT 'users', E'\'users', $$users$$, $tag$department$tag$ FROM region -- users` + "\n" + `/* department */`,
+		},
+		{
+			name:  "select",
+			query: `SELECT id FROM department WHERE deleted_at IS NULL`,
+			want:  `WITH ` + departments + ` SELECT id FROM department WHERE deleted_at IS NULL`,
+		},
+		{
+			name:  "join",
+			query: `SELECT u.id FROM users AS u JOIN department AS d ON d.id = 1`,
+			want:  `WITH ` + departments + `, ` + users + ` SELECT u.id FROM users AS u JOIN department AS d ON d.id = 1`,
+		},
+		{
+			name:  "quoted identifiers",
+			query: `SELECT "u"."id" FROM "users" AS "u"`,
+			want:  `WITH ` + users + ` SELECT "u"."id" FROM "users" AS "u"`,
+		},
+		{
+			name:  "with",
+			query: `WITH x AS (SELECT 1) SELECT * FROM x, users`,
+			want:  `WITH ` + users + `, x AS (SELECT 1) SELECT * FROM x, users`,
+		},
+		{
+			name:  "with recursive",
+			query: `WITH RECURSIVE x AS (SELECT 1) SELECT * FROM x, users`,
+			want:  `WITH RECURSIVE ` + users + `, x AS (SELECT 1) SELECT * FROM x, users`,
+		},
+		{
+			name:  "update",
+			query: `UPDATE "users" SET "full_name" = 'a''b' WHERE (deleted_at IS NULL AND id = 3) RETURNING id`,
+			want:  `WITH ` + users + ` UPDATE "users" SET "full_name" = 'a''b' WHERE (` + staffScope(claims, `"users".`) + `) AND ( (deleted_at IS NULL AND id = 3) ) RETURNING id`,
+		},
+		{
+			name:  "update with alias and without where",
+			query: `UPDATE users AS u SET full_name = 'a';`,
+			want:  `WITH ` + users + ` UPDATE users AS u SET full_name = 'a' WHERE (` + staffScope(claims, "u.") + `) ;`,
+		},
+		{
+			name:  "delete",
+			query: `DELETE FROM department WHERE id = 3`,
+			want:  `WITH ` + departments + ` DELETE FROM department WHERE (` + departmentScope(claims, "department.") + `) AND ( id = 3) `,
+		},
+		{
+			name:  "insert",
+			query: `INSERT INTO users (username) VALUES ('a') RETURNING id`,
+			want:  `WITH ` + users + ` INSERT INTO users (username) VALUES ('a') RETURNING id`,
+		},
+		{
+			name:  "insert on conflict",
+			query: `INSERT INTO department (id) SELECT 1 FROM region WHERE id = 1 ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name`,
+			want:  `WITH ` + departments + ` INSERT INTO department (id) SELECT 1 FROM region WHERE id = 1 ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name WHERE (` + departmentScope(claims, "department.") + `) `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scopeQuery(claims, tt.query)
+			if err != nil {
+				t.Fatalf("scopeQuery: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("scopeQuery:\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeQueryUnscopable(t *testing.T) {
+	claims := auth.Claims{UserId: 7, Role: auth.RoleEmployee}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "chained", query: `SELECT 1; DELETE FROM users`},
+		{name: "nested delete", query: `WITH d AS (DELETE FROM users RETURNING id) SELECT * FROM d`},
+		{name: "nested update", query: `SELECT * FROM (UPDATE department SET name = '{}' RETURNING id) AS d`},
+		{name: "other statement", query: `TRUNCATE users`},
+		{name: "qualified table", query: `SELECT id FROM public.users`},
+		{name: "qualified quoted table", query: `SELECT id FROM "public"."users"`},
+		{name: "qualified table in union", query: `SELECT id FROM region UNION SELECT id FROM public.users`},
+		{name: "qualified target", query: `UPDATE public.users SET role = 'ADMIN' WHERE id = 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := scopeQuery(claims, tt.query); errors.Cause(err) != ErrUnscopable {
+				t.Errorf("scopeQuery: got %v, want %v", err, ErrUnscopable)
+			}
+		})
+	}
+}
+
+func TestScopeClaims(t *testing.T) {
+	employee := auth.Claims{UserId: 7, Role: auth.RoleEmployee}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		scoped bool
+	}{
+		{name: "without claims", ctx: context.Background()},
+		{name: "admin", ctx: context.WithValue(context.Background(), auth.Key, auth.Claims{UserId: 1, Role: auth.RoleAdmin})},
+		{name: "employee", ctx: context.WithValue(context.Background(), auth.Key, employee), scoped: true},
+		{name: "API key of an employee", ctx: context.WithValue(context.Background(), auth.Key, auth.Claims{UserId: 7, Role: auth.RoleEmployee, APIKeyID: 3}), scoped: true},
+		{name: "unscoped", ctx: Unscoped(context.WithValue(context.Background(), auth.Key, employee))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, scoped := scopeClaims(tt.ctx); scoped != tt.scoped {
+				t.Errorf("scopeClaims: got %v, want %v", scoped, tt.scoped)
+			}
+		})
+	}
+}
+
+func TestScopeQueryQualifiesTables(t *testing.T) {
+	claims := auth.Claims{UserId: 7, Role: auth.RoleEmployee}
+
+	// the conditions must not read the CTEs, they are scoped again otherwise
+	for table, scope := range scopes {
+		for _, name := range scopedTables(lex(scope(claims, table+"."))) {
+			if name != table {
+				t.Errorf("scope of %s reads the unqualified table %s", table, name)
+			}
+		}
+	}
+}
+
+func TestScopeAPIKeys(t *testing.T) {
+	const query = `SELECT id FROM users`
+
+	tests := []struct {
+		name   string
+		claims auth.Claims
+		want   string
+	}{
+		{
+			name:   "key of an employee is scoped like its creator",
+			claims: auth.Claims{UserId: 7, Role: auth.RoleEmployee, APIKeyID: 3},
+			want:   "WITH users AS (SELECT * FROM public.users AS users WHERE " + staffScope(auth.Claims{UserId: 7}, "users.") + ") " + query,
+		},
+		{
+			name:   "key of a student is scoped like its creator",
+			claims: auth.Claims{UserId: 9, Role: auth.RoleStudent, APIKeyID: 4},
+			want:   "WITH users AS (SELECT * FROM public.users AS users WHERE " + staffScope(auth.Claims{UserId: 9}, "users.") + ") " + query,
+		},
+		{
+			name:   "key of an admin",
+			claims: auth.Claims{UserId: 1, Role: auth.RoleAdmin, APIKeyID: 5},
+			want:   query,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scopedConn{}.scope(context.WithValue(context.Background(), auth.Key, tt.claims), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("scope:\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"project/foundation/tracing"
+	"regexp"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxStatement is the longest statement recorded on a span.
+const maxStatement = 2048
+
+// literal matches the string literals bun puts the arguments of a query in.
+var literal = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// TracingHook starts a span for every query. The statement is recorded
+// without its string literals, they can hold passwords and tokens.
+type TracingHook struct{}
+
+func NewTracingHook() *TracingHook {
+	return &TracingHook{}
+}
+
+func (h *TracingHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	operation := event.Operation()
+
+	ctx, _ = tracing.Tracer().Start(ctx, "db "+strings.ToLower(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(operation)),
+	)
+
+	return ctx
+}
+
+func (h *TracingHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if !span.IsRecording() {
+		return
+	}
+
+	statement := literal.ReplaceAllString(event.Query, "'?'")
+	if len(statement) > maxStatement {
+		statement = statement[:maxStatement]
+	}
+	span.SetAttributes(semconv.DBStatement(statement))
+
+	if event.Err != nil && event.Err != sql.ErrNoRows {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+}
@@ -0,0 +1,440 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/pkg/repository/postgresql"
+	"project/internal/repository/postgres"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// keyPrefix starts every key, so leaked keys are easy to recognize.
+const keyPrefix = "ak"
+
+// lastUsedInterval is how often last_used_at of a key is written.
+const lastUsedInterval = time.Minute
+
+// ErrInvalidKey is returned for unknown, revoked and expired keys.
+var ErrInvalidKey = errors.New("invalid api key")
+
+type Repository struct {
+	*postgresql.Database
+}
+
+func NewRepository(database *postgresql.Database) *Repository {
+	return &Repository{Database: database}
+}
+
+// Authenticate returns the claims of the key. It is the auth.APIKeyValidator
+// of the service, so it does not check the claims of the context. The claims
+// hold the creator and the role the creator had, the rows of the key are
+// scoped like the ones of its creator.
+func (r Repository) Authenticate(ctx context.Context, key string) (auth.Claims, error) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != keyPrefix {
+		return auth.Claims{}, ErrInvalidKey
+	}
+
+	var (
+		id          int
+		keyHash     string
+		expiresAt   *time.Time
+		createdBy   *int
+		createdRole *string
+	)
+
+	err := r.QueryRowContext(ctx, `
+		SELECT id, key_hash, expires_at, created_by, created_role
+		FROM api_keys
+		WHERE prefix = ? AND deleted_at IS NULL
+	`, parts[1]).Scan(&id, &keyHash, &expiresAt, &createdBy, &createdRole)
+	if err == sql.ErrNoRows {
+		return auth.Claims{}, ErrInvalidKey
+	}
+	if err != nil {
+		return auth.Claims{}, errors.Wrap(err, "selecting api key")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(hash(parts[2]))) != 1 {
+		return auth.Claims{}, ErrInvalidKey
+	}
+
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return auth.Claims{}, ErrInvalidKey
+	}
+
+	permissions, err := r.getPermissions(ctx, id)
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	if _, err = r.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = now()
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)
+	`, id, time.Now().Add(-lastUsedInterval)); err != nil {
+		return auth.Claims{}, errors.Wrap(err, "updating api key last use")
+	}
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: fmt.Sprintf("api_key:%d", id),
+		},
+		Permissions: permissions,
+		APIKeyID:    id,
+	}
+	if createdBy != nil {
+		claims.UserId = *createdBy
+	}
+	if createdRole != nil {
+		claims.Role = *createdRole
+	}
+
+	return claims, nil
+}
+
+func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
+	_, err := r.CheckClaims(ctx, auth.PermAPIKeyManage)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	whereQuery := ` WHERE deleted_at IS NULL`
+
+	if filter.Search != nil {
+		search := strings.Replace(*filter.Search, "'", "", -1)
+		whereQuery += fmt.Sprintf(` AND name ilike '%s'`, "%"+search+"%")
+	}
+
+	var limitQuery, offsetQuery string
+
+	if filter.Page != nil && filter.Limit != nil {
+		offset := (*filter.Page - 1) * (*filter.Limit)
+		filter.Offset = &offset
+	}
+
+	if filter.Limit != nil {
+		limitQuery += fmt.Sprintf(" LIMIT %d", *filter.Limit)
+	}
+
+	if filter.Offset != nil {
+		offsetQuery += fmt.Sprintf(" OFFSET %d", *filter.Offset)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			id,
+			name,
+			prefix,
+			expires_at,
+			last_used_at,
+			created_at,
+			created_by
+		FROM api_keys
+		%s ORDER BY created_at desc %s %s
+	`, whereQuery, limitQuery, offsetQuery)
+
+	rows, err := r.QueryContext(ctx, query)
+	if err != nil {
+		return nil, 0, web.NewRequestError(errors.Wrap(err, "selecting api keys"), http.StatusBadRequest)
+	}
+	defer rows.Close()
+
+	list := make([]GetListResponse, 0)
+
+	for rows.Next() {
+		var detail GetListResponse
+		if err = rows.Scan(
+			&detail.ID,
+			&detail.Name,
+			&detail.Prefix,
+			&detail.ExpiresAt,
+			&detail.LastUsedAt,
+			&detail.CreatedAt,
+			&detail.CreatedBy); err != nil {
+			return nil, 0, web.NewRequestError(errors.Wrap(err, "scanning api keys"), http.StatusBadRequest)
+		}
+
+		list = append(list, detail)
+	}
+
+	for i := range list {
+		if list[i].Permissions, err = r.getPermissions(ctx, list[i].ID); err != nil {
+			return nil, 0, web.NewRequestError(err, http.StatusInternalServerError)
+		}
+	}
+
+	var count int
+	if err = r.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(id) FROM api_keys %s`, whereQuery)).Scan(&count); err != nil {
+		return nil, 0, web.NewRequestError(errors.Wrap(err, "selecting api key count"), http.StatusBadRequest)
+	}
+
+	return list, count, nil
+}
+
+func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdResponse, error) {
+	_, err := r.CheckClaims(ctx, auth.PermAPIKeyManage)
+	if err != nil {
+		return GetDetailByIdResponse{}, err
+	}
+
+	var detail GetDetailByIdResponse
+
+	err = r.QueryRowContext(ctx, `
+		SELECT
+			id,
+			name,
+			prefix,
+			expires_at,
+			last_used_at,
+			created_at,
+			created_by,
+			updated_at,
+			updated_by
+		FROM api_keys
+		WHERE deleted_at IS NULL AND id = ?
+	`, id).Scan(
+		&detail.ID,
+		&detail.Name,
+		&detail.Prefix,
+		&detail.ExpiresAt,
+		&detail.LastUsedAt,
+		&detail.CreatedAt,
+		&detail.CreatedBy,
+		&detail.UpdatedAt,
+		&detail.UpdatedBy,
+	)
+	if err == sql.ErrNoRows {
+		return GetDetailByIdResponse{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+	if err != nil {
+		return GetDetailByIdResponse{}, web.NewRequestError(errors.Wrap(err, "selecting api key detail"), http.StatusBadRequest)
+	}
+
+	if detail.Permissions, err = r.getPermissions(ctx, id); err != nil {
+		return GetDetailByIdResponse{}, web.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	return detail, nil
+}
+
+// Create creates a key with the permissions. The key is in the response only,
+// the permissions can not exceed the ones of the creator.
+func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateResponse, error) {
+	claims, err := r.CheckClaims(ctx, auth.PermAPIKeyManage)
+	if err != nil {
+		return CreateResponse{}, err
+	}
+
+	if err := r.ValidateStruct(&request, "Name", "Permissions"); err != nil {
+		return CreateResponse{}, err
+	}
+
+	if err = r.checkPermissions(ctx, claims, request.Permissions); err != nil {
+		return CreateResponse{}, err
+	}
+
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		return CreateResponse{}, web.NewRequestError(errors.New("expires_at must be in the future"), http.StatusBadRequest)
+	}
+
+	prefix, err := random(6)
+	if err != nil {
+		return CreateResponse{}, web.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	secret, err := random(32)
+	if err != nil {
+		return CreateResponse{}, web.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	response := CreateResponse{
+		Name:           *request.Name,
+		Prefix:         prefix,
+		KeyHash:        hash(secret),
+		Permissions:    request.Permissions,
+		ExpiresAt:      request.ExpiresAt,
+		CreatedAt:      time.Now(),
+		CreatedBy:      claims.UserId,
+		CreatedRole:    claims.Role,
+		CreatedByActor: claims.Actor(),
+		Key:            fmt.Sprintf("%s_%s_%s", keyPrefix, prefix, secret),
+	}
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.NewInsert().Model(&response).Returning("id").Exec(ctx, &response.ID); err != nil {
+		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "creating api key"), http.StatusBadRequest)
+	}
+
+	if err = setPermissions(ctx, tx, response.ID, request.Permissions); err != nil {
+		return CreateResponse{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "committing api key"), http.StatusInternalServerError)
+	}
+
+	return response, nil
+}
+
+func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) error {
+	claims, err := r.CheckClaims(ctx, auth.PermAPIKeyManage)
+	if err != nil {
+		return err
+	}
+
+	if err := r.ValidateStruct(&request, "ID"); err != nil {
+		return err
+	}
+
+	if request.Permissions != nil {
+		if err = r.checkPermissions(ctx, claims, request.Permissions); err != nil {
+			return err
+		}
+	}
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	q := tx.NewUpdate().Table("api_keys").Where("deleted_at IS NULL AND id = ?", request.ID)
+
+	if request.Name != nil {
+		q.Set("name = ?", request.Name)
+	}
+	if request.ExpiresAt != nil {
+		q.Set("expires_at = ?", request.ExpiresAt)
+	}
+	q.Set("updated_at = ?", time.Now())
+	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
+
+	result, err := q.Exec(ctx)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "updating api key"), http.StatusBadRequest)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	if request.Permissions != nil {
+		if err = setPermissions(ctx, tx, request.ID, request.Permissions); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "committing api key"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// Delete revokes the key.
+func (r Repository) Delete(ctx context.Context, id int) error {
+	return r.DeleteRow(ctx, "api_keys", id, auth.PermAPIKeyManage)
+}
+
+func (r Repository) getPermissions(ctx context.Context, id int) ([]string, error) {
+	rows, err := r.QueryContext(ctx, `
+		SELECT
+			p.code
+		FROM api_key_permissions AS akp
+		JOIN permissions AS p ON p.id = akp.permission_id
+		WHERE akp.api_key_id = ?
+		ORDER BY p.code
+	`, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "selecting api key permissions")
+	}
+	defer rows.Close()
+
+	list := make([]string, 0)
+
+	for rows.Next() {
+		var code string
+		if err = rows.Scan(&code); err != nil {
+			return nil, errors.Wrap(err, "scanning api key permissions")
+		}
+
+		list = append(list, code)
+	}
+
+	return list, nil
+}
+
+// checkPermissions checks that the permissions exist and that the creator of
+// the key holds them.
+func (r Repository) checkPermissions(ctx context.Context, claims auth.Claims, permissions []string) error {
+	if len(permissions) == 0 {
+		return web.NewRequestError(errors.New("at least one permission is required"), http.StatusBadRequest)
+	}
+
+	if !claims.Authorized(permissions...) {
+		return web.NewRequestError(errors.New("a key can not get permissions its creator does not have"), http.StatusForbidden)
+	}
+
+	var count int
+	if err := r.QueryRowContext(ctx, `SELECT count(DISTINCT code) FROM permissions WHERE code IN (?)`, bun.In(permissions)).Scan(&count); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "checking permissions"), http.StatusInternalServerError)
+	}
+
+	distinct := make(map[string]struct{}, len(permissions))
+	for _, p := range permissions {
+		distinct[p] = struct{}{}
+	}
+
+	if count != len(distinct) {
+		return web.NewRequestError(errors.New("unknown permission"), http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func setPermissions(ctx context.Context, tx bun.Tx, id int, permissions []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM api_key_permissions WHERE api_key_id = ?`, id); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting api key permissions"), http.StatusInternalServerError)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO api_key_permissions (api_key_id, permission_id)
+		SELECT ?, id FROM permissions WHERE code IN (?)
+	`, id, bun.In(permissions)); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "creating api key permissions"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func random(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating api key")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
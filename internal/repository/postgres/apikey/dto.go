@@ -0,0 +1,69 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type Filter struct {
+	Limit  *int
+	Offset *int
+	Page   *int
+	Search *string
+}
+
+type GetListResponse struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   *time.Time `json:"created_at"`
+	CreatedBy   *int       `json:"created_by"`
+}
+
+type GetDetailByIdResponse struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   *time.Time `json:"created_at"`
+	CreatedBy   *int       `json:"created_by"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	UpdatedBy   *int       `json:"updated_by"`
+}
+
+type CreateRequest struct {
+	Name        *string    `json:"name" form:"name"`
+	Permissions []string   `json:"permissions" form:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at" form:"expires_at"`
+}
+
+type CreateResponse struct {
+	bun.BaseModel `bun:"table:api_keys"`
+
+	ID             int        `json:"id"          bun:"-"`
+	Name           string     `json:"name"        bun:"name"`
+	Prefix         string     `json:"prefix"      bun:"prefix"`
+	KeyHash        string     `json:"-"           bun:"key_hash"`
+	Permissions    []string   `json:"permissions" bun:"-"`
+	ExpiresAt      *time.Time `json:"expires_at"  bun:"expires_at"`
+	CreatedAt      time.Time  `json:"-"           bun:"created_at"`
+	CreatedBy      int        `json:"-"           bun:"created_by"`
+	CreatedRole    string     `json:"-"           bun:"created_role"`
+	CreatedByActor *int       `json:"-" bun:"created_by_actor"`
+
+	// Key is returned only once, just its hash is stored.
+	Key string `json:"key" bun:"-"`
+}
+
+type UpdateRequest struct {
+	ID          int        `json:"id" form:"id"`
+	Name        *string    `json:"name" form:"name"`
+	Permissions []string   `json:"permissions" form:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at" form:"expires_at"`
+}
@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/pkg/repository/postgresql"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type Repository struct {
+	*postgresql.Database
+}
+
+func NewRepository(database *postgresql.Database) *Repository {
+	return &Repository{Database: database}
+}
+
+// GetList returns the writes made under impersonation, newest first.
+func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
+	_, err := r.CheckClaims(ctx, auth.PermAuditRead)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	whereQuery := ` WHERE TRUE`
+
+	if filter.ActorID != nil {
+		whereQuery += fmt.Sprintf(` AND actor_id = %d`, *filter.ActorID)
+	}
+
+	if filter.UserID != nil {
+		whereQuery += fmt.Sprintf(` AND user_id = %d`, *filter.UserID)
+	}
+
+	var limitQuery, offsetQuery string
+
+	if filter.Page != nil && filter.Limit != nil {
+		offset := (*filter.Page - 1) * (*filter.Limit)
+		filter.Offset = &offset
+	}
+
+	if filter.Limit != nil {
+		limitQuery += fmt.Sprintf(" LIMIT %d", *filter.Limit)
+	}
+
+	if filter.Offset != nil {
+		offsetQuery += fmt.Sprintf(" OFFSET %d", *filter.Offset)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			id,
+			actor_id,
+			user_id,
+			operation,
+			table_name,
+			record_id,
+			changed_columns,
+			created_at
+		FROM audit_log
+		%s ORDER BY id desc %s %s
+	`, whereQuery, limitQuery, offsetQuery)
+
+	rows, err := r.QueryContext(ctx, query)
+	if err != nil {
+		return nil, 0, web.NewRequestError(errors.Wrap(err, "selecting audit log"), http.StatusBadRequest)
+	}
+	defer rows.Close()
+
+	list := make([]GetListResponse, 0)
+
+	for rows.Next() {
+		var detail GetListResponse
+		if err = rows.Scan(
+			&detail.ID,
+			&detail.ActorID,
+			&detail.UserID,
+			&detail.Operation,
+			&detail.Table,
+			&detail.RecordID,
+			pgdialect.Array(&detail.ChangedColumns),
+			&detail.CreatedAt); err != nil {
+			return nil, 0, web.NewRequestError(errors.Wrap(err, "scanning audit log"), http.StatusBadRequest)
+		}
+
+		list = append(list, detail)
+	}
+
+	var count int
+	if err = r.QueryRowContext(ctx, fmt.Sprintf(`SELECT count(id) FROM audit_log %s`, whereQuery)).Scan(&count); err != nil {
+		return nil, 0, web.NewRequestError(errors.Wrap(err, "selecting audit log count"), http.StatusBadRequest)
+	}
+
+	return list, count, nil
+}
@@ -0,0 +1,25 @@
+package audit
+
+import "time"
+
+type Filter struct {
+	Limit   *int
+	Offset  *int
+	Page    *int
+	ActorID *int
+	UserID  *int
+}
+
+type GetListResponse struct {
+	ID        int    `json:"id"`
+	ActorID   int    `json:"actor_id"`
+	UserID    int    `json:"user_id"`
+	Operation string `json:"operation"`
+	Table     string `json:"table"`
+	// RecordID is the id of the changed row, it is not known for inserts.
+	RecordID *int64 `json:"record_id"`
+	// ChangedColumns are the names of the columns the statement set, their
+	// values are not logged.
+	ChangedColumns []string   `json:"changed_columns"`
+	CreatedAt      *time.Time `json:"created_at"`
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"project/foundation/web"
+	"project/internal/auth"
 	"project/internal/entity"
 	"project/internal/pkg/repository/postgresql"
 	"project/internal/repository/postgres"
@@ -32,7 +33,7 @@ func (r Repository) GetById(ctx context.Context, id int) (entity.Department, err
 }
 
 func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermDepartmentRead)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -96,9 +97,8 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 				count(id)
 			FROM
 			 department
-			 WHERE deleted_at IS NULL
-
-		`)
+			 %s
+		`, whereQuery)
 
 	countRows, err := r.QueryContext(ctx, countQuery)
 	if err == sql.ErrNoRows {
@@ -120,7 +120,7 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 }
 
 func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdResponse, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermDepartmentRead)
 	if err != nil {
 		return GetDetailByIdResponse{}, err
 	}
@@ -158,7 +158,7 @@ func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdRes
 }
 
 func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateResponse, error) {
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermDepartmentCreate)
 	if err != nil {
 		return CreateResponse{}, err
 	}
@@ -171,12 +171,33 @@ func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateRe
 	response.Name = request.Name
 	response.CreatedAt = time.Now()
 	response.CreatedBy = claims.UserId
+	response.CreatedByActor = claims.Actor()
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
 
-	_, err = r.NewInsert().Model(&response).Returning("id").Exec(ctx, &response.ID)
+	_, err = tx.NewInsert().Model(&response).Returning("id").Exec(ctx, &response.ID)
 	if err != nil {
 		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "creating department"), http.StatusBadRequest)
 	}
 
+	// the scope of the creator only holds the departments it is assigned to,
+	// admins see every department
+	if claims.Role != auth.RoleAdmin {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO user_departments (user_id, department_id, is_head) VALUES (?, ?, false)
+		`, claims.UserId, response.ID); err != nil {
+			return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "assigning department creator"), http.StatusInternalServerError)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "committing department"), http.StatusInternalServerError)
+	}
+
 	return response, nil
 }
 
@@ -185,7 +206,7 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 		return err
 	}
 
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermDepartmentUpdate)
 	if err != nil {
 		return err
 	}
@@ -193,12 +214,17 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 	q.Set("name =?", request.Name)
 	q.Set("updated_at=?", time.Now())
 	q.Set("updated_by=?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
-	_, err = q.Exec(ctx)
+	result, err := q.Exec(ctx)
 	if err != nil {
 		return web.NewRequestError(errors.Wrap(err, "updating department"), http.StatusBadRequest)
 	}
 
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
 	return nil
 }
 
@@ -207,7 +233,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 		return err
 	}
 
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermDepartmentUpdate)
 	if err != nil {
 		return err
 	}
@@ -219,15 +245,20 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 	}
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
-	_, err = q.Exec(ctx)
+	result, err := q.Exec(ctx)
 	if err != nil {
 		return web.NewRequestError(errors.Wrap(err, "updating department"), http.StatusBadRequest)
 	}
 
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
 	return nil
 }
 
 func (r Repository) Delete(ctx context.Context, id int) error {
-	return r.DeleteRow(ctx, "department", id)
+	return r.DeleteRow(ctx, "department", id, auth.PermDepartmentDelete)
 }
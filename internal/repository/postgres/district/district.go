@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"project/foundation/web"
+	"project/internal/auth"
 	"project/internal/entity"
 	"project/internal/pkg/repository/postgresql"
 	"project/internal/repository/postgres"
@@ -32,7 +33,7 @@ func (r Repository) GetById(ctx context.Context, id int) (entity.District, error
 }
 
 func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermDistrictRead)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -165,7 +166,7 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 }
 
 func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdResponse, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermDistrictRead)
 	if err != nil {
 		return GetDetailByIdResponse{}, err
 	}
@@ -214,7 +215,7 @@ func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdRes
 }
 
 func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateResponse, error) {
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermDistrictCreate)
 	if err != nil {
 		return CreateResponse{}, err
 	}
@@ -228,6 +229,7 @@ func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateRe
 	response.RegionID = request.RegionID
 	response.CreatedAt = time.Now()
 	response.CreatedBy = claims.UserId
+	response.CreatedByActor = claims.Actor()
 
 	_, err = r.NewInsert().Model(&response).Returning("id").Exec(ctx, &response.ID)
 	if err != nil {
@@ -243,7 +245,7 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 		return err
 	}
 
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermDistrictUpdate)
 	if err != nil {
 		return err
 	}
@@ -254,6 +256,7 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 	q.Set("region_id = ?", request.RegionID)
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
 	_, err = q.Exec(ctx)
 	if err != nil {
@@ -267,7 +270,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 	if err := r.ValidateStruct(&request, "ID"); err != nil {
 		return err
 	}
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermDistrictUpdate)
 	if err != nil {
 		return err
 	}
@@ -281,6 +284,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 	}
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
 	_, err = q.Exec(ctx)
 	if err != nil {
@@ -293,5 +297,5 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 
 
 func (r Repository) Delete(ctx context.Context, id int) error {
-	return r.DeleteRow(ctx, "region", id)
+	return r.DeleteRow(ctx, "district", id, auth.PermDistrictDelete)
 }
@@ -22,8 +22,6 @@ type GetListResponse struct {
 	NameLanguages []string `json:"name_languages"`
 }
 
-
-
 type GetDetailByIdResponse struct {
 	ID       int               `json:"id"`
 	Name     map[string]string `json:"name"`
@@ -41,10 +39,11 @@ type CreateResponse struct {
 
 	ID int `json:"id" bun:"-"`
 
-	Name      map[string]string `json:"name"       bun:"name"`
-	RegionID  *int              `json:"region_id" bun:"region_id"`
-	CreatedAt time.Time         `json:"-"          bun:"created_at"`
-	CreatedBy int               `json:"-"          bun:"created_by"`
+	Name           map[string]string `json:"name"       bun:"name"`
+	RegionID       *int              `json:"region_id" bun:"region_id"`
+	CreatedAt      time.Time         `json:"-"          bun:"created_at"`
+	CreatedBy      int               `json:"-"          bun:"created_by"`
+	CreatedByActor *int              `json:"-" bun:"created_by_actor"`
 }
 
 type UpdateRequest struct {
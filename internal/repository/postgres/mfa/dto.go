@@ -0,0 +1,11 @@
+package mfa
+
+type SetPolicyRequest struct {
+	Role     string `json:"role"     form:"role"`
+	Required *bool  `json:"required" form:"required"`
+}
+
+type CodeRequest struct {
+	Code         string `json:"code"          form:"code"`
+	RecoveryCode string `json:"recovery_code" form:"recovery_code"`
+}
@@ -0,0 +1,258 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/entity"
+	"project/internal/pkg/repository/postgresql"
+	"project/internal/repository/postgres"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// Repository stores the TOTP secrets and recovery codes of users. The methods
+// used by the user itself do not check the claims of the context, the callers
+// pass the id of the user from the claims.
+type Repository struct {
+	*postgresql.Database
+}
+
+func NewRepository(database *postgresql.Database) *Repository {
+	return &Repository{Database: database}
+}
+
+// Get returns the two-factor settings of the user.
+func (r Repository) Get(ctx context.Context, userID int) (entity.UserMFA, error) {
+	var detail entity.UserMFA
+
+	err := r.NewSelect().Model(&detail).Where("user_id = ?", userID).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return entity.UserMFA{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+	if err != nil {
+		return entity.UserMFA{}, web.NewRequestError(errors.Wrap(err, "selecting user mfa"), http.StatusInternalServerError)
+	}
+
+	return detail, nil
+}
+
+// SetSecret stores a new secret that is not enabled until Enable. The secret
+// of an enabled user is not replaced.
+func (r Repository) SetSecret(ctx context.Context, userID int, secret string) error {
+	result, err := r.ExecContext(ctx, `
+		INSERT INTO user_mfa (user_id, secret, enabled)
+		VALUES (?, ?, false)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret
+		WHERE user_mfa.enabled = false
+	`, userID, secret)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "storing mfa secret"), http.StatusInternalServerError)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return web.NewRequestError(errors.New("two-factor authentication is already enabled"), http.StatusConflict)
+	}
+
+	return nil
+}
+
+// Enable enables the stored secret of the user and replaces the recovery
+// codes with the hashes.
+func (r Repository) Enable(ctx context.Context, userID int, recoveryHashes []string) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_mfa SET enabled = true, enabled_at = now()
+		WHERE user_id = ? AND enabled = false
+	`, userID)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "enabling mfa"), http.StatusInternalServerError)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return web.NewRequestError(errors.New("two-factor authentication is already enabled"), http.StatusConflict)
+	}
+
+	if err = setRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "committing mfa"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// SetRecoveryCodes replaces the recovery codes of the user with the hashes.
+func (r Repository) SetRecoveryCodes(ctx context.Context, userID int, recoveryHashes []string) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	if err = setRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "committing recovery codes"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the recovery code with the hash as used. A code can be
+// used once.
+func (r Repository) UseRecoveryCode(ctx context.Context, userID int, recoveryHash string) error {
+	result, err := r.ExecContext(ctx, `
+		UPDATE user_recovery_codes SET used_at = now()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userID, recoveryHash)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "using recovery code"), http.StatusInternalServerError)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return web.NewRequestError(errors.New("incorrect recovery code"), http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// UseStep marks the time step of a code as used. It returns false when the
+// step or a later one was used already.
+func (r Repository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	result, err := r.ExecContext(ctx, `
+		UPDATE user_mfa SET last_step = ?
+		WHERE user_id = ? AND (last_step IS NULL OR last_step < ?)
+	`, step, userID, step)
+	if err != nil {
+		return false, web.NewRequestError(errors.Wrap(err, "using mfa code"), http.StatusInternalServerError)
+	}
+
+	n, _ := result.RowsAffected()
+
+	return n > 0, nil
+}
+
+// Disable removes the secret and the recovery codes of the user.
+func (r Repository) Disable(ctx context.Context, userID int) error {
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting recovery codes"), http.StatusInternalServerError)
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = ?`, userID); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting user mfa"), http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "committing mfa"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// Reset disables two-factor authentication of a user that lost the device
+// and the recovery codes.
+func (r Repository) Reset(ctx context.Context, userID int) error {
+	_, err := r.CheckClaims(ctx, auth.PermMFAManage)
+	if err != nil {
+		return err
+	}
+
+	return r.Disable(ctx, userID)
+}
+
+// IsRequired reports whether two-factor authentication is mandatory for the
+// role.
+func (r Repository) IsRequired(ctx context.Context, role string) (bool, error) {
+	var required bool
+
+	err := r.QueryRowContext(ctx, `SELECT required FROM mfa_policies WHERE role = ?`, strings.ToUpper(role)).Scan(&required)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, web.NewRequestError(errors.Wrap(err, "selecting mfa policy"), http.StatusInternalServerError)
+	}
+
+	return required, nil
+}
+
+// GetPolicies returns the policy of every role.
+func (r Repository) GetPolicies(ctx context.Context) ([]entity.MFAPolicy, error) {
+	_, err := r.CheckClaims(ctx, auth.PermMFAManage)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]entity.MFAPolicy, 0)
+
+	for _, role := range []string{auth.RoleAdmin, auth.RoleEmployee, auth.RoleStudent} {
+		required, err := r.IsRequired(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, entity.MFAPolicy{Role: role, Required: required})
+	}
+
+	return list, nil
+}
+
+// SetPolicy makes two-factor authentication mandatory or optional for the
+// role. Users of the role that did not enroll are asked to at the next
+// sign-in.
+func (r Repository) SetPolicy(ctx context.Context, request SetPolicyRequest) error {
+	_, err := r.CheckClaims(ctx, auth.PermMFAManage)
+	if err != nil {
+		return err
+	}
+
+	role := strings.ToUpper(request.Role)
+	if !auth.ValidRole(role) {
+		return web.NewRequestError(errors.New("incorrect role. role should be ADMIN, EMPLOYEE or STUDENT"), http.StatusBadRequest)
+	}
+
+	if _, err = r.ExecContext(ctx, `
+		INSERT INTO mfa_policies (role, required) VALUES (?, ?)
+		ON CONFLICT (role) DO UPDATE SET required = EXCLUDED.required
+	`, role, *request.Required); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "storing mfa policy"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func setRecoveryCodes(ctx context.Context, tx bun.Tx, userID int, recoveryHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting recovery codes"), http.StatusInternalServerError)
+	}
+
+	for _, hash := range recoveryHashes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)
+		`, userID, hash); err != nil {
+			return web.NewRequestError(errors.Wrap(err, "creating recovery codes"), http.StatusInternalServerError)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+package permission
+
+type GetListResponse struct {
+	ID          int     `json:"id"`
+	Code        string  `json:"code"`
+	Description *string `json:"description"`
+}
+
+type SetRolePermissionsRequest struct {
+	Role        string   `json:"-" form:"-"`
+	Permissions []string `json:"permissions" form:"permissions"`
+}
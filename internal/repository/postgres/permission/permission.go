@@ -0,0 +1,176 @@
+package permission
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/pkg/repository/postgresql"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	*postgresql.Database
+}
+
+func NewRepository(database *postgresql.Database) *Repository {
+	return &Repository{Database: database}
+}
+
+// GetByRole returns the permission codes granted to the role. It is used while
+// issuing tokens, so it does not check the claims of the context.
+func (r Repository) GetByRole(ctx context.Context, role string) ([]string, error) {
+	rows, err := r.QueryContext(ctx, `
+		SELECT
+			p.code
+		FROM role_permissions AS rp
+		JOIN permissions AS p ON p.id = rp.permission_id
+		WHERE rp.role = ?
+		ORDER BY p.code
+	`, strings.ToUpper(role))
+	if err != nil {
+		return nil, web.NewRequestError(errors.Wrap(err, "selecting role permissions"), http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	list := make([]string, 0)
+
+	for rows.Next() {
+		var code string
+		if err = rows.Scan(&code); err != nil {
+			return nil, web.NewRequestError(errors.Wrap(err, "scanning role permissions"), http.StatusInternalServerError)
+		}
+
+		list = append(list, code)
+	}
+
+	return list, nil
+}
+
+func (r Repository) GetList(ctx context.Context) ([]GetListResponse, error) {
+	_, err := r.CheckClaims(ctx, auth.PermPermissionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.QueryContext(ctx, `
+		SELECT
+			id,
+			code,
+			description
+		FROM permissions
+		ORDER BY code
+	`)
+	if err != nil {
+		return nil, web.NewRequestError(errors.Wrap(err, "selecting permissions"), http.StatusBadRequest)
+	}
+	defer rows.Close()
+
+	list := make([]GetListResponse, 0)
+
+	for rows.Next() {
+		var detail GetListResponse
+		if err = rows.Scan(&detail.ID, &detail.Code, &detail.Description); err != nil {
+			return nil, web.NewRequestError(errors.Wrap(err, "scanning permissions"), http.StatusBadRequest)
+		}
+
+		list = append(list, detail)
+	}
+
+	return list, nil
+}
+
+func (r Repository) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	_, err := r.CheckClaims(ctx, auth.PermPermissionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	role = strings.ToUpper(role)
+	if !auth.ValidRole(role) {
+		return nil, web.NewRequestError(errors.New("incorrect role. role should be ADMIN, EMPLOYEE or STUDENT"), http.StatusBadRequest)
+	}
+
+	return r.GetByRole(ctx, role)
+}
+
+// SetRolePermissions replaces the permissions granted to the role. Tokens that
+// are already issued keep their permissions until they are refreshed.
+func (r Repository) SetRolePermissions(ctx context.Context, request SetRolePermissionsRequest) error {
+	_, err := r.CheckClaims(ctx, auth.PermPermissionManage)
+	if err != nil {
+		return err
+	}
+
+	role := strings.ToUpper(request.Role)
+	if !auth.ValidRole(role) {
+		return web.NewRequestError(errors.New("incorrect role. role should be ADMIN, EMPLOYEE or STUDENT"), http.StatusBadRequest)
+	}
+
+	if role == auth.RoleAdmin {
+		for _, p := range []string{auth.PermPermissionManage} {
+			if !contains(request.Permissions, p) {
+				return web.NewRequestError(errors.Errorf("permission %s can not be taken from %s", p, auth.RoleAdmin), http.StatusBadRequest)
+			}
+		}
+	}
+
+	if len(request.Permissions) > 0 {
+		var count int
+		if err = r.QueryRowContext(ctx, `SELECT count(id) FROM permissions WHERE code IN (?)`, bun.In(request.Permissions)).Scan(&count); err != nil {
+			return web.NewRequestError(errors.Wrap(err, "checking permissions"), http.StatusInternalServerError)
+		}
+		if count != len(unique(request.Permissions)) {
+			return web.NewRequestError(errors.New("unknown permission"), http.StatusBadRequest)
+		}
+	}
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = ?`, role); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting role permissions"), http.StatusBadRequest)
+	}
+
+	if len(request.Permissions) > 0 {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (role, permission_id)
+			SELECT ?, id FROM permissions WHERE code IN (?)
+		`, role, bun.In(request.Permissions)); err != nil {
+			return web.NewRequestError(errors.Wrap(err, "creating role permissions"), http.StatusBadRequest)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "committing role permissions"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func unique(list []string) []string {
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		if !contains(result, v) {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
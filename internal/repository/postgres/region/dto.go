@@ -40,10 +40,11 @@ type CreateResponse struct {
 
 	ID int `json:"id" bun:"-"`
 
-	Name       map[string]string `json:"name"       bun:"name"`
-	RepublicID *int              `json:"republic_id" bun:"republic_id"`
-	CreatedAt  time.Time         `json:"-"          bun:"created_at"`
-	CreatedBy  int               `json:"-"          bun:"created_by"`
+	Name           map[string]string `json:"name"       bun:"name"`
+	RepublicID     *int              `json:"republic_id" bun:"republic_id"`
+	CreatedAt      time.Time         `json:"-"          bun:"created_at"`
+	CreatedBy      int               `json:"-"          bun:"created_by"`
+	CreatedByActor *int              `json:"-" bun:"created_by_actor"`
 }
 
 type UpdateRequest struct {
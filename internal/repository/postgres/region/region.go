@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"project/foundation/web"
+	"project/internal/auth"
 	"project/internal/entity"
 	"project/internal/pkg/repository/postgresql"
 	"project/internal/repository/postgres"
@@ -33,7 +34,7 @@ func (r Repository) GetById(ctx context.Context, id int) (entity.Region, error)
 }
 
 func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermRegionRead)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -168,7 +169,7 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 }
 
 func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdResponse, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermRegionRead)
 	if err != nil {
 		return GetDetailByIdResponse{}, err
 	}
@@ -218,7 +219,7 @@ func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdRes
 }
 
 func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateResponse, error) {
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermRegionCreate)
 	if err != nil {
 		return CreateResponse{}, err
 	}
@@ -233,6 +234,7 @@ func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateRe
 	response.RepublicID = request.RepublicID
 	response.CreatedAt = time.Now()
 	response.CreatedBy = claims.UserId
+	response.CreatedByActor = claims.Actor()
 
 	_, err = r.NewInsert().Model(&response).Returning("id").Exec(ctx, &response.ID)
 	if err != nil {
@@ -247,7 +249,7 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 		return err
 	}
 
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermRegionUpdate)
 	if err != nil {
 		return err
 	}
@@ -258,6 +260,7 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 	q.Set("republic_id = ?", request.RepublicID)
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
 	_, err = q.Exec(ctx)
 	if err != nil {
@@ -272,7 +275,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 		return err
 	}
 
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermRegionUpdate)
 	if err != nil {
 		return err
 	}
@@ -288,6 +291,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 	}
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
 	_, err = q.Exec(ctx)
 	if err != nil {
@@ -299,5 +303,5 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 
 
 func (r Repository) Delete(ctx context.Context, id int) error {
-	return r.DeleteRow(ctx, "region", id)
+	return r.DeleteRow(ctx, "region", id, auth.PermRegionDelete)
 }
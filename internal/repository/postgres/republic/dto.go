@@ -30,10 +30,11 @@ type CreateRequest struct {
 type CreateResponse struct {
 	bun.BaseModel `bun:"table:republic"`
 
-	ID int `json:"id" bun:"-"`
-	Name      map[string]string `json:"name"       bun:"name"`
-	CreatedAt time.Time         `json:"-"          bun:"created_at"`
-	CreatedBy int               `json:"-"          bun:"created_by"`
+	ID             int               `json:"id" bun:"-"`
+	Name           map[string]string `json:"name"       bun:"name"`
+	CreatedAt      time.Time         `json:"-"          bun:"created_at"`
+	CreatedBy      int               `json:"-"          bun:"created_by"`
+	CreatedByActor *int              `json:"-" bun:"created_by_actor"`
 }
 
 type UpdateRequest struct {
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"project/foundation/web"
+	"project/internal/auth"
 	"project/internal/entity"
 	"project/internal/pkg/repository/postgresql"
 	"project/internal/repository/postgres"
@@ -32,7 +33,7 @@ func (r Repository) GetById(ctx context.Context, id int) (entity.Republic, error
 }
 
 func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermRepublicRead)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -115,7 +116,7 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 }
 
 func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdResponse, error) {
-	_, err := r.CheckClaims(ctx)
+	_, err := r.CheckClaims(ctx, auth.PermRepublicRead)
 	if err != nil {
 		return GetDetailByIdResponse{}, err
 	}
@@ -154,7 +155,7 @@ func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdRes
 }
 
 func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateResponse, error) {
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermRepublicCreate)
 	if err != nil {
 		return CreateResponse{}, err
 	}
@@ -168,6 +169,7 @@ func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateRe
 	response.Name = request.Name
 	response.CreatedAt = time.Now()
 	response.CreatedBy = claims.UserId
+	response.CreatedByActor = claims.Actor()
 
 	_, err = r.NewInsert().Model(&response).Returning("id").Exec(ctx, &response.ID)
 	if err != nil {
@@ -182,7 +184,7 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 		return err
 	}
 
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermRepublicUpdate)
 	if err != nil {
 		return err
 	}
@@ -192,6 +194,7 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 	q.Set("name = ?", request.Name)
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
 	_, err = q.Exec(ctx)
 	if err != nil {
@@ -206,7 +209,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 		return err
 	}
 
-	claims, err := r.CheckClaims(ctx)
+	claims, err := r.CheckClaims(ctx, auth.PermRepublicUpdate)
 	if err != nil {
 		return err
 	}
@@ -218,6 +221,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 	}
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
 	_, err = q.Exec(ctx)
 	if err != nil {
@@ -228,5 +232,5 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 }
 
 func (r Repository) Delete(ctx context.Context, id int) error {
-	return r.DeleteRow(ctx, "republic", id)
+	return r.DeleteRow(ctx, "republic", id, auth.PermRepublicDelete)
 }
@@ -0,0 +1,70 @@
+package signin
+
+import "time"
+
+type CreateRequest struct {
+	UserID    *int
+	Username  string
+	IP        string
+	UserAgent string
+	Event     string
+	Result    string
+}
+
+type Filter struct {
+	Limit  *int
+	Offset *int
+	Page   *int
+	UserID *int
+	Result *string
+}
+
+type ReportFilter struct {
+	// Hours is how far back the report looks.
+	Hours *int
+
+	// Threshold is how many failures make a username or an IP suspicious.
+	Threshold *int
+}
+
+type GetListResponse struct {
+	ID        int        `json:"id"`
+	UserID    *int       `json:"user_id"`
+	Username  *string    `json:"username"`
+	IP        *string    `json:"ip"`
+	UserAgent *string    `json:"user_agent"`
+	Event     string     `json:"event"`
+	Result    string     `json:"result"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+type FailedUsername struct {
+	Username string     `json:"username"`
+	UserID   *int       `json:"user_id"`
+	Failures int        `json:"failures"`
+	IPs      int        `json:"ips"`
+	LastAt   *time.Time `json:"last_at"`
+}
+
+type FailedIP struct {
+	IP        string     `json:"ip"`
+	Failures  int        `json:"failures"`
+	Usernames int        `json:"usernames"`
+	LastAt    *time.Time `json:"last_at"`
+}
+
+type NewIPRange struct {
+	UserID    int        `json:"user_id"`
+	Username  *string    `json:"username"`
+	IP        string     `json:"ip"`
+	IPRange   string     `json:"ip_range"`
+	UserAgent *string    `json:"user_agent"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+type ReportResponse struct {
+	Since           time.Time        `json:"since"`
+	FailedUsernames []FailedUsername `json:"failed_usernames"`
+	FailedIPs       []FailedIP       `json:"failed_ips"`
+	NewIPRanges     []NewIPRange     `json:"new_ip_ranges"`
+}
@@ -0,0 +1,284 @@
+package signin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/pkg/repository/postgresql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// These are the recorded steps of signing in.
+const (
+	EventSignIn         = "sign_in"
+	EventMFA            = "mfa"
+	EventPasswordChange = "password_change"
+	EventRefresh        = "refresh"
+	EventOIDC           = "oidc"
+)
+
+// These are the results of a recorded attempt.
+const (
+	ResultSuccess                = "success"
+	ResultFailed                 = "failed"
+	ResultLocked                 = "locked"
+	ResultMFARequired            = "mfa_required"
+	ResultPasswordChangeRequired = "password_change_required"
+	ResultInactive               = "inactive"
+)
+
+const (
+	// DefaultReportHours is how far back the report looks by default.
+	DefaultReportHours = 24
+
+	// DefaultReportThreshold is how many failures make a username or an IP
+	// suspicious by default.
+	DefaultReportThreshold = 5
+)
+
+type Repository struct {
+	*postgresql.Database
+}
+
+func NewRepository(database *postgresql.Database) *Repository {
+	return &Repository{Database: database}
+}
+
+// Create records an attempt. It is called while signing in, so it does not
+// check the claims of the context.
+func (r Repository) Create(ctx context.Context, request CreateRequest) error {
+	_, err := r.ExecContext(ctx, `
+		INSERT INTO sign_in_history (user_id, username, ip, ip_range, user_agent, event, result)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?)
+	`, request.UserID, request.Username, request.IP, ipRange(request.IP), request.UserAgent, request.Event, request.Result)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "inserting sign-in history"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// GetList returns the attempts of the users in the scope of the claims,
+// newest first.
+func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
+	_, err := r.CheckClaims(ctx, auth.PermSignInRead)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return r.getList(ctx, filter)
+}
+
+// GetMyList returns the attempts of the current user, newest first.
+func (r Repository) GetMyList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
+	claims, err := r.CheckClaims(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter.UserID = &claims.UserId
+
+	return r.getList(ctx, filter)
+}
+
+func (r Repository) getList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
+	whereQuery := ` WHERE TRUE`
+
+	if filter.UserID != nil {
+		whereQuery += fmt.Sprintf(` AND h.user_id = %d`, *filter.UserID)
+	}
+
+	if filter.Result != nil {
+		whereQuery += ` AND h.result = ?`
+	}
+
+	var limitQuery, offsetQuery string
+
+	if filter.Page != nil && filter.Limit != nil {
+		offset := (*filter.Page - 1) * (*filter.Limit)
+		filter.Offset = &offset
+	}
+
+	if filter.Limit != nil {
+		limitQuery += fmt.Sprintf(" LIMIT %d", *filter.Limit)
+	}
+
+	if filter.Offset != nil {
+		offsetQuery += fmt.Sprintf(" OFFSET %d", *filter.Offset)
+	}
+
+	var args []interface{}
+	if filter.Result != nil {
+		args = append(args, *filter.Result)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			h.id,
+			h.user_id,
+			h.username,
+			h.ip,
+			h.user_agent,
+			h.event,
+			h.result,
+			h.created_at
+		FROM sign_in_history AS h
+		JOIN users AS u ON u.id = h.user_id
+		%s ORDER BY h.id desc %s %s
+	`, whereQuery, limitQuery, offsetQuery)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, web.NewRequestError(errors.Wrap(err, "selecting sign-in history"), http.StatusBadRequest)
+	}
+	defer rows.Close()
+
+	list := make([]GetListResponse, 0)
+
+	for rows.Next() {
+		var detail GetListResponse
+		if err = rows.Scan(
+			&detail.ID,
+			&detail.UserID,
+			&detail.Username,
+			&detail.IP,
+			&detail.UserAgent,
+			&detail.Event,
+			&detail.Result,
+			&detail.CreatedAt); err != nil {
+			return nil, 0, web.NewRequestError(errors.Wrap(err, "scanning sign-in history"), http.StatusBadRequest)
+		}
+
+		list = append(list, detail)
+	}
+
+	var count int
+	countQuery := fmt.Sprintf(`SELECT count(h.id) FROM sign_in_history AS h JOIN users AS u ON u.id = h.user_id %s`, whereQuery)
+	if err = r.QueryRowContext(ctx, countQuery, args...).Scan(&count); err != nil {
+		return nil, 0, web.NewRequestError(errors.Wrap(err, "selecting sign-in history count"), http.StatusBadRequest)
+	}
+
+	return list, count, nil
+}
+
+// GetReport returns the suspicious patterns of the last hours: usernames
+// and IPs with many failed attempts, and successful sign-ins from an IP range
+// the user never signed in from before.
+func (r Repository) GetReport(ctx context.Context, filter ReportFilter) (ReportResponse, error) {
+	_, err := r.CheckClaims(ctx, auth.PermSignInRead)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+
+	hours, threshold := DefaultReportHours, DefaultReportThreshold
+	if filter.Hours != nil && *filter.Hours > 0 {
+		hours = *filter.Hours
+	}
+	if filter.Threshold != nil && *filter.Threshold > 0 {
+		threshold = *filter.Threshold
+	}
+
+	response := ReportResponse{
+		Since:           time.Now().Add(-time.Duration(hours) * time.Hour),
+		FailedUsernames: make([]FailedUsername, 0),
+		FailedIPs:       make([]FailedIP, 0),
+		NewIPRanges:     make([]NewIPRange, 0),
+	}
+
+	rows, err := r.QueryContext(ctx, `
+		SELECT lower(username), max(user_id), count(*), count(DISTINCT ip), max(created_at)
+		FROM sign_in_history
+		WHERE result IN (?, ?) AND created_at >= ? AND username IS NOT NULL
+		GROUP BY lower(username)
+		HAVING count(*) >= ?
+		ORDER BY count(*) desc
+	`, ResultFailed, ResultLocked, response.Since, threshold)
+	if err != nil {
+		return ReportResponse{}, web.NewRequestError(errors.Wrap(err, "selecting failed usernames"), http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detail FailedUsername
+		if err = rows.Scan(&detail.Username, &detail.UserID, &detail.Failures, &detail.IPs, &detail.LastAt); err != nil {
+			return ReportResponse{}, web.NewRequestError(errors.Wrap(err, "scanning failed usernames"), http.StatusInternalServerError)
+		}
+
+		response.FailedUsernames = append(response.FailedUsernames, detail)
+	}
+
+	rows, err = r.QueryContext(ctx, `
+		SELECT ip, count(*), count(DISTINCT lower(username)), max(created_at)
+		FROM sign_in_history
+		WHERE result IN (?, ?) AND created_at >= ?
+		GROUP BY ip
+		HAVING count(*) >= ?
+		ORDER BY count(*) desc
+	`, ResultFailed, ResultLocked, response.Since, threshold)
+	if err != nil {
+		return ReportResponse{}, web.NewRequestError(errors.Wrap(err, "selecting failed ips"), http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detail FailedIP
+		if err = rows.Scan(&detail.IP, &detail.Failures, &detail.Usernames, &detail.LastAt); err != nil {
+			return ReportResponse{}, web.NewRequestError(errors.Wrap(err, "scanning failed ips"), http.StatusInternalServerError)
+		}
+
+		response.FailedIPs = append(response.FailedIPs, detail)
+	}
+
+	// Refreshes are not sign-ins, and the first sign-in of a user is not
+	// reported, every range is new then.
+	rows, err = r.QueryContext(ctx, `
+		SELECT h.user_id, h.username, h.ip, h.ip_range, h.user_agent, h.created_at
+		FROM sign_in_history AS h
+		WHERE h.event <> ? AND h.result = ? AND h.created_at >= ? AND h.user_id IS NOT NULL
+		  AND EXISTS (
+			SELECT 1 FROM sign_in_history AS p
+			WHERE p.user_id = h.user_id AND p.event <> ? AND p.result = h.result AND p.id < h.id
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM sign_in_history AS p
+			WHERE p.user_id = h.user_id AND p.event <> ? AND p.result = h.result AND p.id < h.id
+			  AND p.ip_range = h.ip_range
+		  )
+		ORDER BY h.id desc
+	`, EventRefresh, ResultSuccess, response.Since, EventRefresh, EventRefresh)
+	if err != nil {
+		return ReportResponse{}, web.NewRequestError(errors.Wrap(err, "selecting new ip ranges"), http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detail NewIPRange
+		if err = rows.Scan(&detail.UserID, &detail.Username, &detail.IP, &detail.IPRange, &detail.UserAgent, &detail.CreatedAt); err != nil {
+			return ReportResponse{}, web.NewRequestError(errors.Wrap(err, "scanning new ip ranges"), http.StatusInternalServerError)
+		}
+
+		response.NewIPRanges = append(response.NewIPRanges, detail)
+	}
+
+	return response, nil
+}
+
+// ipRange returns the /24 network of IPv4 and the /48 network of IPv6
+// addresses. Addresses that can not be parsed are their own range.
+func ipRange(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
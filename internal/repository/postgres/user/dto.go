@@ -4,7 +4,6 @@ import (
 	"mime/multipart"
 	"time"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/uptrace/bun"
 )
 
@@ -14,27 +13,50 @@ type Filter struct {
 	Page   *int
 	Search *string
 	Role   *string
+	Status *string
 }
 
 type SignInRequest struct {
 	Username string `json:"username" form:"username"`
 	Password string `json:"password" form:"password"`
 }
-type RefreshRequest struct {
-	AccessToken  string `json:"access_token" form:"access_token"`
-	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+type SignInMFARequest struct {
+	MFAToken     string `json:"mfa_token"     form:"mfa_token"`
+	Code         string `json:"code"          form:"code"`
+	RecoveryCode string `json:"recovery_code" form:"recovery_code"`
+}
+
+type SignInPasswordRequest struct {
+	PasswordToken string `json:"password_token" form:"password_token"`
+	NewPassword   string `json:"new_password"   form:"new_password"`
+}
+
+type OIDCRequest struct {
+	Subject string
+
+	// Email is the verified email of the identity, it is empty when the
+	// provider did not verify it.
+	Email string
+
+	// Username, FullName and Role are used for provisioned users.
+	Username  string
+	FullName  string
+	Role      string
+	Provision bool
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"  form:"code"`
+	State string `json:"state" form:"state"`
 }
 
-type AuthClaims struct {
-	ID   int    `json:"user_id"`
-	Role string `json:"role"`
-	Type string `json:"type"`
-	jwt.StandardClaims
+type SignInMFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token" form:"mfa_token"`
 }
 
-// Valid implements jwt.Claims.
-func (*AuthClaims) Valid() error {
-	panic("unimplemented")
+type RefreshRequest struct {
+	AccessToken  string `json:"access_token" form:"access_token"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
 }
 
 type GetListResponse struct {
@@ -42,24 +64,33 @@ type GetListResponse struct {
 	Avatar        *string `json:"avatar"`
 	FullName      *string `json:"full_name"`
 	Username      *string `json:"username"`
+	Phone         *string `json:"phone"`
 	Role          *string `json:"role"`
 	BirthDistrict *string `json:"birth_district_id"`
 	BirthDate     *string `json:"birth_date"`
+	Status        string  `json:"status"`
+	StatusReason  *string `json:"status_reason"`
+	StatusUntil   *string `json:"status_until"`
 }
 
 type GetDetailByIdResponse struct {
 	ID                int     `json:"id"`
 	Avatar            *string `json:"avatar"`
 	Username          *string `json:"username"`
+	Phone             *string `json:"phone"`
 	FullName          *string `json:"full_name"`
 	Role              *string `json:"role"`
 	BirthDistrict     *int    `json:"birth_district_id"`
 	BirthDistrictName *string `json:"birth_district_name"`
 	BirthDate         *string `json:"birth_date"`
+	Status            string  `json:"status"`
+	StatusReason      *string `json:"status_reason"`
+	StatusUntil       *string `json:"status_until"`
 }
 
 type CreateRequest struct {
 	Username      *string               `json:"username" form:"username"`
+	Phone         *string               `json:"phone" form:"phone"`
 	FullName      *string               `json:"full_name" form:"full_name"`
 	Password      *string               `json:"password" form:"password"`
 	Avatar        *multipart.FileHeader `json:"-" form:"avatar"`
@@ -72,21 +103,65 @@ type CreateRequest struct {
 type CreateResponse struct {
 	bun.BaseModel `bun:"table:users"`
 
-	ID            int        `json:"id" bun:"-"`
-	Avatar        *string    `json:"avatar"     bun:"avatar"`
-	Username      *string    `json:"username"   bun:"username"`
-	Password      *string    `json:"-"   bun:"password"`
-	FullName      *string    `json:"full_name" bun:"full_name"`
-	Role          *string    `json:"role" bun:"role"`
-	BirthDistrict *string    `json:"birth_district_id" bun:"birth_district_id"`
-	BirthDate     *time.Time `json:"birth_date" bun:"birth_date"`
-	CreatedAt     time.Time  `json:"-"          bun:"created_at"`
-	CreatedBy     int        `json:"-"          bun:"created_by"`
+	ID             int        `json:"id" bun:"-"`
+	Avatar         *string    `json:"avatar"     bun:"avatar"`
+	Username       *string    `json:"username"   bun:"username"`
+	Phone          *string    `json:"phone"      bun:"phone"`
+	Password       *string    `json:"-"   bun:"password"`
+	FullName       *string    `json:"full_name" bun:"full_name"`
+	Role           *string    `json:"role" bun:"role"`
+	BirthDistrict  *string    `json:"birth_district_id" bun:"birth_district_id"`
+	BirthDate      *time.Time `json:"birth_date" bun:"birth_date"`
+	CreatedAt      time.Time  `json:"-"          bun:"created_at"`
+	CreatedBy      int        `json:"-"          bun:"created_by"`
+	CreatedByActor *int       `json:"-" bun:"created_by_actor"`
+
+	PasswordChangeRequired bool   `json:"password_change_required" bun:"password_change_required"`
+	Status                 string `json:"status" bun:"status"`
+}
+
+type Invitation struct {
+	UserID    int
+	Username  string
+	FullName  string
+	Phone     string
+	Token     string
+	ExpiresAt time.Time
+}
+
+type ActivateRequest struct {
+	Token    *string `json:"token"    form:"token"`
+	Password *string `json:"password" form:"password"`
+}
+
+type SetStatusRequest struct {
+	ID     int     `json:"id"     form:"id"`
+	Status *string `json:"status" form:"status"`
+	Reason *string `json:"reason" form:"reason"`
+	// Until is the last day of the status, the user is active again after
+	// it. It is not set for statuses without an end.
+	Until *string `json:"until" form:"until"`
 }
 
+type UpdateMeRequest struct {
+	Phone      *string               `json:"phone" form:"phone"`
+	FullName   *string               `json:"full_name" form:"full_name"`
+	Avatar     *multipart.FileHeader `json:"-" form:"avatar"`
+	AvatarLink *string               `json:"-" form:"-"`
+
+	// CurrentPassword or MFACode is required to change the phone, it
+	// receives the password reset codes.
+	CurrentPassword *string `json:"current_password" form:"current_password"`
+	MFACode         *string `json:"mfa_code" form:"mfa_code"`
+}
+type ChangePasswordRequest struct {
+	CurrentPassword *string `json:"current_password" form:"current_password"`
+	NewPassword     *string `json:"new_password" form:"new_password"`
+}
 type UpdateRequest struct {
 	ID            int                   `json:"id" form:"id"`
 	Username      *string               `json:"username" form:"username"`
+	Phone         *string               `json:"phone" form:"phone"`
 	FullName      *string               `json:"full_name" form:"full_name"`
 	Password      *string               `json:"password" form:"password"`
 	Avatar        *multipart.FileHeader `json:"-" form:"avatar"`
@@ -95,3 +170,25 @@ type UpdateRequest struct {
 	BirthDistrict *string               `json:"birth_district_id" form:"birth_district_id"`
 	BirthDate     *string               `json:"birth_date" form:"birth_date"`
 }
+
+type DepartmentResponse struct {
+	DepartmentID   int     `json:"department_id"`
+	DepartmentName *string `json:"department_name"`
+	IsHead         bool    `json:"is_head"`
+}
+
+type DepartmentAssignment struct {
+	DepartmentID int  `json:"department_id" form:"department_id"`
+	IsHead       bool `json:"is_head" form:"is_head"`
+}
+
+type SetDepartmentsRequest struct {
+	UserID      int                    `json:"-" form:"-"`
+	Departments []DepartmentAssignment `json:"departments" form:"departments"`
+}
+
+type CountResponse struct {
+	Role   string `json:"role"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
@@ -2,7 +2,10 @@ package user
 
 import (
 	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -12,64 +15,496 @@ import (
 	"project/internal/pkg/repository/postgresql"
 	"project/internal/repository/postgres"
 	"project/internal/service/hashing"
+	"project/internal/service/password"
+	"project/internal/service/sms"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/uptrace/bun"
 )
 
+// InvitationTTL is how long an invited user has to activate the account.
+const InvitationTTL = 72 * time.Hour
+
+// ErrInvalidInvitation is returned for unknown, expired, revoked and used
+// activation tokens.
+var ErrInvalidInvitation = errors.New("activation token is invalid or expired")
+
+// statusQuery selects the status of users in effect today, see
+// entity.User.StatusAt.
+const statusQuery = `(CASE WHEN %[1]sstatus_until < current_date AND %[1]sstatus <> 'PENDING' THEN 'ACTIVE' ELSE %[1]sstatus::text END)`
+
 type Repository struct {
 	*postgresql.Database
+	passwords *password.Service
 }
 
-func NewRepository(database *postgresql.Database) *Repository {
-	return &Repository{Database: database}
+func NewRepository(database *postgresql.Database, passwords *password.Service) *Repository {
+	return &Repository{Database: database, passwords: passwords}
 }
 
 func (r Repository) GetByUsername(ctx context.Context, username string) (entity.User, error) {
 	var detail entity.User
 
 	err := r.NewSelect().Model(&detail).Where("username = ? AND deleted_at IS NULL", username).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return entity.User{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+	if err != nil {
+		return entity.User{}, web.NewRequestError(errors.Wrap(err, "selecting user by username"), http.StatusInternalServerError)
+	}
+
+	return detail, nil
+}
+
+// GetByOIDC returns the user of an identity of the OpenID Connect provider.
+// It is used while signing in, so it does not check the claims of the
+// context. The user is found by the subject, then by the verified email as
+// username, which links the subject to the user. Admins are not linked by
+// email, whoever controls the email at the provider would take the account
+// over. Unknown identities get a new user without a password when
+// request.Provision is set.
+func (r Repository) GetByOIDC(ctx context.Context, request OIDCRequest) (entity.User, error) {
+	var detail entity.User
+
+	err := r.NewSelect().Model(&detail).Where("oidc_subject = ? AND deleted_at IS NULL", request.Subject).Scan(ctx)
+	if err == nil {
+		return detail, nil
+	}
+	if err != sql.ErrNoRows {
+		return entity.User{}, web.NewRequestError(errors.Wrap(err, "selecting user by oidc subject"), http.StatusInternalServerError)
+	}
+
+	if request.Email != "" {
+		err = r.NewSelect().Model(&detail).Where("lower(username) = lower(?) AND deleted_at IS NULL", request.Email).Scan(ctx)
+		if err != nil && err != sql.ErrNoRows {
+			return entity.User{}, web.NewRequestError(errors.Wrap(err, "selecting user by email"), http.StatusInternalServerError)
+		}
+
+		if err == nil {
+			if detail.Role != nil && *detail.Role == auth.RoleAdmin {
+				return entity.User{}, web.NewRequestError(errors.New("privileged users are not linked by email"), http.StatusForbidden)
+			}
+
+			// A user is linked to one subject, another identity with the
+			// same email does not take it over.
+			result, err := r.NewUpdate().
+				Table("users").
+				Where("id = ? AND oidc_subject IS NULL", detail.ID).
+				Set("oidc_subject = ?", request.Subject).
+				Exec(ctx)
+			if err != nil {
+				return entity.User{}, web.NewRequestError(errors.Wrap(err, "linking oidc subject"), http.StatusInternalServerError)
+			}
+			if rows, _ := result.RowsAffected(); rows == 0 {
+				return entity.User{}, web.NewRequestError(errors.New("user is linked to another identity"), http.StatusForbidden)
+			}
+
+			return detail, nil
+		}
+	}
+
+	if !request.Provision {
+		return entity.User{}, web.NewRequestError(errors.New("no user for the identity"), http.StatusForbidden)
+	}
+
+	role := strings.ToUpper(request.Role)
+	if !auth.ValidRole(role) {
+		return entity.User{}, web.NewRequestError(errors.Errorf("invalid provision role %q", request.Role), http.StatusInternalServerError)
+	}
+
+	taken := true
+	if err = r.QueryRowContext(ctx, `SELECT EXISTS (SELECT id FROM users WHERE lower(username) = lower(?) AND deleted_at IS NULL)`, request.Username).Scan(&taken); err != nil {
+		return entity.User{}, web.NewRequestError(errors.Wrap(err, "username check"), http.StatusInternalServerError)
+	}
+	if taken {
+		return entity.User{}, web.NewRequestError(errors.New("username is used"), http.StatusConflict)
+	}
+
+	// An empty password matches no bcrypt hash, so the user signs in only
+	// through the provider until a password is set.
+	err = r.QueryRowContext(ctx, `
+		INSERT INTO users (username, full_name, role, password, oidc_subject, created_at)
+		VALUES (?, ?, ?, '', ?, now())
+		RETURNING id
+	`, request.Username, request.FullName, role, request.Subject).Scan(&detail.ID)
+	if err != nil {
+		return entity.User{}, web.NewRequestError(errors.Wrap(err, "provisioning user"), http.StatusInternalServerError)
+	}
+
+	return r.GetById(ctx, detail.ID)
+}
+
+// CreateInvitation creates the activation token of a pending user and
+// revokes the earlier ones. Only a hash of the token is kept.
+func (r Repository) CreateInvitation(ctx context.Context, id int) (Invitation, error) {
+	claims, err := r.CheckClaims(ctx, auth.PermUserCreate)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	var detail entity.User
+	err = r.NewSelect().Model(&detail).Where("id = ? AND deleted_at IS NULL", id).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return Invitation{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+	if err != nil {
+		return Invitation{}, web.NewRequestError(errors.Wrap(err, "selecting user"), http.StatusInternalServerError)
+	}
+
+	if detail.Status != entity.UserStatusPending {
+		return Invitation{}, web.NewRequestError(errors.New("user is already activated"), http.StatusBadRequest)
+	}
+
+	b := make([]byte, 32)
+	if _, err = crand.Read(b); err != nil {
+		return Invitation{}, web.NewRequestError(errors.Wrap(err, "generating activation token"), http.StatusInternalServerError)
+	}
+
+	invitation := Invitation{
+		UserID:    detail.ID,
+		Token:     hex.EncodeToString(b),
+		ExpiresAt: time.Now().Add(InvitationTTL),
+	}
+	if detail.Username != nil {
+		invitation.Username = *detail.Username
+	}
+	if detail.FullName != nil {
+		invitation.FullName = *detail.FullName
+	}
+	if detail.Phone != nil {
+		invitation.Phone = *detail.Phone
+	}
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return Invitation{}, web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `UPDATE user_invitations SET revoked_at = now() WHERE user_id = ? AND used_at IS NULL AND revoked_at IS NULL`, id); err != nil {
+		return Invitation{}, web.NewRequestError(errors.Wrap(err, "revoking invitations"), http.StatusInternalServerError)
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO user_invitations (user_id, token_hash, expires_at, created_by)
+		VALUES (?, ?, ?, ?)
+	`, id, tokenHash(invitation.Token), invitation.ExpiresAt, claims.UserId); err != nil {
+		return Invitation{}, web.NewRequestError(errors.Wrap(err, "creating invitation"), http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Invitation{}, web.NewRequestError(errors.Wrap(err, "committing invitation"), http.StatusInternalServerError)
+	}
+
+	return invitation, nil
+}
+
+// Activate sets the password of the pending user of the activation token
+// and makes the user active. It is called by the invited user, so it does not
+// check the claims of the context. A token activates once.
+func (r Repository) Activate(ctx context.Context, request ActivateRequest) error {
+	if err := r.ValidateStruct(&request, "Token", "Password"); err != nil {
+		return err
+	}
+
+	var invitationID, userID int
+	err := r.QueryRowContext(ctx, `
+		SELECT id, user_id FROM user_invitations
+		WHERE token_hash = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > now()
+	`, tokenHash(*request.Token)).Scan(&invitationID, &userID)
+	if err == sql.ErrNoRows {
+		return web.NewRequestError(ErrInvalidInvitation, http.StatusBadRequest)
+	}
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "selecting invitation"), http.StatusInternalServerError)
+	}
+
+	detail, err := r.GetById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if detail.Status != entity.UserStatusPending {
+		return web.NewRequestError(ErrInvalidInvitation, http.StatusBadRequest)
+	}
+
+	hash, err := r.hashPassword(ctx, 0, detail.Username, *request.Password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE user_invitations SET used_at = now() WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL`, invitationID)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "using invitation"), http.StatusInternalServerError)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(ErrInvalidInvitation, http.StatusBadRequest)
+	}
+
+	result, err = tx.ExecContext(ctx, `
+		UPDATE users
+		SET password = ?, status = ?, password_change_required = false, updated_at = now(), updated_by = id
+		WHERE id = ? AND deleted_at IS NULL
+	`, hash, entity.UserStatusActive, userID)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "activating user"), http.StatusInternalServerError)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	if err = r.addPasswordHistoryTx(ctx, tx, userID, hash); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "committing activation"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetByPhone returns the user with the phone. It is used by the password
+// reset flow, so it does not check the claims of the context.
+func (r Repository) GetByPhone(ctx context.Context, phone string) (entity.User, error) {
+	var detail entity.User
+
+	err := r.NewSelect().Model(&detail).Where("phone = ? AND deleted_at IS NULL", sms.NormalizePhone(phone)).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return entity.User{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+	if err != nil {
+		return entity.User{}, web.NewRequestError(errors.Wrap(err, "selecting user by phone"), http.StatusInternalServerError)
+	}
+
+	return detail, nil
+}
+
+// SetPassword replaces the password of the user without checking the claims
+// of the context. Callers must have verified the user in another way. The
+// user chose the password, so a required password change is done.
+func (r Repository) SetPassword(ctx context.Context, id int, password string) error {
+	if password == "" {
+		return web.NewRequestError(errors.New("password is required"), http.StatusBadRequest)
+	}
+
+	detail, err := r.GetById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	hash, err := r.hashPassword(ctx, id, detail.Username, password)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.NewUpdate().
+		Table("users").
+		Where("deleted_at IS NULL AND id = ?", id).
+		Set("password = ?", hash).
+		Set("password_change_required = false").
+		Set("updated_at = ?", time.Now()).
+		Set("updated_by = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "updating password"), http.StatusBadRequest)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	return r.addPasswordHistory(ctx, id, hash)
+}
+
+// ComparePassword reports whether the password is the one of the user. Users
+// without a password are compared with a dummy hash, so unknown users take as
+// long as wrong passwords.
+func (r Repository) ComparePassword(detail entity.User, password string) bool {
+	return r.passwords.Compare(detail.Password, password)
+}
+
+// RehashPassword hashes the password of a signed in user again when its hash
+// was made with another cost than the configured one. The caller must have
+// compared the password.
+func (r Repository) RehashPassword(ctx context.Context, detail entity.User, password string) error {
+	if detail.Password == nil || !r.passwords.NeedsRehash(*detail.Password) {
+		return nil
+	}
+
+	hash, err := r.passwords.Hash(password)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	_, err = r.NewUpdate().
+		Table("users").
+		Where("deleted_at IS NULL AND id = ?", detail.ID).
+		Set("password = ?", hash).
+		Exec(ctx)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "rehashing password"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// CheckPassword checks the password against the policy and the recent
+// passwords of the user without setting it. The password reset checks the
+// new password before the code is consumed.
+func (r Repository) CheckPassword(ctx context.Context, detail entity.User, password string) error {
+	if password == "" {
+		return web.NewRequestError(errors.New("password is required"), http.StatusBadRequest)
+	}
+
+	return r.checkPassword(ctx, detail.ID, detail.Username, password)
+}
+
+// hashPassword checks the password against the policy and the recent
+// passwords of the user and hashes it. id is 0 for new users.
+func (r Repository) hashPassword(ctx context.Context, id int, username *string, password string) (string, error) {
+	if err := r.checkPassword(ctx, id, username, password); err != nil {
+		return "", err
+	}
+
+	hash, err := r.passwords.Hash(password)
 	if err != nil {
-		return entity.User{}, &web.Error{
-			Err:    errors.New("user not found!"),
-			Status: http.StatusUnauthorized,
+		return "", web.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	return hash, nil
+}
+
+// checkPassword checks the password against the policy and, for existing
+// users, against their recent passwords.
+func (r Repository) checkPassword(ctx context.Context, id int, username *string, password string) error {
+	var name string
+	if username != nil {
+		name = *username
+	}
+
+	if err := r.passwords.Validate(password, name); err != nil {
+		return err
+	}
+
+	if id == 0 || r.passwords.HistorySize() == 0 {
+		return nil
+	}
+
+	rows, err := r.QueryContext(ctx, `
+		SELECT password FROM users WHERE id = ? AND password IS NOT NULL
+		UNION ALL
+		(SELECT password FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?)
+	`, id, id, r.passwords.HistorySize())
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "selecting password history"), http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			return web.NewRequestError(errors.Wrap(err, "scanning password history"), http.StatusInternalServerError)
 		}
+		hashes = append(hashes, hash)
 	}
 
-	return detail, err
+	return r.passwords.CheckHistory(password, hashes)
+}
+
+// addPasswordHistory records the new password hash of the user and forgets
+// the ones older than the history of the policy.
+func (r Repository) addPasswordHistory(ctx context.Context, id int, hash string) error {
+	return r.addPasswordHistoryTx(ctx, r.DB, id, hash)
 }
 
+// addPasswordHistoryTx is addPasswordHistory on the connection, e.g. in the
+// transaction that changes the password.
+func (r Repository) addPasswordHistoryTx(ctx context.Context, conn bun.IConn, id int, hash string) error {
+	if r.passwords.HistorySize() == 0 {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, `INSERT INTO password_history (user_id, password) VALUES (?, ?)`, id, hash); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "inserting password history"), http.StatusInternalServerError)
+	}
+
+	if _, err := conn.ExecContext(ctx, `
+		DELETE FROM password_history
+		WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)
+	`, id, id, r.passwords.HistorySize()); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting password history"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// GetById returns the user with the id. It does not check the claims of the
+// context, it is used while signing in and for the current user.
 func (r Repository) GetById(ctx context.Context, id int) (entity.User, error) {
 	var detail entity.User
 
-	err := r.NewSelect().Model(&detail).Where("id = ?", id).Scan(ctx)
+	err := r.NewSelect().Model(&detail).Where("id = ? AND deleted_at IS NULL", id).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return entity.User{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+	if err != nil {
+		return entity.User{}, web.NewRequestError(errors.Wrap(err, "selecting user"), http.StatusInternalServerError)
+	}
 
-	return detail, err
+	return detail, nil
 }
 
 func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListResponse, int, error) {
-	_, err := r.CheckClaims(ctx, auth.RoleAdmin)
+	_, err := r.CheckClaims(ctx, auth.PermUserRead)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	whereQuery := fmt.Sprintf(`
+	whereQuery := `
 			WHERE 
 				deleted_at IS NULL
-			`)
+			`
+	var args []interface{}
 
 	if filter.Role != nil {
 		role := strings.ToUpper(*filter.Role)
-		whereQuery += fmt.Sprintf(` AND role = '%s' `, role)
+		if !auth.ValidRole(role) {
+			return nil, 0, web.NewRequestError(errors.New("incorrect role. role should be ADMIN, EMPLOYEE or STUDENT"), http.StatusBadRequest)
+		}
+		whereQuery += ` AND role = ? `
+		args = append(args, role)
+	}
+
+	if filter.Status != nil {
+		status := strings.ToUpper(*filter.Status)
+		if !validStatus(status) {
+			return nil, 0, web.NewRequestError(errors.New("incorrect status. status should be ACTIVE, PENDING, BLOCKED, GRADUATED or ON_LEAVE"), http.StatusBadRequest)
+		}
+		whereQuery += fmt.Sprintf(` AND %s = '%s' `, fmt.Sprintf(statusQuery, ""), status)
 	}
 
 	if filter.Search != nil {
 		search := strings.Replace(*filter.Search, " ", "", -1)
-		search = strings.Replace(search, "'", "", -1)
 
-		whereQuery += fmt.Sprintf(` AND full_name ilike '%s'`, "%"+search+"%")
+		whereQuery += ` AND full_name ilike ?`
+		args = append(args, "%"+search+"%")
 	}
 	orderQuery := "ORDER BY created_at desc"
 
@@ -94,14 +529,18 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 			avatar,
 			full_name,
 			username,
+			phone,
 			role,
 			to_char(birth_date, 'DD.MM.YYYY'),
-			birth_district_id
+			birth_district_id,
+			%s,
+			status_reason,
+			to_char(status_until, 'DD.MM.YYYY')
 		FROM users
 		%s %s %s %s
-	`, whereQuery, orderQuery, limitQuery, offsetQuery)
+	`, fmt.Sprintf(statusQuery, ""), whereQuery, orderQuery, limitQuery, offsetQuery)
 
-	rows, err := r.QueryContext(ctx, query)
+	rows, err := r.QueryContext(ctx, query, args...)
 	if err == sql.ErrNoRows {
 		return nil, 0, web.NewRequestError(postgres.ErrNotFound, http.StatusBadRequest)
 	}
@@ -118,9 +557,13 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 			&detail.Avatar,
 			&detail.FullName,
 			&detail.Username,
+			&detail.Phone,
 			&detail.Role,
 			&detail.BirthDate,
-			&detail.BirthDistrict); err != nil {
+			&detail.BirthDistrict,
+			&detail.Status,
+			&detail.StatusReason,
+			&detail.StatusUntil); err != nil {
 			return nil, 0, web.NewRequestError(errors.Wrap(err, "scanning user list"), http.StatusBadRequest)
 		}
 		if detail.Avatar != nil {
@@ -138,7 +581,7 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 			%s
 	`, whereQuery)
 
-	countRows, err := r.QueryContext(ctx, countQuery)
+	countRows, err := r.QueryContext(ctx, countQuery, args...)
 	if err == sql.ErrNoRows {
 		return nil, 0, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
 	}
@@ -158,38 +601,60 @@ func (r Repository) GetList(ctx context.Context, filter Filter) ([]GetListRespon
 }
 
 func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdResponse, error) {
-	_, err := r.CheckClaims(ctx, auth.RoleAdmin)
+	_, err := r.CheckClaims(ctx, auth.PermUserRead)
+	if err != nil {
+		return GetDetailByIdResponse{}, err
+	}
+
+	return r.getDetail(ctx, id)
+}
+
+// GetMe returns the profile of the current user.
+func (r Repository) GetMe(ctx context.Context) (GetDetailByIdResponse, error) {
+	claims, err := r.CheckClaims(ctx)
 	if err != nil {
 		return GetDetailByIdResponse{}, err
 	}
 
+	return r.getDetail(ctx, claims.UserId)
+}
+
+func (r Repository) getDetail(ctx context.Context, id int) (GetDetailByIdResponse, error) {
 	query := fmt.Sprintf(`
 		SELECT
 			u.id,
 			u.avatar,
 			u.full_name,
 			u.username,
+			u.phone,
 			u.role,
 			to_char(u.birth_date, 'DD.MM.YYYY'),
 			u.birth_district_id,
-			d.name->>'uz' AS birth_district_name
+			d.name->>'uz' AS birth_district_name,
+			%s,
+			u.status_reason,
+			to_char(u.status_until, 'DD.MM.YYYY')
 			FROM
 		    users as u
 		LEFT JOIN district as d ON u.birth_district_id=d.id 	
 		WHERE u.deleted_at IS NULL AND u.id = %d
-	`, id)
+	`, fmt.Sprintf(statusQuery, "u."), id)
 
 	var detail GetDetailByIdResponse
 
-	err = r.QueryRowContext(ctx, query).Scan(
+	err := r.QueryRowContext(ctx, query).Scan(
 		&detail.ID,
 		&detail.Avatar,
 		&detail.FullName,
 		&detail.Username,
+		&detail.Phone,
 		&detail.Role,
 		&detail.BirthDate,
 		&detail.BirthDistrict,
 		&detail.BirthDistrictName,
+		&detail.Status,
+		&detail.StatusReason,
+		&detail.StatusUntil,
 	)
 
 	if err == sql.ErrNoRows {
@@ -208,7 +673,7 @@ func (r Repository) GetDetailById(ctx context.Context, id int) (GetDetailByIdRes
 }
 
 func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateResponse, error) {
-	claims, err := r.CheckClaims(ctx, auth.RoleAdmin)
+	claims, err := r.CheckClaims(ctx, auth.PermUserCreate)
 	if err != nil {
 		return CreateResponse{}, err
 	}
@@ -217,30 +682,66 @@ func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateRe
 		return CreateResponse{}, err
 	}
 
+	return r.create(ctx, request, claims)
+}
+
+// Invite creates a pending user without a password. The user sets the
+// password with the token of CreateInvitation.
+func (r Repository) Invite(ctx context.Context, request CreateRequest) (CreateResponse, error) {
+	claims, err := r.CheckClaims(ctx, auth.PermUserCreate)
+	if err != nil {
+		return CreateResponse{}, err
+	}
+
+	if err := r.ValidateStruct(&request, "Username", "Role", "FullName"); err != nil {
+		return CreateResponse{}, err
+	}
+
+	request.Password = nil
+
+	return r.create(ctx, request, claims)
+}
+
+// create inserts the user, users without a password are pending.
+func (r Repository) create(ctx context.Context, request CreateRequest, claims auth.Claims) (CreateResponse, error) {
+	var err error
+
 	rand.Seed(time.Now().UnixNano())
 
 	UsernameStatus := true
-	if err := r.QueryRowContext(ctx,
-		fmt.Sprintf(`SELECT 
+	if err := r.QueryRowContext(postgresql.Unscoped(ctx),
+		`SELECT 
     						CASE WHEN 
-    						(SELECT id FROM users WHERE username = '%s' AND deleted_at IS NULL) IS NOT NULL 
-    						THEN true ELSE false END`, *request.Username)).Scan(&UsernameStatus); err != nil {
+    						(SELECT id FROM users WHERE username = ? AND deleted_at IS NULL) IS NOT NULL 
+    						THEN true ELSE false END`, *request.Username).Scan(&UsernameStatus); err != nil {
 		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "Username check"), http.StatusInternalServerError)
 	}
 	if UsernameStatus {
 		return CreateResponse{}, web.NewRequestError(errors.Wrap(errors.New(""), "username is used"), http.StatusInternalServerError)
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(*request.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "hashing password"), http.StatusInternalServerError)
+	if request.Phone != nil {
+		phone := sms.NormalizePhone(*request.Phone)
+		if err := r.checkPhone(ctx, phone, 0); err != nil {
+			return CreateResponse{}, err
+		}
+		request.Phone = &phone
+	}
+
+	// An empty password matches no bcrypt hash.
+	var hashedPassword string
+	status := entity.UserStatusPending
+	if request.Password != nil {
+		if hashedPassword, err = r.hashPassword(ctx, 0, request.Username, *request.Password); err != nil {
+			return CreateResponse{}, err
+		}
+		status = entity.UserStatusActive
 	}
-	hashedPassword := string(hash)
 
 	var response CreateResponse
-	role := strings.ToUpper(*request.Role)
-	if (role != "STUDENT") && (role != "EMPLOYEE") {
-		return CreateResponse{}, web.NewRequestError(errors.New("incorrect role. role should be STUDENT or EMPLOYEE"), http.StatusBadRequest)
+	role, err := assignRole(claims, *request.Role)
+	if err != nil {
+		return CreateResponse{}, err
 	}
 	var birthDate time.Time
 	if request.BirthDate != nil {
@@ -252,18 +753,28 @@ func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateRe
 	response.Role = &role
 	response.FullName = request.FullName
 	response.Username = request.Username
+	response.Phone = request.Phone
 	response.Avatar = request.AvatarLink
 	response.Password = &hashedPassword
+	response.PasswordChangeRequired = status == entity.UserStatusActive
+	response.Status = status
 	response.BirthDistrict = request.BirthDistrict
 	response.BirthDate = &birthDate
 	response.CreatedAt = time.Now()
 	response.CreatedBy = claims.UserId
+	response.CreatedByActor = claims.Actor()
 
 	_, err = r.NewInsert().Model(&response).Returning("id").Exec(ctx, &response.ID)
 	if err != nil {
 		return CreateResponse{}, web.NewRequestError(errors.Wrap(err, "creating user"), http.StatusBadRequest)
 	}
 
+	if hashedPassword != "" {
+		if err = r.addPasswordHistory(ctx, response.ID, hashedPassword); err != nil {
+			return CreateResponse{}, err
+		}
+	}
+
 	if response.Avatar != nil {
 		link := r.ServerBaseUrl + hashing.GenerateHash(*response.Avatar)
 		response.Avatar = &link
@@ -273,7 +784,7 @@ func (r Repository) Create(ctx context.Context, request CreateRequest) (CreateRe
 }
 
 func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error {
-	claims, err := r.CheckClaims(ctx, auth.RoleAdmin)
+	claims, err := r.CheckClaims(ctx, auth.PermUserUpdate)
 	if err != nil {
 		return err
 	}
@@ -281,25 +792,35 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 	if err := r.ValidateStruct(&request, "ID", "Username", "FullName", "Phone", "AvatarLink", "Password", "Role", "BirthDate", "BirthDistrict"); err != nil {
 		return err
 	}
+	// the user is checked first, so users out of scope can not be probed
+	// with the username and password checks
+	if err := r.checkTarget(ctx, claims, request.ID); err != nil {
+		return err
+	}
+
 	UsernameStatus := true
-	if err := r.QueryRowContext(ctx, fmt.Sprintf("SELECT CASE WHEN (SELECT id FROM users WHERE username = '%s' AND deleted_at IS NULL AND id != %d) IS NOT NULL THEN true ELSE false END", *request.Username, request.ID)).Scan(&UsernameStatus); err != nil {
+	if err := r.QueryRowContext(postgresql.Unscoped(ctx), "SELECT CASE WHEN (SELECT id FROM users WHERE username = ? AND deleted_at IS NULL AND id != ?) IS NOT NULL THEN true ELSE false END", *request.Username, request.ID).Scan(&UsernameStatus); err != nil {
 		return web.NewRequestError(errors.Wrap(err, "Username check"), http.StatusInternalServerError)
 	}
 	if UsernameStatus {
 		return web.NewRequestError(errors.Wrap(errors.New(""), "Username is used"), http.StatusInternalServerError)
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(*request.Password), bcrypt.DefaultCost)
+	phone := sms.NormalizePhone(*request.Phone)
+	if err := r.checkPhone(ctx, phone, request.ID); err != nil {
+		return err
+	}
+
+	hashedPassword, err := r.hashPassword(ctx, request.ID, request.Username, *request.Password)
 	if err != nil {
-		return web.NewRequestError(errors.Wrap(err, "hashing password"), http.StatusInternalServerError)
+		return err
 	}
-	hashedPassword := string(hash)
 
 	q := r.NewUpdate().Table("users").Where("deleted_at IS NULL AND id = ?", request.ID)
 
-	role := strings.ToUpper(*request.Role)
-	if (role != "STUDENT") && (role != "EMPLOYEE") {
-		return web.NewRequestError(errors.New("incorrect role. role should be STUDENT or EMPLOYEE"), http.StatusBadRequest)
+	role, err := assignRole(claims, *request.Role)
+	if err != nil {
+		return err
 	}
 
 	var birthDate time.Time
@@ -313,31 +834,91 @@ func (r Repository) UpdateAll(ctx context.Context, request UpdateRequest) error
 	q.Set("role = ?", role)
 	q.Set("full_name = ?", request.FullName)
 	q.Set("username = ?", request.Username)
+	q.Set("phone = ?", phone)
 	q.Set("avatar = ?", request.AvatarLink)
 	q.Set("birth_date = ?", birthDate)
 	q.Set("birth_district_id = ?", request.BirthDistrict)
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 	q.Set("password = ?", hashedPassword)
+	// a password set by someone else has to be changed on the next sign-in
+	q.Set("password_change_required = ?", request.ID != claims.UserId)
 
-	_, err = q.Exec(ctx)
+	result, err := q.Exec(ctx)
 	if err != nil {
 		return web.NewRequestError(errors.Wrap(err, "updating user"), http.StatusBadRequest)
 	}
 
-	return nil
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	return r.addPasswordHistory(ctx, request.ID, hashedPassword)
 }
 
 func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) error {
-	claims, err := r.CheckClaims(ctx, auth.RoleAdmin)
+	claims, err := r.CheckClaims(ctx, auth.PermUserUpdate)
+	if err != nil {
+		return err
+	}
+
+	return r.updateColumns(ctx, request, claims)
+}
+
+// UpdateMe updates the profile of the current user. Only the fields of
+// UpdateMeRequest can be changed, the other ones are managed by admins.
+func (r Repository) UpdateMe(ctx context.Context, request UpdateMeRequest) error {
+	claims, err := r.CheckClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.updateColumns(ctx, UpdateRequest{
+		ID:         claims.UserId,
+		FullName:   request.FullName,
+		Phone:      request.Phone,
+		AvatarLink: request.AvatarLink,
+	}, claims)
+}
+
+// ChangePassword sets the password of the current user after checking the
+// current one.
+func (r Repository) ChangePassword(ctx context.Context, request ChangePasswordRequest) error {
+	claims, err := r.CheckClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	if claims.ActorID != 0 {
+		return web.NewRequestError(errors.New("password can not be changed while impersonating"), http.StatusForbidden)
+	}
+
+	if err := r.ValidateStruct(&request, "CurrentPassword", "NewPassword"); err != nil {
+		return err
+	}
+
+	detail, err := r.GetById(ctx, claims.UserId)
 	if err != nil {
 		return err
 	}
 
+	if !r.ComparePassword(detail, *request.CurrentPassword) {
+		return web.NewRequestError(errors.New("incorrect current password"), http.StatusBadRequest)
+	}
+
+	return r.SetPassword(ctx, claims.UserId, *request.NewPassword)
+}
+
+func (r Repository) updateColumns(ctx context.Context, request UpdateRequest, claims auth.Claims) error {
 	if err := r.ValidateStruct(&request, "ID"); err != nil {
 		return err
 	}
 
+	if err := r.checkTarget(ctx, claims, request.ID); err != nil {
+		return err
+	}
+
 	q := r.NewUpdate().Table("users").Where("deleted_at IS NULL AND id = ? ", request.ID)
 
 	if request.FullName != nil {
@@ -345,7 +926,7 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 	}
 	if request.Username != nil {
 		usernameStatus := true
-		if err := r.QueryRowContext(ctx, fmt.Sprintf("SELECT CASE WHEN (SELECT id FROM users WHERE username = '%s' AND deleted_at IS NULL AND id != %d) IS NOT NULL THEN true ELSE false END", *request.Username, request.ID)).Scan(&usernameStatus); err != nil {
+		if err := r.QueryRowContext(postgresql.Unscoped(ctx), "SELECT CASE WHEN (SELECT id FROM users WHERE username = ? AND deleted_at IS NULL AND id != ?) IS NOT NULL THEN true ELSE false END", *request.Username, request.ID).Scan(&usernameStatus); err != nil {
 			return web.NewRequestError(errors.Wrap(err, "username check"), http.StatusInternalServerError)
 		}
 		if usernameStatus {
@@ -354,21 +935,40 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 		q.Set("username = ?", request.Username)
 	}
 
+	if request.Phone != nil {
+		phone := sms.NormalizePhone(*request.Phone)
+		if err := r.checkPhone(ctx, phone, request.ID); err != nil {
+			return err
+		}
+		q.Set("phone = ?", phone)
+	}
+
 	if request.AvatarLink != nil {
 		q.Set("avatar = ?", request.AvatarLink)
 	}
+	var hashedPassword string
 	if request.Password != nil {
-		hash, err := bcrypt.GenerateFromPassword([]byte(*request.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return web.NewRequestError(errors.Wrap(err, "hashing password"), http.StatusInternalServerError)
+		username := request.Username
+		if username == nil {
+			detail, err := r.GetById(ctx, request.ID)
+			if err != nil {
+				return err
+			}
+			username = detail.Username
+		}
+
+		var err error
+		if hashedPassword, err = r.hashPassword(ctx, request.ID, username, *request.Password); err != nil {
+			return err
 		}
-		hashedPassword := string(hash)
 		q.Set("password = ?", hashedPassword)
+		// a password set by someone else has to be changed on the next sign-in
+		q.Set("password_change_required = ?", request.ID != claims.UserId)
 	}
 	if request.Role != nil {
-		role := strings.ToUpper(*request.Role)
-		if (role != "STUDENT") && (role != "EMPLOYEE") {
-			return web.NewRequestError(errors.New("incorrect role. role should be STUDENT or EMPLOYEE"), http.StatusBadRequest)
+		role, err := assignRole(claims, *request.Role)
+		if err != nil {
+			return err
 		}
 		q.Set("role = ?", role)
 	}
@@ -383,15 +983,285 @@ func (r Repository) UpdateColumns(ctx context.Context, request UpdateRequest) er
 
 	q.Set("updated_at = ?", time.Now())
 	q.Set("updated_by = ?", claims.UserId)
+	q.Set("updated_by_actor = ?", claims.Actor())
 
-	_, err = q.Exec(ctx)
+	result, err := q.Exec(ctx)
 	if err != nil {
 		return web.NewRequestError(errors.Wrap(err, "updating user"), http.StatusBadRequest)
 	}
 
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	if hashedPassword == "" {
+		return nil
+	}
+
+	return r.addPasswordHistory(ctx, request.ID, hashedPassword)
+}
+
+// SetStatus changes the status of the user. Reason and Until belong to the
+// status, they are cleared when the user is made active.
+func (r Repository) SetStatus(ctx context.Context, request SetStatusRequest) error {
+	claims, err := r.CheckClaims(ctx, auth.PermUserStatus)
+	if err != nil {
+		return err
+	}
+
+	if err = r.ValidateStruct(&request, "ID", "Status"); err != nil {
+		return err
+	}
+
+	status := strings.ToUpper(*request.Status)
+	if !validStatus(status) || status == entity.UserStatusPending {
+		return web.NewRequestError(errors.New("incorrect status. status should be ACTIVE, BLOCKED, GRADUATED or ON_LEAVE"), http.StatusBadRequest)
+	}
+
+	if request.ID == claims.UserId && status != entity.UserStatusActive {
+		return web.NewRequestError(errors.New("can not change your own status"), http.StatusBadRequest)
+	}
+
+	detail, err := r.GetById(ctx, request.ID)
+	if err != nil {
+		return err
+	}
+
+	// pending users become active by accepting their invitation
+	if detail.Status == entity.UserStatusPending {
+		return web.NewRequestError(errors.New("user has not accepted the invitation"), http.StatusBadRequest)
+	}
+
+	var until *time.Time
+	if request.Until != nil && status != entity.UserStatusActive {
+		date, err := time.Parse("02.01.2006", *request.Until)
+		if err != nil {
+			return web.NewRequestError(errors.New("invalid until format"), http.StatusBadRequest)
+		}
+
+		if date.AddDate(0, 0, 1).Before(time.Now()) {
+			return web.NewRequestError(errors.New("until must not be in the past"), http.StatusBadRequest)
+		}
+		until = &date
+	}
+
+	reason := request.Reason
+	if status == entity.UserStatusActive {
+		reason = nil
+	}
+
+	result, err := r.NewUpdate().
+		Table("users").
+		Where("deleted_at IS NULL AND id = ?", request.ID).
+		Set("status = ?", status).
+		Set("status_reason = ?", reason).
+		Set("status_until = ?", until).
+		Set("updated_at = ?", time.Now()).
+		Set("updated_by = ?", claims.UserId).
+		Set("updated_by_actor = ?", claims.Actor()).
+		Exec(ctx)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "updating user status"), http.StatusBadRequest)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
 	return nil
 }
 
 func (r Repository) Delete(ctx context.Context, id int) error {
-	return r.DeleteRow(ctx, "users", id)
+	return r.DeleteRow(ctx, "users", id, auth.PermUserDelete)
+}
+
+// GetDepartments returns the departments the user is assigned to.
+func (r Repository) GetDepartments(ctx context.Context, userID int) ([]DepartmentResponse, error) {
+	_, err := r.CheckClaims(ctx, auth.PermUserRead)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			ud.department_id,
+			d.name->>'%s',
+			ud.is_head
+		FROM user_departments AS ud
+		JOIN users AS u ON u.id = ud.user_id
+		JOIN department AS d ON d.id = ud.department_id
+		WHERE ud.user_id = %d AND u.deleted_at IS NULL AND d.deleted_at IS NULL
+		ORDER BY ud.department_id
+	`, r.GetLang(ctx), userID)
+
+	rows, err := r.QueryContext(ctx, query)
+	if err != nil {
+		return nil, web.NewRequestError(errors.Wrap(err, "selecting user departments"), http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	list := make([]DepartmentResponse, 0)
+
+	for rows.Next() {
+		var detail DepartmentResponse
+		if err = rows.Scan(&detail.DepartmentID, &detail.DepartmentName, &detail.IsHead); err != nil {
+			return nil, web.NewRequestError(errors.Wrap(err, "scanning user departments"), http.StatusInternalServerError)
+		}
+
+		list = append(list, detail)
+	}
+
+	return list, nil
+}
+
+// SetDepartments replaces the departments the user is assigned to. The
+// assignments define the row-level scope of the user and of the heads of the
+// departments.
+func (r Repository) SetDepartments(ctx context.Context, request SetDepartmentsRequest) error {
+	_, err := r.CheckClaims(ctx, auth.PermStaffManage)
+	if err != nil {
+		return err
+	}
+
+	if err = r.checkUser(ctx, request.UserID); err != nil {
+		return err
+	}
+
+	tx, err := r.BeginTx(ctx, nil)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "beginning transaction"), http.StatusInternalServerError)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_departments WHERE user_id = ?`, request.UserID); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting user departments"), http.StatusInternalServerError)
+	}
+
+	for _, d := range request.Departments {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO user_departments (user_id, department_id, is_head)
+			SELECT ?, id, ? FROM department WHERE id = ? AND deleted_at IS NULL
+			ON CONFLICT (user_id, department_id) DO UPDATE SET is_head = EXCLUDED.is_head
+		`, request.UserID, d.IsHead, d.DepartmentID)
+		if err != nil {
+			return web.NewRequestError(errors.Wrap(err, "creating user departments"), http.StatusInternalServerError)
+		}
+
+		if n, _ := result.RowsAffected(); n == 0 {
+			return web.NewRequestError(errors.Errorf("department %d not found", d.DepartmentID), http.StatusBadRequest)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "committing user departments"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// checkUser returns a 404 if the user does not exist or is out of the scope
+// of the context.
+func (r Repository) checkUser(ctx context.Context, id int) error {
+	exists, err := r.NewSelect().Table("users").Where("id = ? AND deleted_at IS NULL", id).Exists(ctx)
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "user check"), http.StatusInternalServerError)
+	}
+	if !exists {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	return nil
+}
+
+// checkTarget is checkUser for changes of the user. Only users whose role the
+// claims may assign can be changed, so nobody takes over an account above
+// their own. Users change themselves through the routes of the current user.
+func (r Repository) checkTarget(ctx context.Context, claims auth.Claims, id int) error {
+	var role string
+	err := r.QueryRowContext(ctx, `SELECT role FROM users WHERE id = ? AND deleted_at IS NULL`, id).Scan(&role)
+	if err == sql.ErrNoRows {
+		return web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "user check"), http.StatusInternalServerError)
+	}
+
+	if id != claims.UserId && !claims.CanAssignRole(role) {
+		return web.NewRequestError(errors.Errorf("not allowed to change users with the role %s", role), http.StatusForbidden)
+	}
+
+	return nil
+}
+
+// assignRole returns the role in upper case after checking that it is valid
+// and that the claims may give it.
+func assignRole(claims auth.Claims, role string) (string, error) {
+	role = strings.ToUpper(role)
+	if !auth.ValidRole(role) {
+		return "", web.NewRequestError(errors.New("incorrect role. role should be ADMIN, EMPLOYEE or STUDENT"), http.StatusBadRequest)
+	}
+
+	if !claims.CanAssignRole(role) {
+		return "", web.NewRequestError(errors.Errorf("not allowed to assign the role %s", role), http.StatusForbidden)
+	}
+
+	return role, nil
+}
+
+func (r Repository) checkPhone(ctx context.Context, phone string, id int) error {
+	if phone == "" {
+		return web.NewRequestError(errors.New("invalid phone"), http.StatusBadRequest)
+	}
+
+	exists, err := r.NewSelect().
+		Table("users").
+		Where("phone = ? AND deleted_at IS NULL AND id != ?", phone, id).
+		Exists(postgresql.Unscoped(ctx))
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "phone check"), http.StatusInternalServerError)
+	}
+	if exists {
+		return web.NewRequestError(errors.New("phone is used"), http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// GetCounts returns the number of users by role and status. It is read by
+// the metrics, so it does not check the claims of the context.
+func (r Repository) GetCounts(ctx context.Context) ([]CountResponse, error) {
+	rows, err := r.QueryContext(ctx, fmt.Sprintf(`
+		SELECT coalesce(role::text, ''), %[1]s, count(*)
+		FROM users
+		WHERE deleted_at IS NULL
+		GROUP BY 1, 2
+	`, fmt.Sprintf(statusQuery, "")))
+	if err != nil {
+		return nil, web.NewRequestError(errors.Wrap(err, "selecting user counts"), http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	list := make([]CountResponse, 0)
+
+	for rows.Next() {
+		var detail CountResponse
+		if err = rows.Scan(&detail.Role, &detail.Status, &detail.Count); err != nil {
+			return nil, web.NewRequestError(errors.Wrap(err, "scanning user counts"), http.StatusInternalServerError)
+		}
+
+		list = append(list, detail)
+	}
+
+	return list, nil
+}
+
+// validStatus returns true if the status is one of the values of the
+// user_status enum.
+func validStatus(status string) bool {
+	switch status {
+	case entity.UserStatusActive, entity.UserStatusPending, entity.UserStatusBlocked, entity.UserStatusGraduated, entity.UserStatusOnLeave:
+		return true
+	}
+
+	return false
 }
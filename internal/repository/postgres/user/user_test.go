@@ -0,0 +1,57 @@
+package user
+
+import (
+	"net/http"
+	"testing"
+
+	"project/foundation/web"
+	"project/internal/auth"
+)
+
+func TestAssignRole(t *testing.T) {
+	employee := auth.Claims{UserId: 2, Role: auth.RoleEmployee, Permissions: []string{auth.PermUserCreate, auth.PermUserUpdate}}
+	student := auth.Claims{UserId: 3, Role: auth.RoleStudent, Permissions: []string{auth.PermUserCreate}}
+	assigner := auth.Claims{UserId: 4, Role: auth.RoleEmployee, Permissions: []string{auth.PermUserUpdate, auth.PermUserRoleAssign}}
+	admin := auth.Claims{UserId: 1, Role: auth.RoleAdmin}
+
+	tests := []struct {
+		name   string
+		claims auth.Claims
+		role   string
+		want   string
+		status int
+	}{
+		{"employee can not grant admin", employee, "ADMIN", "", http.StatusForbidden},
+		{"employee can not grant admin in lower case", employee, "admin", "", http.StatusForbidden},
+		{"employee grants employee", employee, "employee", auth.RoleEmployee, 0},
+		{"employee grants student", employee, "STUDENT", auth.RoleStudent, 0},
+		{"student can not grant employee", student, "EMPLOYEE", "", http.StatusForbidden},
+		{"student can not grant admin", student, "ADMIN", "", http.StatusForbidden},
+		{"role assign permission grants admin", assigner, "ADMIN", auth.RoleAdmin, 0},
+		{"admin grants admin", admin, "ADMIN", auth.RoleAdmin, 0},
+		{"unknown role", admin, "ROOT", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := assignRole(tt.claims, tt.role)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("assignRole() error = %v", err)
+				}
+				if got != tt.want {
+					t.Fatalf("assignRole() = %q, want %q", got, tt.want)
+				}
+				return
+			}
+
+			requestErr, ok := err.(*web.Error)
+			if !ok {
+				t.Fatalf("assignRole() error = %v, want a request error", err)
+			}
+			if requestErr.Status != tt.status {
+				t.Fatalf("assignRole() status = %d, want %d", requestErr.Status, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"project/foundation/web"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// MaxUserAttempts is how many failed sign-ins of a username lock it.
+	MaxUserAttempts = 5
+
+	// MaxIPAttempts is how many failed sign-ins from an IP lock it. It is
+	// higher than MaxUserAttempts because many users can share an IP.
+	MaxIPAttempts = 20
+
+	// AttemptWindow is how long a failed sign-in is counted.
+	AttemptWindow = 15 * time.Minute
+
+	// BaseLockout is the first lockout, every next one is twice as long up
+	// to MaxLockout.
+	BaseLockout = time.Minute
+	MaxLockout  = time.Hour
+
+	// LockoutMemory is how long lockouts are remembered for the backoff.
+	LockoutMemory = 24 * time.Hour
+)
+
+// ErrLocked is returned while a username or an IP is locked.
+var ErrLocked = errors.New("too many failed sign-in attempts, try again later")
+
+const (
+	failedPrefix   = "signin_failed:"
+	lockPrefix     = "signin_lock:"
+	lockoutsPrefix = "signin_lockouts:"
+)
+
+type Repository struct {
+	*redis.Client
+}
+
+func NewRepository(client *redis.Client) *Repository {
+	return &Repository{Client: client}
+}
+
+// Check returns ErrLocked with status 429 when the username or the IP is
+// locked.
+func (r Repository) Check(ctx context.Context, username, ip string) error {
+	n, err := r.Exists(ctx, lockPrefix+userKey(username), lockPrefix+ipKey(ip)).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "checking sign-in lock"), http.StatusInternalServerError)
+	}
+	if n > 0 {
+		return web.NewRequestError(ErrLocked, http.StatusTooManyRequests)
+	}
+
+	return nil
+}
+
+// Fail counts a failed sign-in of the username from the IP and locks either
+// of them once its limit is reached.
+func (r Repository) Fail(ctx context.Context, username, ip string) error {
+	if err := r.fail(ctx, userKey(username), MaxUserAttempts); err != nil {
+		return err
+	}
+
+	return r.fail(ctx, ipKey(ip), MaxIPAttempts)
+}
+
+// Reset forgets the failed sign-ins of the username after it signed in. The
+// counter of the IP is kept, it is shared by every username tried from it.
+func (r Repository) Reset(ctx context.Context, username string) error {
+	if err := r.Del(ctx, failedPrefix+userKey(username)).Err(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "resetting failed sign-ins"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// Unlock removes the lock of the username together with its failed sign-ins
+// and the lockouts counted for the backoff.
+func (r Repository) Unlock(ctx context.Context, username string) error {
+	key := userKey(username)
+
+	if err := r.Del(ctx, failedPrefix+key, lockPrefix+key, lockoutsPrefix+key).Err(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "unlocking user"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func (r Repository) fail(ctx context.Context, key string, max int64) error {
+	failed, err := r.Incr(ctx, failedPrefix+key).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "counting failed sign-in"), http.StatusInternalServerError)
+	}
+
+	// The window starts with the first failed sign-in.
+	if failed == 1 {
+		if err = r.Expire(ctx, failedPrefix+key, AttemptWindow).Err(); err != nil {
+			return web.NewRequestError(errors.Wrap(err, "counting failed sign-in"), http.StatusInternalServerError)
+		}
+	}
+
+	if failed < max {
+		return nil
+	}
+
+	lockouts, err := r.Incr(ctx, lockoutsPrefix+key).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "counting sign-in lockouts"), http.StatusInternalServerError)
+	}
+
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, lockoutsPrefix+key, LockoutMemory)
+		pipe.Set(ctx, lockPrefix+key, 1, backoff(lockouts))
+		pipe.Del(ctx, failedPrefix+key)
+		return nil
+	})
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "locking sign-in"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// backoff returns the duration of the nth lockout.
+func backoff(n int64) time.Duration {
+	d := BaseLockout
+	for i := int64(1); i < n && d < MaxLockout; i++ {
+		d *= 2
+	}
+	if d > MaxLockout {
+		d = MaxLockout
+	}
+
+	return d
+}
+
+func userKey(username string) string {
+	return fmt.Sprintf("user:%s", strings.ToLower(username))
+}
+
+func ipKey(ip string) string {
+	return fmt.Sprintf("ip:%s", ip)
+}
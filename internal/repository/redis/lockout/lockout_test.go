@@ -0,0 +1,168 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"project/foundation/web"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want time.Duration
+	}{
+		{n: 1, want: time.Minute},
+		{n: 2, want: 2 * time.Minute},
+		{n: 3, want: 4 * time.Minute},
+		{n: 6, want: 32 * time.Minute},
+		{n: 7, want: time.Hour},
+		{n: 100, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.n), func(t *testing.T) {
+			if got := backoff(tt.n); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockout(t *testing.T) {
+	type step struct {
+		// fails is the number of failed sign-ins of username from ip, the
+		// username is reset or unlocked after them when set.
+		username string
+		ip       string
+		fails    int
+		reset    bool
+		unlock   bool
+
+		// wait lets the time pass before the step
+		wait time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+
+		// lock is the remaining lock of ali or of ip1, 0 when neither is
+		// locked.
+		lock time.Duration
+	}{
+		{
+			name:  "below the limit",
+			steps: []step{{username: "ali", ip: "ip1", fails: MaxUserAttempts - 1}},
+		},
+		{
+			name:  "limit of the username",
+			steps: []step{{username: "ali", ip: "ip1", fails: MaxUserAttempts}},
+			lock:  BaseLockout,
+		},
+		{
+			name:  "username in another case",
+			steps: []step{{username: "Ali", ip: "ip1", fails: MaxUserAttempts}},
+			lock:  BaseLockout,
+		},
+		{
+			name: "second lockout is twice as long",
+			steps: []step{
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts},
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts, wait: BaseLockout},
+			},
+			lock: 2 * BaseLockout,
+		},
+		{
+			name: "lock expires",
+			steps: []step{
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts},
+				{wait: BaseLockout},
+			},
+		},
+		{
+			name: "failures leave the window",
+			steps: []step{
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts - 1},
+				{username: "ali", ip: "ip1", fails: 1, wait: AttemptWindow},
+			},
+		},
+		{
+			name: "reset after a sign-in",
+			steps: []step{
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts - 1, reset: true},
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts - 1},
+			},
+		},
+		{
+			name: "unlock",
+			steps: []step{
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts, unlock: true},
+				{username: "ali", ip: "ip1", fails: MaxUserAttempts},
+			},
+			// the lockouts were forgotten, the backoff starts again
+			lock: BaseLockout,
+		},
+		{
+			name:  "limit of the ip",
+			steps: []step{{username: "vali", ip: "ip1", fails: MaxIPAttempts}},
+			lock:  BaseLockout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+
+			r := NewRepository(client)
+
+			for _, s := range tt.steps {
+				server.FastForward(s.wait)
+
+				for i := 0; i < s.fails; i++ {
+					if err := r.Fail(ctx, s.username, s.ip); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if s.reset {
+					if err := r.Reset(ctx, s.username); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if s.unlock {
+					if err := r.Unlock(ctx, s.username); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			err := r.Check(ctx, "ali", "ip1")
+			if tt.lock == 0 {
+				if err != nil {
+					t.Fatalf("check: %v", err)
+				}
+				return
+			}
+
+			if webErr, ok := err.(*web.Error); !ok || webErr.Err != ErrLocked {
+				t.Fatalf("check: got %v, want %v", err, ErrLocked)
+			}
+
+			key := lockPrefix + userKey("ali")
+			if server.Exists(lockPrefix + ipKey("ip1")) {
+				key = lockPrefix + ipKey("ip1")
+			}
+			if got := server.TTL(key); got != tt.lock {
+				t.Errorf("locked for %s, want %s", got, tt.lock)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package mfa
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// MaxAttempts is how many codes can be tried with one mfa pending token.
+const MaxAttempts = 5
+
+const (
+	attemptsPrefix = "mfa_attempts:"
+	usedPrefix     = "mfa_used:"
+)
+
+// Repository limits the use of mfa pending tokens, which are identified by
+// their jti.
+type Repository struct {
+	*redis.Client
+}
+
+func NewRepository(client *redis.Client) *Repository {
+	return &Repository{Client: client}
+}
+
+// Attempt counts a code tried with the token. ttl is the remaining lifetime
+// of the token.
+func (r Repository) Attempt(ctx context.Context, tokenID string, ttl time.Duration) error {
+	used, err := r.Exists(ctx, usedPrefix+tokenID).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "checking mfa token"), http.StatusInternalServerError)
+	}
+	if used > 0 {
+		return web.NewRequestError(errors.New("mfa token was already used, sign in again"), http.StatusUnauthorized)
+	}
+
+	attempts, err := r.Incr(ctx, attemptsPrefix+tokenID).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "counting mfa attempts"), http.StatusInternalServerError)
+	}
+	if attempts == 1 {
+		r.Expire(ctx, attemptsPrefix+tokenID, ttl)
+	}
+
+	if attempts > MaxAttempts {
+		return web.NewRequestError(errors.New("too many attempts, sign in again"), http.StatusTooManyRequests)
+	}
+
+	return nil
+}
+
+// Consume marks the token as used, so it is exchanged for tokens only once.
+func (r Repository) Consume(ctx context.Context, tokenID string, ttl time.Duration) error {
+	ok, err := r.SetNX(ctx, usedPrefix+tokenID, 1, ttl).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "consuming mfa token"), http.StatusInternalServerError)
+	}
+	if !ok {
+		return web.NewRequestError(errors.New("mfa token was already used, sign in again"), http.StatusUnauthorized)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// StateTTL is how long a user has to sign in at the provider.
+const StateTTL = 10 * time.Minute
+
+const statePrefix = "oidc_state:"
+
+// ErrInvalidState is returned for unknown, expired and used states.
+var ErrInvalidState = errors.New("sign-in is expired or was already completed, start again")
+
+// State is what the callback of a started sign-in needs.
+type State struct {
+	Verifier string
+	Nonce    string
+}
+
+type Repository struct {
+	*redis.Client
+}
+
+func NewRepository(client *redis.Client) *Repository {
+	return &Repository{Client: client}
+}
+
+// Create stores the state of a started sign-in.
+func (r Repository) Create(ctx context.Context, state string, request State) error {
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, statePrefix+state, "verifier", request.Verifier, "nonce", request.Nonce)
+		pipe.Expire(ctx, statePrefix+state, StateTTL)
+		return nil
+	})
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "storing oidc state"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// Consume returns the state and deletes it, so a state completes one
+// sign-in.
+func (r Repository) Consume(ctx context.Context, state string) (State, error) {
+	var values *redis.MapStringStringCmd
+	var deleted *redis.IntCmd
+
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.HGetAll(ctx, statePrefix+state)
+		deleted = pipe.Del(ctx, statePrefix+state)
+		return nil
+	})
+	if err != nil {
+		return State{}, web.NewRequestError(errors.Wrap(err, "consuming oidc state"), http.StatusInternalServerError)
+	}
+
+	if deleted.Val() == 0 {
+		return State{}, web.NewRequestError(ErrInvalidState, http.StatusBadRequest)
+	}
+
+	return State{
+		Verifier: values.Val()["verifier"],
+		Nonce:    values.Val()["nonce"],
+	}, nil
+}
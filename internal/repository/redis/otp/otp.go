@@ -0,0 +1,137 @@
+package otp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"project/foundation/web"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// CodeTTL is how long a sent code can be used.
+	CodeTTL = 5 * time.Minute
+
+	// ResendInterval is how long a phone has to wait before a new code is sent.
+	ResendInterval = time.Minute
+
+	// MaxAttempts is how many times a code can be checked before it is burned.
+	MaxAttempts = 5
+)
+
+const (
+	codePrefix = "sms_code:"
+	sentPrefix = "sms_code_sent:"
+)
+
+type Repository struct {
+	*redis.Client
+}
+
+func NewRepository(client *redis.Client) *Repository {
+	return &Repository{Client: client}
+}
+
+// Throttle reports whether a code can be sent to the phone, at most one code
+// is sent per ResendInterval. It is checked for every phone, known or not, so
+// the timing does not tell which phones belong to users.
+func (r Repository) Throttle(ctx context.Context, phone string) (bool, error) {
+	ok, err := r.SetNX(ctx, sentPrefix+phone, 1, ResendInterval).Result()
+	if err != nil {
+		return false, web.NewRequestError(errors.Wrap(err, "checking sms code resend"), http.StatusInternalServerError)
+	}
+
+	return ok, nil
+}
+
+// Create stores the code for the phone, replacing the previous one. Only a
+// hash of the code is kept. The caller throttles the codes with Throttle.
+func (r Repository) Create(ctx context.Context, phone, code string) error {
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, codePrefix+phone)
+		pipe.HSet(ctx, codePrefix+phone, "hash", hash(code), "attempts", 0)
+		pipe.Expire(ctx, codePrefix+phone, CodeTTL)
+		return nil
+	})
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "storing sms code"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// checkScript counts an attempt on the code of KEYS[1] and returns "ok" with
+// the stored hash, "exceeded" when the attempt is over ARGV[1], which deletes
+// the code, and nothing when there is no code. The attempt is counted only on
+// an existing code, so it is not recreated without its TTL.
+var checkScript = redis.NewScript(`
+local stored = redis.call("HGET", KEYS[1], "hash")
+if not stored then
+	return {}
+end
+
+if redis.call("HINCRBY", KEYS[1], "attempts", 1) > tonumber(ARGV[1]) then
+	redis.call("DEL", KEYS[1])
+	return {"exceeded"}
+end
+
+return {"ok", stored}
+`)
+
+// consumeScript deletes the code of KEYS[1] if its hash is ARGV[1] and
+// returns whether it did.
+var consumeScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "hash") == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+
+return 0
+`)
+
+// Check compares the code with the one sent to the phone. Every check counts
+// as an attempt, the code is deleted once MaxAttempts is reached. A checked
+// code stays valid until Consume.
+func (r Repository) Check(ctx context.Context, phone, code string) error {
+	values, err := checkScript.Run(ctx, r.Client, []string{codePrefix + phone}, MaxAttempts).StringSlice()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "checking sms code"), http.StatusInternalServerError)
+	}
+
+	switch {
+	case len(values) == 0:
+		return web.NewRequestError(errors.New("code is expired or was not sent"), http.StatusBadRequest)
+	case values[0] == "exceeded":
+		return web.NewRequestError(errors.New("too many attempts, request a new code"), http.StatusTooManyRequests)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(values[1]), []byte(hash(code))) != 1 {
+		return web.NewRequestError(errors.New("incorrect code"), http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// Consume deletes the code of the phone once it passed Check, it does not
+// count as an attempt. Only one caller is able to delete the code, so a code
+// is consumed once, and a code replaced in the meantime is not consumed.
+func (r Repository) Consume(ctx context.Context, phone, code string) error {
+	deleted, err := consumeScript.Run(ctx, r.Client, []string{codePrefix + phone}, hash(code)).Int()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting sms code"), http.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return web.NewRequestError(errors.New("code is expired or was not sent"), http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func hash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,134 @@
+package otp
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCheck(t *testing.T) {
+	const phone = "998901234567"
+
+	type step struct {
+		// consume consumes the code instead of checking it.
+		consume bool
+		code    string
+
+		// status is the status of the error, 0 for none.
+		status int
+	}
+
+	check := func(code string, status int) step { return step{code: code, status: status} }
+	consume := func(code string, status int) step { return step{consume: true, code: code, status: status} }
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "correct code",
+			steps: []step{check("123456", 0), consume("123456", 0), check("123456", http.StatusBadRequest)},
+		},
+		{
+			name:  "checked code stays valid until consumed",
+			steps: []step{check("123456", 0), check("123456", 0), consume("123456", 0)},
+		},
+		{
+			name:  "incorrect code",
+			steps: []step{check("000000", http.StatusBadRequest), check("123456", 0)},
+		},
+		{
+			name:  "code is consumed once",
+			steps: []step{check("123456", 0), consume("123456", 0), consume("123456", http.StatusBadRequest)},
+		},
+		{
+			name:  "other code is not consumed",
+			steps: []step{consume("000000", http.StatusBadRequest), consume("123456", 0)},
+		},
+		{
+			name: "too many attempts",
+			steps: []step{
+				check("000000", http.StatusBadRequest),
+				check("000000", http.StatusBadRequest),
+				check("000000", http.StatusBadRequest),
+				check("000000", http.StatusBadRequest),
+				check("000000", http.StatusBadRequest),
+				check("123456", http.StatusTooManyRequests),
+				check("123456", http.StatusBadRequest),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+
+			r := NewRepository(client)
+
+			if err := r.Create(ctx, phone, "123456"); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range tt.steps {
+				var err error
+				if s.consume {
+					err = r.Consume(ctx, phone, s.code)
+				} else {
+					err = r.Check(ctx, phone, s.code)
+				}
+
+				if got := status(err); got != s.status {
+					t.Fatalf("step %d: status %d, want %d, error %v", i, got, s.status, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckExpired(t *testing.T) {
+	const phone = "998901234567"
+
+	ctx := context.Background()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	r := NewRepository(client)
+
+	if err := r.Create(ctx, phone, "123456"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.FastForward(CodeTTL)
+
+	if err := r.Check(ctx, phone, "123456"); status(err) != http.StatusBadRequest {
+		t.Fatalf("checking an expired code: %v", err)
+	}
+
+	// the attempt is not counted on an expired code, so no code without a
+	// TTL is left behind
+	if server.Exists(codePrefix + phone) {
+		t.Errorf("expired code is stored again with the TTL %s", server.TTL(codePrefix+phone))
+	}
+}
+
+func status(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if webErr, ok := err.(*web.Error); ok {
+		return webErr.Status
+	}
+
+	return http.StatusInternalServerError
+}
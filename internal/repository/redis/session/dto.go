@@ -0,0 +1,34 @@
+package session
+
+import "time"
+
+type Token struct {
+	Family  string
+	TokenID string
+	UserID  int
+}
+
+type CreateRequest struct {
+	Family    string
+	TokenID   string
+	UserID    int
+	UserAgent string
+	IP        string
+	TTL       time.Duration
+}
+
+type RotateRequest struct {
+	TokenID    string
+	NewTokenID string
+	UserID     int
+	TTL        time.Duration
+}
+
+type GetListResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
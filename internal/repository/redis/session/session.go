@@ -0,0 +1,321 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrTokenNotFound is used when a refresh token is unknown or already expired.
+	ErrTokenNotFound = errors.New("refresh token not found")
+
+	// ErrTokenReused occurs when a refresh token that was already rotated is
+	// presented again. The whole token family is revoked in that case.
+	ErrTokenReused = errors.New("refresh token reuse detected")
+
+	// ErrSessionRevoked is used when the session of a token was ended.
+	ErrSessionRevoked = errors.New("session is revoked")
+)
+
+// A session is a family of refresh tokens created by one sign-in. Every
+// refresh rotates the token: the presented jti is consumed and a new one is
+// added to the same family. The id of the session is the id of the family
+// and is carried by both tokens in the sid claim.
+const (
+	tokenPrefix       = "refresh_token:"
+	usedPrefix        = "refresh_token_used:"
+	familyPrefix      = "refresh_family:"
+	sessionPrefix     = "session:"
+	userSessionPrefix = "user_sessions:"
+)
+
+type Repository struct {
+	*redis.Client
+}
+
+func NewRepository(client *redis.Client) *Repository {
+	return &Repository{Client: client}
+}
+
+// Create stores a new session with its first refresh token.
+func (r Repository) Create(ctx context.Context, request CreateRequest) error {
+	now := time.Now().Unix()
+
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionPrefix+request.Family,
+			"user_id", request.UserID,
+			"user_agent", request.UserAgent,
+			"ip", request.IP,
+			"created_at", now,
+			"last_used_at", now,
+		)
+		pipe.Expire(ctx, sessionPrefix+request.Family, request.TTL)
+		pipe.SAdd(ctx, userSessionPrefix+strconv.Itoa(request.UserID), request.Family)
+		pipe.Expire(ctx, userSessionPrefix+strconv.Itoa(request.UserID), request.TTL)
+		return nil
+	})
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "storing session"), http.StatusInternalServerError)
+	}
+
+	if err = r.addToken(ctx, request.Family, request.TokenID, request.UserID, request.TTL); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "storing refresh token"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// consumeScript deletes the refresh token of KEYS[1] and marks it as used in
+// KEYS[2] for ARGV[1] milliseconds. It returns the family and the user of the
+// token, the family of the used token with "used" first when it was consumed
+// before, and nothing when it is unknown. The token is read, deleted and
+// marked in one step, so of concurrent refreshes with the same token only one
+// consumes it, the others see the mark.
+var consumeScript = redis.NewScript(`
+local family = redis.call("HGET", KEYS[1], "family")
+if not family then
+	local used = redis.call("GET", KEYS[2])
+	if used then
+		return {"used", used}
+	end
+	return {}
+end
+
+local userID = redis.call("HGET", KEYS[1], "user_id") or ""
+redis.call("DEL", KEYS[1])
+redis.call("SET", KEYS[2], family, "PX", ARGV[1])
+return {family, userID}
+`)
+
+// extendScript stores the refresh token of KEYS[3] in the family of KEYS[4]
+// and extends the session of KEYS[1] and the sessions of the user of KEYS[2]
+// by ARGV[1] milliseconds. It returns 0 without a change when the session
+// ended, a session revoked during a refresh is not brought back.
+var extendScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+
+redis.call("HSET", KEYS[1], "last_used_at", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+redis.call("PEXPIRE", KEYS[2], ARGV[1])
+redis.call("HSET", KEYS[3], "family", ARGV[3], "user_id", ARGV[4])
+redis.call("PEXPIRE", KEYS[3], ARGV[1])
+redis.call("SADD", KEYS[4], ARGV[5])
+redis.call("PEXPIRE", KEYS[4], ARGV[1])
+return 1
+`)
+
+// Rotate consumes the refresh token with the given jti and stores newTokenID
+// in its family. Presenting a consumed token revokes the family.
+func (r Repository) Rotate(ctx context.Context, request RotateRequest) (Token, error) {
+	keys := []string{tokenPrefix + request.TokenID, usedPrefix + request.TokenID}
+
+	values, err := consumeScript.Run(ctx, r.Client, keys, request.TTL.Milliseconds()).StringSlice()
+	if err != nil {
+		return Token{}, web.NewRequestError(errors.Wrap(err, "consuming refresh token"), http.StatusInternalServerError)
+	}
+
+	if len(values) == 0 {
+		return Token{}, web.NewRequestError(ErrTokenNotFound, http.StatusUnauthorized)
+	}
+
+	if values[0] == "used" {
+		if err = r.Revoke(ctx, values[1]); err != nil {
+			return Token{}, err
+		}
+
+		return Token{}, web.NewRequestError(ErrTokenReused, http.StatusUnauthorized)
+	}
+
+	token := Token{
+		Family:  values[0],
+		TokenID: request.TokenID,
+	}
+	if token.UserID, err = strconv.Atoi(values[1]); err != nil {
+		return Token{}, web.NewRequestError(errors.Wrap(err, "parsing refresh token user"), http.StatusInternalServerError)
+	}
+
+	if token.UserID != request.UserID {
+		if err = r.Revoke(ctx, token.Family); err != nil {
+			return Token{}, err
+		}
+
+		return Token{}, web.NewRequestError(errors.New("refresh token user mismatch"), http.StatusUnauthorized)
+	}
+
+	keys = []string{
+		sessionPrefix + token.Family,
+		userSessionPrefix + strconv.Itoa(token.UserID),
+		tokenPrefix + request.NewTokenID,
+		familyPrefix + token.Family,
+	}
+	extended, err := extendScript.Run(ctx, r.Client, keys, request.TTL.Milliseconds(), time.Now().Unix(), token.Family, token.UserID, request.NewTokenID).Int()
+	if err != nil {
+		return Token{}, web.NewRequestError(errors.Wrap(err, "storing refresh token"), http.StatusInternalServerError)
+	}
+	if extended == 0 {
+		return Token{}, web.NewRequestError(ErrSessionRevoked, http.StatusUnauthorized)
+	}
+
+	token.TokenID = request.NewTokenID
+
+	return token, nil
+}
+
+// GetList returns the active sessions of the user.
+func (r Repository) GetList(ctx context.Context, userID int) ([]GetListResponse, error) {
+	key := userSessionPrefix + strconv.Itoa(userID)
+
+	ids, err := r.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, web.NewRequestError(errors.Wrap(err, "getting user sessions"), http.StatusInternalServerError)
+	}
+
+	list := make([]GetListResponse, 0, len(ids))
+
+	for _, id := range ids {
+		values, err := r.HGetAll(ctx, sessionPrefix+id).Result()
+		if err != nil {
+			return nil, web.NewRequestError(errors.Wrap(err, "getting session"), http.StatusInternalServerError)
+		}
+
+		// The session expired, forget it.
+		if len(values) == 0 {
+			r.SRem(ctx, key, id)
+			continue
+		}
+
+		detail := GetListResponse{
+			ID:        id,
+			UserAgent: values["user_agent"],
+			IP:        values["ip"],
+		}
+		if createdAt, err := strconv.ParseInt(values["created_at"], 10, 64); err == nil {
+			detail.CreatedAt = time.Unix(createdAt, 0)
+		}
+		if lastUsedAt, err := strconv.ParseInt(values["last_used_at"], 10, 64); err == nil {
+			detail.LastUsedAt = time.Unix(lastUsedAt, 0)
+		}
+
+		list = append(list, detail)
+	}
+
+	return list, nil
+}
+
+// RevokeForUser ends the session only if it belongs to the user.
+func (r Repository) RevokeForUser(ctx context.Context, userID int, id string) error {
+	owner, err := r.HGet(ctx, sessionPrefix+id, "user_id").Result()
+	if err == redis.Nil || (err == nil && owner != strconv.Itoa(userID)) {
+		return web.NewRequestError(errors.New("session not found"), http.StatusNotFound)
+	}
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "getting session"), http.StatusInternalServerError)
+	}
+
+	return r.Revoke(ctx, id)
+}
+
+// RevokeAll ends every session of the user.
+func (r Repository) RevokeAll(ctx context.Context, userID int) error {
+	ids, err := r.SMembers(ctx, userSessionPrefix+strconv.Itoa(userID)).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "getting user sessions"), http.StatusInternalServerError)
+	}
+
+	for _, id := range ids {
+		if err = r.Revoke(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokeOthers ends every session of the user except the one with the id.
+func (r Repository) RevokeOthers(ctx context.Context, userID int, id string) error {
+	ids, err := r.SMembers(ctx, userSessionPrefix+strconv.Itoa(userID)).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "getting user sessions"), http.StatusInternalServerError)
+	}
+
+	for _, sessionID := range ids {
+		if sessionID == id {
+			continue
+		}
+
+		if err = r.Revoke(ctx, sessionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Revoke ends the session and deletes every refresh token of its family.
+func (r Repository) Revoke(ctx context.Context, id string) error {
+	tokens, err := r.SMembers(ctx, familyPrefix+id).Result()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "getting refresh token family"), http.StatusInternalServerError)
+	}
+
+	owner, err := r.HGet(ctx, sessionPrefix+id, "user_id").Result()
+	if err != nil && err != redis.Nil {
+		return web.NewRequestError(errors.Wrap(err, "getting session"), http.StatusInternalServerError)
+	}
+
+	keys := []string{familyPrefix + id, sessionPrefix + id}
+	for _, t := range tokens {
+		keys = append(keys, tokenPrefix+t)
+	}
+
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		if owner != "" {
+			pipe.SRem(ctx, userSessionPrefix+owner, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "revoking session"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// Verify is an auth.ClaimsVerifier rejecting tokens of ended sessions.
+func (r Repository) Verify(ctx context.Context, claims auth.Claims) error {
+	if claims.SessionID == "" {
+		return ErrSessionRevoked
+	}
+
+	exists, err := r.Exists(ctx, sessionPrefix+claims.SessionID).Result()
+	if err != nil {
+		return errors.Wrap(err, "checking session")
+	}
+	if exists == 0 {
+		return ErrSessionRevoked
+	}
+
+	return nil
+}
+
+func (r Repository) addToken(ctx context.Context, family, tokenID string, userID int, ttl time.Duration) error {
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, tokenPrefix+tokenID, "family", family, "user_id", userID)
+		pipe.Expire(ctx, tokenPrefix+tokenID, ttl)
+		pipe.SAdd(ctx, familyPrefix+family, tokenID)
+		pipe.Expire(ctx, familyPrefix+family, ttl)
+		return nil
+	})
+
+	return err
+}
@@ -0,0 +1,296 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"project/foundation/web"
+	"project/internal/auth"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRotate(t *testing.T) {
+	const ttl = time.Hour
+
+	tests := []struct {
+		name string
+
+		// rotations are done before the checked one, each one rotates the
+		// token to the next id.
+		rotations []RotateRequest
+		rotate    RotateRequest
+
+		err error
+
+		// revoked is set when the family has to be revoked after the
+		// rotation.
+		revoked bool
+	}{
+		{
+			name:   "first token",
+			rotate: RotateRequest{TokenID: "t1", NewTokenID: "t2", UserID: 1, TTL: ttl},
+		},
+		{
+			name:      "rotated token",
+			rotations: []RotateRequest{{TokenID: "t1", NewTokenID: "t2", UserID: 1, TTL: ttl}},
+			rotate:    RotateRequest{TokenID: "t2", NewTokenID: "t3", UserID: 1, TTL: ttl},
+		},
+		{
+			name:   "unknown token",
+			rotate: RotateRequest{TokenID: "other", NewTokenID: "t2", UserID: 1, TTL: ttl},
+			err:    ErrTokenNotFound,
+		},
+		{
+			name:      "reused token",
+			rotations: []RotateRequest{{TokenID: "t1", NewTokenID: "t2", UserID: 1, TTL: ttl}},
+			rotate:    RotateRequest{TokenID: "t1", NewTokenID: "t3", UserID: 1, TTL: ttl},
+			err:       ErrTokenReused,
+			revoked:   true,
+		},
+		{
+			name: "reused token after further rotations",
+			rotations: []RotateRequest{
+				{TokenID: "t1", NewTokenID: "t2", UserID: 1, TTL: ttl},
+				{TokenID: "t2", NewTokenID: "t3", UserID: 1, TTL: ttl},
+			},
+			rotate:  RotateRequest{TokenID: "t2", NewTokenID: "t4", UserID: 1, TTL: ttl},
+			err:     ErrTokenReused,
+			revoked: true,
+		},
+		{
+			name:    "token of another user",
+			rotate:  RotateRequest{TokenID: "t1", NewTokenID: "t2", UserID: 2, TTL: ttl},
+			revoked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := newRepository(t)
+
+			err := r.Create(ctx, CreateRequest{Family: "f1", TokenID: "t1", UserID: 1, TTL: ttl})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// another session of the user is not touched by the rotations
+			err = r.Create(ctx, CreateRequest{Family: "f2", TokenID: "other-1", UserID: 1, TTL: ttl})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, rotation := range tt.rotations {
+				if _, err = r.Rotate(ctx, rotation); err != nil {
+					t.Fatalf("rotating %s: %v", rotation.TokenID, err)
+				}
+			}
+
+			token, err := r.Rotate(ctx, tt.rotate)
+			switch {
+			case tt.err != nil && cause(err) != tt.err:
+				t.Fatalf("got %v, want %v", err, tt.err)
+			case tt.err == nil && !tt.revoked && err != nil:
+				t.Fatalf("rotating: %v", err)
+			case tt.err == nil && tt.revoked && err == nil:
+				t.Fatal("rotating: got no error")
+			}
+
+			if tt.err == nil && !tt.revoked {
+				want := Token{Family: "f1", TokenID: tt.rotate.NewTokenID, UserID: 1}
+				if token != want {
+					t.Errorf("got %+v, want %+v", token, want)
+				}
+			}
+
+			sessions, err := r.GetList(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			active := make(map[string]bool)
+			for _, s := range sessions {
+				active[s.ID] = true
+			}
+			if active["f1"] == tt.revoked {
+				t.Errorf("session f1 active %v, want %v", active["f1"], !tt.revoked)
+			}
+			if !active["f2"] {
+				t.Error("session f2 was revoked")
+			}
+
+			// no token of a revoked family can be rotated again
+			if tt.revoked {
+				for _, id := range []string{"t1", "t2", "t3", "t4"} {
+					if _, err = r.Rotate(ctx, RotateRequest{TokenID: id, NewTokenID: id + "-new", UserID: 1, TTL: ttl}); err == nil {
+						t.Errorf("token %s of the revoked family was rotated", id)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRotateConcurrentReuse(t *testing.T) {
+	const (
+		ttl       = time.Hour
+		refreshes = 10
+	)
+
+	ctx := context.Background()
+	r := newRepository(t)
+
+	if err := r.Create(ctx, CreateRequest{Family: "f1", TokenID: "t1", UserID: 1, TTL: ttl}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, refreshes)
+	for i := 0; i < refreshes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = r.Rotate(ctx, RotateRequest{TokenID: "t1", NewTokenID: fmt.Sprintf("t2-%d", i), UserID: 1, TTL: ttl})
+		}(i)
+	}
+	wg.Wait()
+
+	// one refresh rotates the token, every other one is reuse and revokes
+	// the family, none of them finds the token missing
+	rotated := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			rotated++
+		case cause(err) != ErrTokenReused:
+			t.Errorf("got %v, want %v", err, ErrTokenReused)
+		}
+	}
+	if rotated != 1 {
+		t.Errorf("token rotated %d times, want once", rotated)
+	}
+
+	sessions, err := r.GetList(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("sessions %+v are active, want the family revoked", sessions)
+	}
+
+	for i := 0; i < refreshes; i++ {
+		id := fmt.Sprintf("t2-%d", i)
+		if _, err = r.Rotate(ctx, RotateRequest{TokenID: id, NewTokenID: id + "-new", UserID: 1, TTL: ttl}); err == nil {
+			t.Errorf("token %s of the revoked family was rotated", id)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(ctx context.Context, r *Repository) error
+
+		err    error
+		active []string
+	}{
+		{
+			name:   "logout",
+			revoke: func(ctx context.Context, r *Repository) error { return r.Revoke(ctx, "f1") },
+			active: []string{"f2", "f3"},
+		},
+		{
+			name:   "session of the user",
+			revoke: func(ctx context.Context, r *Repository) error { return r.RevokeForUser(ctx, 1, "f2") },
+			active: []string{"f1", "f3"},
+		},
+		{
+			name:   "session of another user",
+			revoke: func(ctx context.Context, r *Repository) error { return r.RevokeForUser(ctx, 2, "f1") },
+			err:    errors.New("session not found"),
+			active: []string{"f1", "f2", "f3"},
+		},
+		{
+			name:   "other sessions",
+			revoke: func(ctx context.Context, r *Repository) error { return r.RevokeOthers(ctx, 1, "f2") },
+			active: []string{"f2", "f3"},
+		},
+		{
+			name:   "every session",
+			revoke: func(ctx context.Context, r *Repository) error { return r.RevokeAll(ctx, 1) },
+			active: []string{"f3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := newRepository(t)
+
+			// f1 and f2 are sessions of user 1, f3 of user 2
+			sessions := []CreateRequest{
+				{Family: "f1", TokenID: "t1", UserID: 1, TTL: time.Hour},
+				{Family: "f2", TokenID: "t2", UserID: 1, TTL: time.Hour},
+				{Family: "f3", TokenID: "t3", UserID: 2, TTL: time.Hour},
+			}
+			for _, s := range sessions {
+				if err := r.Create(ctx, s); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := tt.revoke(ctx, r)
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("revoking: %v", err)
+			case tt.err != nil && (err == nil || cause(err).Error() != tt.err.Error()):
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+
+			active := make(map[string]bool)
+			for _, family := range tt.active {
+				active[family] = true
+			}
+
+			for _, s := range sessions {
+				err := r.Verify(ctx, auth.Claims{UserId: s.UserID, SessionID: s.Family})
+				if active[s.Family] && err != nil {
+					t.Errorf("token of session %s rejected: %v", s.Family, err)
+				}
+				if !active[s.Family] && err != ErrSessionRevoked {
+					t.Errorf("token of session %s: got %v, want %v", s.Family, err, ErrSessionRevoked)
+				}
+
+				// the refresh token of an ended session can not be rotated
+				_, err = r.Rotate(ctx, RotateRequest{TokenID: s.TokenID, NewTokenID: s.TokenID + "-new", UserID: s.UserID, TTL: time.Hour})
+				if active[s.Family] != (err == nil) {
+					t.Errorf("rotating the token of session %s: %v", s.Family, err)
+				}
+			}
+		})
+	}
+}
+
+func newRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRepository(client)
+}
+
+// cause returns the error wrapped by a web.Error.
+func cause(err error) error {
+	if webErr, ok := err.(*web.Error); ok {
+		return errors.Cause(webErr.Err)
+	}
+
+	return errors.Cause(err)
+}
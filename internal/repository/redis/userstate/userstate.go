@@ -0,0 +1,93 @@
+package userstate
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// StateTTL is how long a state is cached. Changes made without invalidating
+// the cache, e.g. in the database directly, are seen after it.
+const StateTTL = 30 * time.Second
+
+const statePrefix = "user_state:"
+
+// State is the part of a user that decides whether its tokens are accepted.
+type State struct {
+	Role    string
+	Status  string
+	Deleted bool
+
+	// Permissions are the permissions of the role.
+	Permissions []string
+}
+
+type Repository struct {
+	*redis.Client
+}
+
+func NewRepository(client *redis.Client) *Repository {
+	return &Repository{Client: client}
+}
+
+// Get returns the cached state of the user, ok is false when it is not
+// cached.
+func (r Repository) Get(ctx context.Context, userID int) (state State, ok bool, err error) {
+	values, err := r.HGetAll(ctx, key(userID)).Result()
+	if err != nil {
+		return State{}, false, web.NewRequestError(errors.Wrap(err, "getting user state"), http.StatusInternalServerError)
+	}
+
+	if len(values) == 0 {
+		return State{}, false, nil
+	}
+
+	state = State{
+		Role:    values["role"],
+		Status:  values["status"],
+		Deleted: values["deleted"] == "1",
+	}
+	if values["permissions"] != "" {
+		state.Permissions = strings.Split(values["permissions"], ",")
+	}
+
+	return state, true, nil
+}
+
+// Set caches the state of the user for StateTTL.
+func (r Repository) Set(ctx context.Context, userID int, state State) error {
+	deleted := "0"
+	if state.Deleted {
+		deleted = "1"
+	}
+
+	_, err := r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key(userID), "role", state.Role, "status", state.Status, "deleted", deleted, "permissions", strings.Join(state.Permissions, ","))
+		pipe.Expire(ctx, key(userID), StateTTL)
+		return nil
+	})
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "storing user state"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// Delete removes the cached state, the next request reads it again.
+func (r Repository) Delete(ctx context.Context, userID int) error {
+	if err := r.Del(ctx, key(userID)).Err(); err != nil {
+		return web.NewRequestError(errors.Wrap(err, "deleting user state"), http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+func key(userID int) string {
+	return statePrefix + strconv.Itoa(userID)
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"log"
 	"project/foundation/web"
 	"project/internal/auth"
 
@@ -9,19 +10,46 @@ import (
 	"project/internal/middleware"
 	"project/internal/pkg/repository/postgresql"
 
+	"project/internal/repository/postgres/apikey"
+	"project/internal/repository/postgres/audit"
 	"project/internal/repository/postgres/department"
 	"project/internal/repository/postgres/district"
+	"project/internal/repository/postgres/mfa"
+	"project/internal/repository/postgres/permission"
 	"project/internal/repository/postgres/position"
 	"project/internal/repository/postgres/region"
 	"project/internal/repository/postgres/republic"
+	"project/internal/repository/postgres/signin"
 	"project/internal/repository/postgres/user"
 
+	"project/internal/repository/redis/lockout"
+	mfa_redis "project/internal/repository/redis/mfa"
+	oidc_redis "project/internal/repository/redis/oidc"
+	"project/internal/repository/redis/otp"
+	"project/internal/repository/redis/session"
+	userstate_redis "project/internal/repository/redis/userstate"
+	mfa_service "project/internal/service/mfa"
+	"project/internal/service/notify"
+	"project/internal/service/oidc"
+	"project/internal/service/password"
+	"project/internal/service/sms"
+	"project/internal/service/token"
+	"project/internal/service/userstate"
+
+	apikey_controller "project/internal/controller/http/v1/apikey"
+	audit_controller "project/internal/controller/http/v1/audit"
 	auth_controller "project/internal/controller/http/v1/auth"
 	department_controller "project/internal/controller/http/v1/department"
 	district_controller "project/internal/controller/http/v1/district"
+	introspect_controller "project/internal/controller/http/v1/introspect"
+	invitation_controller "project/internal/controller/http/v1/invitation"
+	mfa_controller "project/internal/controller/http/v1/mfa"
+	permission_controller "project/internal/controller/http/v1/permission"
 	position_controller "project/internal/controller/http/v1/position"
 	region_controller "project/internal/controller/http/v1/region"
 	republic_controller "project/internal/controller/http/v1/republic"
+	session_controller "project/internal/controller/http/v1/session"
+	signin_controller "project/internal/controller/http/v1/signin"
 	user_controller "project/internal/controller/http/v1/user"
 )
 
@@ -29,100 +57,231 @@ type Router struct {
 	*web.App
 	postgresDB         *postgresql.Database
 	redisDB            *redis.Client
-	port               string
 	auth               *auth.Auth
 	fileServerBasePath string
+	smsSender          sms.Sender
+	tokenService       *token.Service
+	mfaIssuer          string
+	passwords          *password.Service
+	oidc               *oidc.Service
+	notifier           notify.Notifier
+	log                *log.Logger
 }
 
 func NewRouter(
 	app *web.App,
 	postgresDB *postgresql.Database,
 	redisDB *redis.Client,
-	port string,
 	auth *auth.Auth,
 	fileServerBasePath string,
+	smsSender sms.Sender,
+	tokenService *token.Service,
+	mfaIssuer string,
+	passwords *password.Service,
+	oidc *oidc.Service,
+	notifier notify.Notifier,
+	log *log.Logger,
 ) *Router {
 	return &Router{
 		app,
 		postgresDB,
 		redisDB,
-		port,
 		auth,
 		fileServerBasePath,
+		smsSender,
+		tokenService,
+		mfaIssuer,
+		passwords,
+		oidc,
+		notifier,
+		log,
 	}
 }
 
-func (r Router) Init() error {
+// Init registers the routes of the application, it is served by the caller.
+func (r Router) Init() {
 
 	// repositories:
 	// - postgresql
-	userPostgres := user.NewRepository(r.postgresDB)
+	userPostgres := user.NewRepository(r.postgresDB, r.passwords)
 	republicPostgres := republic.NewRepository(r.postgresDB)
 	departmentProgres := department.NewRepository(r.postgresDB)
 	positionProgres := position.NewRepository(r.postgresDB)
 	regionProgres := region.NewRepository(r.postgresDB)
 	districtProgres := district.NewRepository(r.postgresDB)
+	permissionPostgres := permission.NewRepository(r.postgresDB)
+	mfaPostgres := mfa.NewRepository(r.postgresDB)
+	apiKeyPostgres := apikey.NewRepository(r.postgresDB)
+	auditPostgres := audit.NewRepository(r.postgresDB)
+	signInPostgres := signin.NewRepository(r.postgresDB)
+
+	// - redis
+	sessionRedis := session.NewRepository(r.redisDB)
+	otpRedis := otp.NewRepository(r.redisDB)
+	lockoutRedis := lockout.NewRepository(r.redisDB)
+	mfaRedis := mfa_redis.NewRepository(r.redisDB)
+	oidcRedis := oidc_redis.NewRepository(r.redisDB)
+	userStateRedis := userstate_redis.NewRepository(r.redisDB)
+
+	// services
+	mfaService := mfa_service.NewService(mfaPostgres, r.mfaIssuer)
+	userStateService := userstate.NewService(userPostgres, permissionPostgres, userStateRedis)
+
+	// a nil service is kept out of the interface, so the controller sees it
+	// as disabled
+	var oidcProvider auth_controller.OIDC
+	if r.oidc != nil {
+		oidcProvider = r.oidc
+	}
 
 	// controller
-	userController := user_controller.NewController(userPostgres)
+	userController := user_controller.NewController(userPostgres, sessionRedis, userStateService, mfaService)
 	republicController := republic_controller.NewController(republicPostgres)
-	authController := auth_controller.NewController(userPostgres)
+	authController := auth_controller.NewController(r.tokenService, userPostgres, permissionPostgres, sessionRedis, otpRedis, r.smsSender, lockoutRedis, mfaService, mfaRedis, signInPostgres, oidcProvider, oidcRedis, r.log)
 	departmentController := department_controller.NewController(departmentProgres)
 	positionController := position_controller.NewController(positionProgres)
 	regionController := region_controller.NewController(regionProgres)
 	districtController := district_controller.NewController(districtProgres)
+	permissionController := permission_controller.NewController(permissionPostgres)
+	sessionController := session_controller.NewController(sessionRedis)
+	mfaController := mfa_controller.NewController(mfaService, mfaPostgres, userPostgres)
+	apiKeyController := apikey_controller.NewController(apiKeyPostgres)
+	auditController := audit_controller.NewController(auditPostgres)
+	signInController := signin_controller.NewController(signInPostgres)
+	invitationController := invitation_controller.NewController(userPostgres, r.notifier)
+	introspectController := introspect_controller.NewController(r.auth)
+
+	// refresh tokens, tokens of other issuers and tokens of ended sessions
+	// are rejected by middleware.Authenticate
+	r.auth.AddVerifier(r.tokenService.Verify)
+	r.auth.AddVerifier(sessionRedis.Verify)
+
+	// tokens of deleted and inactive users and tokens with an outdated role
+	// are rejected too
+	r.auth.AddVerifier(userStateService.Verify)
+
+	// integrations authenticate with the X-API-Key header, the keys of
+	// deleted and inactive creators and of creators with another role are
+	// rejected
+	r.auth.SetAPIKeyValidator(apiKeyPostgres.Authenticate)
+	r.auth.AddKeyVerifier(userStateService.Verify)
 
 	// #auth
+	r.Get("/.well-known/jwks.json", authController.JWKS)
 	r.Post("/api/v1/sign-in", authController.SignIn)
+	r.Post("/api/v1/sign-in/mfa", authController.SignInMFA)
+	r.Post("/api/v1/sign-in/mfa/enroll", authController.SignInMFAEnroll)
+	r.Post("/api/v1/sign-in/password", authController.SignInPassword)
+	r.Post("/api/v1/activate", invitationController.Activate)
+	r.Get("/api/v1/oidc/authorize", authController.OIDCAuthorize)
+	r.Post("/api/v1/oidc/callback", authController.OIDCCallback)
 	r.Post("/api/v1/refresh", authController.Refresh)
+	r.Post("/api/v1/logout", sessionController.Logout, middleware.Authenticate(r.auth))
+
+	// #introspect
+	// other services authenticate with the client credentials of an API key,
+	// tokens of users are not accepted
+	r.Post("/api/v1/introspect", introspectController.Introspect, middleware.Authenticate(r.auth, auth.PermTokenIntrospect), middleware.ClientCredentials())
+
+	// #password
+	r.Post("/api/v1/password/send-code", authController.SendSMSCode)
+	r.Post("/api/v1/password/check-code", authController.CheckSMSCode)
+	r.Post("/api/v1/password/reset", authController.SetPassword)
+
+	// #session
+	r.Get("/api/v1/sessions", sessionController.GetList, middleware.Authenticate(r.auth))
+	r.Delete("/api/v1/sessions", sessionController.RevokeAll, middleware.Authenticate(r.auth))
+	r.Delete("/api/v1/sessions/:id", sessionController.Revoke, middleware.Authenticate(r.auth))
+
+	// #me
+	r.Get("/api/v1/me", userController.GetMe, middleware.Authenticate(r.auth))
+	r.Patch("/api/v1/me", userController.UpdateMe, middleware.Authenticate(r.auth))
+	r.Post("/api/v1/me/password", userController.ChangePassword, middleware.Authenticate(r.auth))
+	r.Get("/api/v1/me/sign-ins", signInController.GetMyList, middleware.Authenticate(r.auth))
+
+	// #mfa
+	r.Get("/api/v1/mfa", mfaController.GetState, middleware.Authenticate(r.auth))
+	r.Delete("/api/v1/mfa", mfaController.Disable, middleware.Authenticate(r.auth))
+	r.Post("/api/v1/mfa/enroll", mfaController.Enroll, middleware.Authenticate(r.auth))
+	r.Post("/api/v1/mfa/confirm", mfaController.Confirm, middleware.Authenticate(r.auth))
+	r.Post("/api/v1/mfa/recovery-codes", mfaController.RegenerateRecoveryCodes, middleware.Authenticate(r.auth))
+	r.Get("/api/v1/mfa/policy", mfaController.GetPolicies, middleware.Authenticate(r.auth, auth.PermMFAManage))
+	r.Put("/api/v1/mfa/policy", mfaController.SetPolicy, middleware.Authenticate(r.auth, auth.PermMFAManage))
+
+	// #api-key
+	r.Get("/api/v1/api-key/list", apiKeyController.GetList, middleware.Authenticate(r.auth, auth.PermAPIKeyManage))
+	r.Get("/api/v1/api-key/:id", apiKeyController.GetDetailById, middleware.Authenticate(r.auth, auth.PermAPIKeyManage))
+	r.Post("/api/v1/api-key/create", apiKeyController.Create, middleware.Authenticate(r.auth, auth.PermAPIKeyManage))
+	r.Patch("/api/v1/api-key/:id", apiKeyController.UpdateColumns, middleware.Authenticate(r.auth, auth.PermAPIKeyManage))
+	r.Delete("/api/v1/api-key/:id", apiKeyController.Delete, middleware.Authenticate(r.auth, auth.PermAPIKeyManage))
+
+	// #audit-log
+	r.Get("/api/v1/audit-log/list", auditController.GetList, middleware.Authenticate(r.auth, auth.PermAuditRead))
+
+	// #sign-in-history
+	r.Get("/api/v1/sign-in-history/report", signInController.GetReport, middleware.Authenticate(r.auth, auth.PermSignInRead))
 
 	// #user
-	r.Get("/api/v1/user/list", userController.GetList, middleware.Authenticate(r.auth, auth.RoleAdmin))
-	r.Get("/api/v1/user/:id", userController.GetDetailById, middleware.Authenticate(r.auth, auth.RoleAdmin))
-	r.Post("/api/v1/user/create", userController.Create, middleware.Authenticate(r.auth, auth.RoleAdmin))
-	r.Put("/api/v1/user/:id", userController.UpdateAll, middleware.Authenticate(r.auth, auth.RoleAdmin))
-	r.Patch("/api/v1/user/:id", userController.UpdateColumns, middleware.Authenticate(r.auth, auth.RoleAdmin))
-	r.Delete("/api/v1/user/:id", userController.Delete, middleware.Authenticate(r.auth, auth.RoleAdmin))
+	r.Get("/api/v1/user/list", userController.GetList, middleware.Authenticate(r.auth, auth.PermUserRead))
+	r.Get("/api/v1/user/:id", userController.GetDetailById, middleware.Authenticate(r.auth, auth.PermUserRead))
+	r.Post("/api/v1/user/create", userController.Create, middleware.Authenticate(r.auth, auth.PermUserCreate))
+	r.Post("/api/v1/user/invite", invitationController.Invite, middleware.Authenticate(r.auth, auth.PermUserCreate))
+	r.Post("/api/v1/user/:id/invite", invitationController.Resend, middleware.Authenticate(r.auth, auth.PermUserCreate))
+	r.Put("/api/v1/user/:id", userController.UpdateAll, middleware.Authenticate(r.auth, auth.PermUserUpdate))
+	r.Patch("/api/v1/user/:id", userController.UpdateColumns, middleware.Authenticate(r.auth, auth.PermUserUpdate))
+	r.Delete("/api/v1/user/:id", userController.Delete, middleware.Authenticate(r.auth, auth.PermUserDelete))
+	r.Put("/api/v1/user/:id/status", userController.SetStatus, middleware.Authenticate(r.auth, auth.PermUserStatus))
+	r.Get("/api/v1/user/:id/sessions", sessionController.GetUserList, middleware.Authenticate(r.auth, auth.PermSessionManage))
+	r.Delete("/api/v1/user/:id/sessions", sessionController.RevokeUserAll, middleware.Authenticate(r.auth, auth.PermSessionManage))
+	r.Get("/api/v1/user/:id/departments", userController.GetDepartments, middleware.Authenticate(r.auth, auth.PermUserRead))
+	r.Put("/api/v1/user/:id/departments", userController.SetDepartments, middleware.Authenticate(r.auth, auth.PermStaffManage))
+	r.Delete("/api/v1/user/:id/mfa", mfaController.ResetUser, middleware.Authenticate(r.auth, auth.PermMFAManage))
+	r.Get("/api/v1/user/:id/sign-ins", signInController.GetUserList, middleware.Authenticate(r.auth, auth.PermSignInRead))
+	r.Post("/api/v1/user/:id/impersonate", authController.Impersonate, middleware.Authenticate(r.auth, auth.PermUserImpersonate))
+	r.Post("/api/v1/user/:id/unlock", authController.Unlock, middleware.Authenticate(r.auth, auth.PermUserUnlock))
 
 	// #republic
-	r.Get("/api/v1/republic/list", republicController.GetList, middleware.Authenticate(r.auth))
-	r.Get("/api/v1/republic/:id", republicController.GetRepublicDetailById, middleware.Authenticate(r.auth))
-	r.Post("/api/v1/republic/create", republicController.CreateRepublic, middleware.Authenticate(r.auth))
-	r.Put("/api/v1/republic/:id", republicController.UpdateRepublicAll, middleware.Authenticate(r.auth))
-	r.Patch("/api/v1/republic/:id", republicController.UpdateRepublicColumns, middleware.Authenticate(r.auth))
-	r.Delete("/api/v1/republic/:id", republicController.DeleteRepublic, middleware.Authenticate(r.auth))
+	r.Get("/api/v1/republic/list", republicController.GetList, middleware.Authenticate(r.auth, auth.PermRepublicRead))
+	r.Get("/api/v1/republic/:id", republicController.GetRepublicDetailById, middleware.Authenticate(r.auth, auth.PermRepublicRead))
+	r.Post("/api/v1/republic/create", republicController.CreateRepublic, middleware.Authenticate(r.auth, auth.PermRepublicCreate))
+	r.Put("/api/v1/republic/:id", republicController.UpdateRepublicAll, middleware.Authenticate(r.auth, auth.PermRepublicUpdate))
+	r.Patch("/api/v1/republic/:id", republicController.UpdateRepublicColumns, middleware.Authenticate(r.auth, auth.PermRepublicUpdate))
+	r.Delete("/api/v1/republic/:id", republicController.DeleteRepublic, middleware.Authenticate(r.auth, auth.PermRepublicDelete))
 
 	// #department
-	r.Get("/api/v1/department/list", departmentController.GetList, middleware.Authenticate(r.auth))
-	r.Get("/api/v1/department/:id", departmentController.GetDetailById, middleware.Authenticate(r.auth))
-	r.Post("/api/v1/department/create", departmentController.Create, middleware.Authenticate(r.auth))
-	r.Put("/api/v1/department/:id", departmentController.UpdateAll, middleware.Authenticate(r.auth))
-	r.Patch("/api/v1/department/:id", departmentController.UpdateColumns, middleware.Authenticate(r.auth))
-	r.Delete("/api/v1/department/:id", departmentController.Delete, middleware.Authenticate(r.auth))
+	r.Get("/api/v1/department/list", departmentController.GetList, middleware.Authenticate(r.auth, auth.PermDepartmentRead))
+	r.Get("/api/v1/department/:id", departmentController.GetDetailById, middleware.Authenticate(r.auth, auth.PermDepartmentRead))
+	r.Post("/api/v1/department/create", departmentController.Create, middleware.Authenticate(r.auth, auth.PermDepartmentCreate))
+	r.Put("/api/v1/department/:id", departmentController.UpdateAll, middleware.Authenticate(r.auth, auth.PermDepartmentUpdate))
+	r.Patch("/api/v1/department/:id", departmentController.UpdateColumns, middleware.Authenticate(r.auth, auth.PermDepartmentUpdate))
+	r.Delete("/api/v1/department/:id", departmentController.Delete, middleware.Authenticate(r.auth, auth.PermDepartmentDelete))
 
 	// #position
-	r.Get("/api/v1/position/list", positionController.GetList, middleware.Authenticate(r.auth))
-	r.Get("/api/v1/position/:id", positionController.GetDetailById, middleware.Authenticate(r.auth))
-	r.Post("/api/v1/position/create", positionController.Create, middleware.Authenticate(r.auth))
-	r.Put("/api/v1/position/:id", positionController.UpdateAll, middleware.Authenticate(r.auth))
-	r.Patch("/api/v1/position/:id", positionController.UpdateColumns, middleware.Authenticate(r.auth))
-	r.Delete("/api/v1/position/:id", positionController.Delete, middleware.Authenticate(r.auth))
+	r.Get("/api/v1/position/list", positionController.GetList, middleware.Authenticate(r.auth, auth.PermPositionRead))
+	r.Get("/api/v1/position/:id", positionController.GetDetailById, middleware.Authenticate(r.auth, auth.PermPositionRead))
+	r.Post("/api/v1/position/create", positionController.Create, middleware.Authenticate(r.auth, auth.PermPositionCreate))
+	r.Put("/api/v1/position/:id", positionController.UpdateAll, middleware.Authenticate(r.auth, auth.PermPositionUpdate))
+	r.Patch("/api/v1/position/:id", positionController.UpdateColumns, middleware.Authenticate(r.auth, auth.PermPositionUpdate))
+	r.Delete("/api/v1/position/:id", positionController.Delete, middleware.Authenticate(r.auth, auth.PermPositionDelete))
 
 	// #region
-	r.Get("/api/v1/region/list", regionController.GetRegionList, middleware.Authenticate(r.auth))
-	r.Get("/api/v1/region/:id", regionController.GetRegionDetailById, middleware.Authenticate(r.auth))
-	r.Post("/api/v1/region/create", regionController.CreateRegion, middleware.Authenticate(r.auth))
-	r.Put("/api/v1/region/:id", regionController.UpdateRegionAll, middleware.Authenticate(r.auth))
-	r.Patch("/api/v1/region/:id", regionController.UpdateRegionColumns, middleware.Authenticate(r.auth))
-	r.Delete("/api/v1/region/:id", regionController.DeleteRegion, middleware.Authenticate(r.auth))
+	r.Get("/api/v1/region/list", regionController.GetRegionList, middleware.Authenticate(r.auth, auth.PermRegionRead))
+	r.Get("/api/v1/region/:id", regionController.GetRegionDetailById, middleware.Authenticate(r.auth, auth.PermRegionRead))
+	r.Post("/api/v1/region/create", regionController.CreateRegion, middleware.Authenticate(r.auth, auth.PermRegionCreate))
+	r.Put("/api/v1/region/:id", regionController.UpdateRegionAll, middleware.Authenticate(r.auth, auth.PermRegionUpdate))
+	r.Patch("/api/v1/region/:id", regionController.UpdateRegionColumns, middleware.Authenticate(r.auth, auth.PermRegionUpdate))
+	r.Delete("/api/v1/region/:id", regionController.DeleteRegion, middleware.Authenticate(r.auth, auth.PermRegionDelete))
 
 	// #district
-	r.Get("/api/v1/district/list", districtController.GetList, middleware.Authenticate(r.auth))
-	r.Get("/api/v1/district/:id", districtController.GetDetailById, middleware.Authenticate(r.auth))
-	r.Post("/api/v1/district/create", districtController.Create, middleware.Authenticate(r.auth))
-	r.Put("/api/v1/district/:id", districtController.UpdateAll, middleware.Authenticate(r.auth))
-	r.Patch("/api/v1/district/:id", districtController.UpdateColumns, middleware.Authenticate(r.auth))
-	r.Delete("/api/v1/district/:id", districtController.Delete, middleware.Authenticate(r.auth))
-
-	return r.Run(r.port)
+	r.Get("/api/v1/district/list", districtController.GetList, middleware.Authenticate(r.auth, auth.PermDistrictRead))
+	r.Get("/api/v1/district/:id", districtController.GetDetailById, middleware.Authenticate(r.auth, auth.PermDistrictRead))
+	r.Post("/api/v1/district/create", districtController.Create, middleware.Authenticate(r.auth, auth.PermDistrictCreate))
+	r.Put("/api/v1/district/:id", districtController.UpdateAll, middleware.Authenticate(r.auth, auth.PermDistrictUpdate))
+	r.Patch("/api/v1/district/:id", districtController.UpdateColumns, middleware.Authenticate(r.auth, auth.PermDistrictUpdate))
+	r.Delete("/api/v1/district/:id", districtController.Delete, middleware.Authenticate(r.auth, auth.PermDistrictDelete))
+
+	// #permission
+	r.Get("/api/v1/permission/list", permissionController.GetList, middleware.Authenticate(r.auth, auth.PermPermissionManage))
+	r.Get("/api/v1/permission/role/:role", permissionController.GetRolePermissions, middleware.Authenticate(r.auth, auth.PermPermissionManage))
+	r.Put("/api/v1/permission/role/:role", permissionController.SetRolePermissions, middleware.Authenticate(r.auth, auth.PermPermissionManage))
 }
@@ -0,0 +1,231 @@
+// Package mfa implements TOTP two-factor authentication on top of the stored
+// secrets and recovery codes of users.
+package mfa
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/entity"
+	"project/internal/repository/postgres"
+	"project/internal/service/totp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotEnabled is returned for users without enabled two-factor
+	// authentication.
+	ErrNotEnabled = errors.New("two-factor authentication is not enabled")
+
+	// ErrIncorrectCode is returned when neither the code nor the recovery
+	// code is correct.
+	ErrIncorrectCode = errors.New("incorrect two-factor code")
+
+	// ErrCodeUsed is returned for a code that was used before. A code is
+	// valid for a few periods, it is accepted only once.
+	ErrCodeUsed = errors.New("two-factor code was already used, wait for the next one")
+)
+
+type Repository interface {
+	Get(ctx context.Context, userID int) (entity.UserMFA, error)
+	SetSecret(ctx context.Context, userID int, secret string) error
+	Enable(ctx context.Context, userID int, recoveryHashes []string) error
+	SetRecoveryCodes(ctx context.Context, userID int, recoveryHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, recoveryHash string) error
+	UseStep(ctx context.Context, userID int, step int64) (bool, error)
+	Disable(ctx context.Context, userID int) error
+	IsRequired(ctx context.Context, role string) (bool, error)
+}
+
+// State is whether a user has two-factor authentication and whether the
+// role of the user requires it.
+type State struct {
+	Enabled  bool
+	Required bool
+}
+
+// Enrollment is the secret of a new enrollment with its provisioning URI.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type Service struct {
+	repo   Repository
+	issuer string
+}
+
+// NewService creates the service. issuer is the name authenticator apps show
+// for the account.
+func NewService(repo Repository, issuer string) *Service {
+	return &Service{repo: repo, issuer: issuer}
+}
+
+// State returns the two-factor state of the user.
+func (s *Service) State(ctx context.Context, userID int, role string) (State, error) {
+	detail, err := s.get(ctx, userID)
+	if err != nil {
+		return State{}, err
+	}
+
+	required, err := s.repo.IsRequired(ctx, role)
+	if err != nil {
+		return State{}, err
+	}
+
+	return State{Enabled: detail.Enabled, Required: required}, nil
+}
+
+// Enroll creates a new secret for the user. It is enabled by Confirm.
+func (s *Service) Enroll(ctx context.Context, userID int, account string) (Enrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, web.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	if err = s.repo.SetSecret(ctx, userID, secret); err != nil {
+		return Enrollment{}, err
+	}
+
+	return Enrollment{Secret: secret, URI: totp.URI(s.issuer, account, secret)}, nil
+}
+
+// Confirm enables the enrolled secret once the user proves to have it with a
+// code, and returns new recovery codes. The codes are shown only once.
+func (s *Service) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	detail, err := s.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if detail.Secret == "" {
+		return nil, web.NewRequestError(errors.New("two-factor authentication is not enrolled"), http.StatusBadRequest)
+	}
+
+	if detail.Enabled {
+		return nil, web.NewRequestError(errors.New("two-factor authentication is already enabled"), http.StatusConflict)
+	}
+
+	if err = s.useCode(ctx, detail, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.repo.Enable(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks the code, or when it is empty the recovery code, of a user
+// with enabled two-factor authentication. A recovery code is used up.
+func (s *Service) Verify(ctx context.Context, userID int, code, recoveryCode string) error {
+	detail, err := s.get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !detail.Enabled {
+		return web.NewRequestError(ErrNotEnabled, http.StatusBadRequest)
+	}
+
+	if code != "" {
+		return s.useCode(ctx, detail, code)
+	}
+
+	if recoveryCode == "" {
+		return web.NewRequestError(ErrIncorrectCode, http.StatusBadRequest)
+	}
+
+	return s.repo.UseRecoveryCode(ctx, userID, totp.HashRecoveryCode(recoveryCode))
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after
+// checking a code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code, ""); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.repo.SetRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns two-factor authentication of the user off after checking a
+// code or a recovery code. It can not be turned off when the role requires
+// it.
+func (s *Service) Disable(ctx context.Context, userID int, role, code, recoveryCode string) error {
+	required, err := s.repo.IsRequired(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	if required {
+		return web.NewRequestError(errors.New("two-factor authentication is required for the role"), http.StatusForbidden)
+	}
+
+	if err = s.Verify(ctx, userID, code, recoveryCode); err != nil {
+		return err
+	}
+
+	return s.repo.Disable(ctx, userID)
+}
+
+// useCode checks the code and marks its time step as used, so the code is
+// accepted once.
+func (s *Service) useCode(ctx context.Context, detail entity.UserMFA, code string) error {
+	step, ok := totp.Step(detail.Secret, code, time.Now())
+	if !ok {
+		return web.NewRequestError(ErrIncorrectCode, http.StatusBadRequest)
+	}
+
+	fresh, err := s.repo.UseStep(ctx, detail.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return web.NewRequestError(ErrCodeUsed, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// get returns the settings of the user, users that never enrolled get the
+// zero value.
+func (s *Service) get(ctx context.Context, userID int) (entity.UserMFA, error) {
+	detail, err := s.repo.Get(ctx, userID)
+	if webErr, ok := err.(*web.Error); ok && webErr.Err == postgres.ErrNotFound {
+		return entity.UserMFA{UserID: userID}, nil
+	}
+
+	return detail, err
+}
+
+func recoveryCodes() ([]string, []string, error) {
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, web.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+
+	return codes, hashes, nil
+}
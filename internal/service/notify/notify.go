@@ -0,0 +1,103 @@
+// Package notify delivers account notifications, e.g. invitations, to users.
+package notify
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// These are the drivers that can be chosen with New.
+const (
+	DriverLog  = "log"
+	DriverFake = "fake"
+)
+
+// Invitation is sent to an invited user. The user activates the account with
+// the token.
+type Invitation struct {
+	UserID    int
+	Username  string
+	FullName  string
+	Phone     string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Notifier delivers notifications to users.
+type Notifier interface {
+	Invite(ctx context.Context, invitation Invitation) error
+}
+
+// New returns the notifier of the driver. activationURL is the page of the
+// frontend invited users open, the token is added as its "token" query
+// parameter.
+func New(driver string, logger *log.Logger, activationURL string) (Notifier, error) {
+	switch driver {
+	case DriverLog:
+		return NewLogNotifier(logger, activationURL), nil
+	case DriverFake:
+		return NewFakeNotifier(), nil
+	}
+
+	return nil, errors.Errorf("unknown notify driver %q", driver)
+}
+
+// ActivationLink returns the link of the invitation on the page.
+func ActivationLink(activationURL, token string) string {
+	link, err := url.Parse(activationURL)
+	if err != nil {
+		return activationURL + "?token=" + url.QueryEscape(token)
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
+
+// LogNotifier writes notifications to the log instead of sending them. It is
+// meant for local runs.
+type LogNotifier struct {
+	log           *log.Logger
+	activationURL string
+}
+
+func NewLogNotifier(logger *log.Logger, activationURL string) *LogNotifier {
+	return &LogNotifier{log: logger, activationURL: activationURL}
+}
+
+func (n *LogNotifier) Invite(ctx context.Context, invitation Invitation) error {
+	n.log.Printf("notify : invitation : user %d %q : %s : expires %s",
+		invitation.UserID, invitation.Username, ActivationLink(n.activationURL, invitation.Token), invitation.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// FakeNotifier keeps notifications in memory so they can be inspected.
+type FakeNotifier struct {
+	mu          sync.Mutex
+	invitations []Invitation
+}
+
+func NewFakeNotifier() *FakeNotifier {
+	return &FakeNotifier{}
+}
+
+func (n *FakeNotifier) Invite(ctx context.Context, invitation Invitation) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.invitations = append(n.invitations, invitation)
+	return nil
+}
+
+// Invitations returns the invitations sent so far.
+func (n *FakeNotifier) Invitations() []Invitation {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Invitation(nil), n.invitations...)
+}
@@ -0,0 +1,386 @@
+// Package oidc signs users in through an external OpenID Connect provider with
+// the authorization code flow and PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"project/internal/auth"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// keysRefreshInterval is how often the keys of the provider are fetched again
+// for unknown kids at most, so tokens with made up kids can not make the
+// service flood the provider.
+const keysRefreshInterval = time.Minute
+
+// ErrInvalidIDToken is returned for ID tokens that are not signed by the
+// provider or not issued for this client.
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// Config is the client registered at the provider.
+type Config struct {
+	// IssuerURL is the issuer of the provider, its configuration is read
+	// from IssuerURL/.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// Provision creates a user with ProvisionRole for identities that match
+	// no user. Otherwise they can not sign in.
+	Provision     bool
+	ProvisionRole string
+}
+
+// Identity is the user the provider signed in.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Nonce             string
+}
+
+// discovery is the part of the provider configuration the flow uses.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Service struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *discovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// NewService creates the service. The provider is contacted on the first
+// sign-in, so the service can start while the provider is down.
+func NewService(cfg Config, client *http.Client) *Service {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Service{cfg: cfg, client: client}
+}
+
+// Provision returns whether users are created for unknown identities and
+// their role.
+func (s *Service) Provision() (bool, string) {
+	return s.cfg.Provision, s.cfg.ProvisionRole
+}
+
+// AuthCodeURL returns the URL of the provider the user signs in at. state
+// and nonce are returned by the provider unchanged, verifier is the PKCE code
+// verifier that Exchange is called with.
+func (s *Service) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := s.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.cfg.ClientID},
+		"redirect_uri":          {s.cfg.RedirectURL},
+		"scope":                 {strings.Join(s.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the identity of its ID
+// token. The caller must compare Identity.Nonce with the nonce of the state.
+func (s *Service) Exchange(ctx context.Context, code, verifier string) (Identity, error) {
+	d, err := s.getDiscovery(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.cfg.RedirectURL},
+		"client_id":     {s.cfg.ClientID},
+		"client_secret": {s.cfg.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "creating token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "requesting tokens")
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return Identity{}, errors.Wrap(err, "decoding token response")
+	}
+
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return Identity{}, errors.Errorf("exchanging code : %d %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+
+	return s.verify(ctx, d, tokens.IDToken)
+}
+
+// verify checks the signature, issuer, audience and lifetime of the ID token.
+func (s *Service) verify(ctx context.Context, d *discovery, idToken string) (Identity, error) {
+	claims := jwt.MapClaims{}
+
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512"}}
+	_, err := parser.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.getKey(ctx, d, kid)
+	})
+	if err != nil {
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, err.Error())
+	}
+
+	if iss, _ := claims["iss"].(string); iss != d.Issuer {
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "unexpected issuer")
+	}
+
+	if !hasAudience(claims["aud"], s.cfg.ClientID) {
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "unexpected audience")
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "missing expiry")
+	}
+
+	var identity Identity
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	identity.Nonce, _ = claims["nonce"].(string)
+
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	if identity.Subject == "" {
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "missing subject")
+	}
+
+	return identity, nil
+}
+
+func (s *Service) getDiscovery(ctx context.Context) (*discovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+
+	var d discovery
+	if err := s.getJSON(ctx, strings.TrimSuffix(s.cfg.IssuerURL, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, errors.Wrap(err, "discovering provider")
+	}
+
+	if d.Issuer != strings.TrimSuffix(s.cfg.IssuerURL, "/") && d.Issuer != s.cfg.IssuerURL {
+		return nil, errors.Errorf("provider issuer %q does not match %q", d.Issuer, s.cfg.IssuerURL)
+	}
+
+	s.discovery = &d
+
+	return s.discovery, nil
+}
+
+// getKey returns the key of the kid. The keys are fetched again for unknown
+// kids, so rotated keys of the provider are picked up, but at most once every
+// keysRefreshInterval.
+func (s *Service) getKey(ctx context.Context, d *discovery, kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := lookupKey(s.keys, kid)
+	refresh := !ok && time.Since(s.keysFetched) >= keysRefreshInterval
+	if refresh {
+		s.keysFetched = time.Now()
+	}
+	s.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if !refresh {
+		return nil, errors.Errorf("unknown provider key %q", kid)
+	}
+
+	// The provider is not called under the lock, signing in with the known
+	// keys goes on while the keys are fetched.
+	keys, err := s.fetchKeys(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	key, ok = lookupKey(keys, kid)
+	if !ok {
+		return nil, errors.Errorf("unknown provider key %q", kid)
+	}
+
+	return key, nil
+}
+
+// fetchKeys returns the signing keys of the provider by kid.
+func (s *Service) fetchKeys(ctx context.Context, d *discovery) (map[string]*rsa.PublicKey, error) {
+	var set auth.JWKS
+	if err := s.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, errors.Wrap(err, "fetching provider keys")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		key, err := parseKey(jwk)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing provider key %q", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// lookupKey returns the key of the kid. A provider with one key may leave
+// the kid out of its tokens.
+func lookupKey(keys map[string]*rsa.PublicKey, kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+
+	key, ok := keys[kid]
+	return key, ok
+}
+
+func (s *Service) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewState returns a random value for the state and nonce parameters.
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+// Challenge returns the S256 PKCE code challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "reading random bytes")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func parseKey(jwk auth.JWK) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding modulus")
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"project/internal/service/oidc"
+	"project/internal/service/oidc/oidctest"
+	"testing"
+)
+
+func TestExchangeLimitsKeyFetches(t *testing.T) {
+	provider, err := oidctest.New("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+
+	provider.SetUser(oidctest.User{Subject: "subject"})
+	service := oidc.NewService(provider.Config("http://localhost/callback"), nil)
+
+	exchange := func() error {
+		verifier, err := oidc.NewVerifier()
+		if err != nil {
+			return err
+		}
+
+		authURL, err := service.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+		if err != nil {
+			return err
+		}
+
+		code, _, err := provider.Authorize(authURL)
+		if err != nil {
+			return err
+		}
+
+		_, err = service.Exchange(context.Background(), code, verifier)
+		return err
+	}
+
+	if err = exchange(); err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if err = exchange(); err != nil {
+		t.Fatalf("exchange with the known key: %v", err)
+	}
+	if got := provider.JWKSRequests(); got != 1 {
+		t.Fatalf("keys fetched %d times, want 1", got)
+	}
+
+	// The keys were fetched just now, the unknown kid is not looked up at
+	// the provider again.
+	if err = provider.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = exchange(); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Fatalf("exchange with an unknown key: got %v, want %v", err, oidc.ErrInvalidIDToken)
+		}
+	}
+	if got := provider.JWKSRequests(); got != 1 {
+		t.Errorf("keys fetched %d times, want 1", got)
+	}
+}
@@ -0,0 +1,178 @@
+// Package password checks new passwords against the password policy and
+// hashes them with the configured bcrypt cost.
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"project/foundation/web"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// common is a list of the most used and most often breached passwords, one
+// per line.
+//
+//go:embed common.txt
+var common string
+
+// Config is the password policy.
+type Config struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// RejectCommon rejects the passwords of the embedded list.
+	RejectCommon bool
+
+	// HistorySize is how many recent passwords of a user can not be used
+	// again, 0 allows every password.
+	HistorySize int
+
+	// Cost is the bcrypt cost of new hashes. Hashes of another cost are
+	// replaced on the next sign-in.
+	Cost int
+}
+
+type Service struct {
+	cfg       Config
+	common    map[string]struct{}
+	dummyHash []byte
+}
+
+// NewService creates the service. An invalid cost is replaced by
+// bcrypt.DefaultCost.
+func NewService(cfg Config) (*Service, error) {
+	if cfg.Cost < bcrypt.MinCost || cfg.Cost > bcrypt.MaxCost {
+		cfg.Cost = bcrypt.DefaultCost
+	}
+
+	s := Service{
+		cfg:    cfg,
+		common: make(map[string]struct{}),
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(common))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			s.common[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	var err error
+	if s.dummyHash, err = bcrypt.GenerateFromPassword([]byte("dummy password"), cfg.Cost); err != nil {
+		return nil, errors.Wrap(err, "hashing dummy password")
+	}
+
+	return &s, nil
+}
+
+// Validate checks the password against the policy. username is rejected as
+// a password. Every failed rule is listed in the error.
+func (s *Service) Validate(password, username string) error {
+	var (
+		upper, lower, digit, symbol bool
+		length                      int
+	)
+
+	for _, r := range password {
+		length++
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var problems []string
+
+	if length < s.cfg.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", s.cfg.MinLength))
+	}
+	if s.cfg.RequireUpper && !upper {
+		problems = append(problems, "an upper case letter")
+	}
+	if s.cfg.RequireLower && !lower {
+		problems = append(problems, "a lower case letter")
+	}
+	if s.cfg.RequireDigit && !digit {
+		problems = append(problems, "a digit")
+	}
+	if s.cfg.RequireSymbol && !symbol {
+		problems = append(problems, "a symbol")
+	}
+
+	if len(problems) > 0 {
+		return web.NewRequestError(errors.Errorf("password must contain %s", strings.Join(problems, ", ")), http.StatusBadRequest)
+	}
+
+	if username != "" && strings.EqualFold(password, username) {
+		return web.NewRequestError(errors.New("password can not be the username"), http.StatusBadRequest)
+	}
+
+	if s.cfg.RejectCommon {
+		if _, ok := s.common[strings.ToLower(password)]; ok {
+			return web.NewRequestError(errors.New("password is too common"), http.StatusBadRequest)
+		}
+	}
+
+	return nil
+}
+
+// CheckHistory rejects the password when it matches one of the hashes of the
+// recent passwords of the user.
+func (s *Service) CheckHistory(password string, hashes []string) error {
+	for i := range hashes {
+		if s.Compare(&hashes[i], password) {
+			return web.NewRequestError(errors.Errorf("password can not be one of the last %d passwords", s.cfg.HistorySize), http.StatusBadRequest)
+		}
+	}
+
+	return nil
+}
+
+// Hash hashes the password with the configured cost.
+func (s *Service) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cfg.Cost)
+	if err != nil {
+		return "", errors.Wrap(err, "hashing password")
+	}
+
+	return string(hash), nil
+}
+
+// Compare reports whether the password matches the hash. A nil hash is
+// compared with a dummy hash, so unknown users take as long as wrong
+// passwords.
+func (s *Service) Compare(hash *string, password string) bool {
+	if hash == nil {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(*hash), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether the hash was made with another cost than the
+// configured one.
+func (s *Service) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != s.cfg.Cost
+}
+
+// HistorySize returns how many recent passwords can not be used again.
+func (s *Service) HistorySize() int {
+	return s.cfg.HistorySize
+}
@@ -0,0 +1,162 @@
+package password
+
+import (
+	"net/http"
+	"project/foundation/web"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidate(t *testing.T) {
+	s, err := NewService(Config{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		RejectCommon:  true,
+		Cost:          bcrypt.MinCost,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		username string
+		want     string
+	}{
+		{name: "valid", password: "Correct-Horse-7"},
+		{name: "unicode letters", password: "Пароль-Надёжный-7"},
+		{name: "too short", password: "Sh0rt-pw", want: "password must contain at least 10 characters"},
+		{name: "length in characters", password: "Пар-0ль-Ок"},
+		{name: "missing upper", password: "correct-horse-7", want: "password must contain an upper case letter"},
+		{name: "missing lower", password: "CORRECT-HORSE-7", want: "password must contain a lower case letter"},
+		{name: "missing digit", password: "Correct-Horse-X", want: "password must contain a digit"},
+		{name: "missing symbol", password: "CorrectHorse7", want: "password must contain a symbol"},
+		{name: "every problem", password: "abc", want: "password must contain at least 10 characters, an upper case letter, a digit, a symbol"},
+		{name: "username", password: "Ali.Valiyev-1", username: "ali.valiyev-1", want: "password can not be the username"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate(tt.password, tt.username)
+			checkError(t, err, tt.want)
+		})
+	}
+}
+
+func TestValidateCommon(t *testing.T) {
+	tests := []struct {
+		name         string
+		rejectCommon bool
+		password     string
+		want         string
+	}{
+		{name: "common", rejectCommon: true, password: "password123", want: "password is too common"},
+		{name: "common in another case", rejectCommon: true, password: "PASSWORD123", want: "password is too common"},
+		{name: "common allowed", password: "password123"},
+		{name: "uncommon", rejectCommon: true, password: "unlisted-passphrase"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewService(Config{RejectCommon: tt.rejectCommon, Cost: bcrypt.MinCost})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkError(t, s.Validate(tt.password, ""), tt.want)
+		})
+	}
+}
+
+func TestCheckHistory(t *testing.T) {
+	s, err := NewService(Config{HistorySize: 3, Cost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var history []string
+	for _, p := range []string{"first-password", "second-password", "third-password"} {
+		hash, err := s.Hash(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, hash)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		hashes   []string
+		want     string
+	}{
+		{name: "new password", password: "fourth-password", hashes: history},
+		{name: "current password", password: "first-password", hashes: history, want: "password can not be one of the last 3 passwords"},
+		{name: "oldest kept password", password: "third-password", hashes: history, want: "password can not be one of the last 3 passwords"},
+		{name: "forgotten password", password: "third-password", hashes: history[:2]},
+		{name: "without history", password: "first-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkError(t, s.CheckHistory(tt.password, tt.hashes), tt.want)
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	s, err := NewService(Config{Cost: bcrypt.MinCost + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := s.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{name: "configured cost", hash: current},
+		{name: "other cost", hash: string(old), want: true},
+		{name: "not a bcrypt hash", hash: "plain", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// checkError fails unless err is a 400 with the message want, or nil when
+// want is empty.
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if want == "" {
+		if err != nil {
+			t.Errorf("got %v, want no error", err)
+		}
+		return
+	}
+
+	webErr, ok := err.(*web.Error)
+	if !ok || webErr.Status != http.StatusBadRequest || webErr.Err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,91 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// These are the drivers that can be chosen with New.
+const (
+	DriverLog  = "log"
+	DriverFake = "fake"
+)
+
+// Sender delivers a text message to a phone number.
+type Sender interface {
+	Send(ctx context.Context, phone, text string) error
+}
+
+// New returns the sender of the driver.
+func New(driver string, logger *log.Logger) (Sender, error) {
+	switch driver {
+	case DriverLog:
+		return NewLogSender(logger), nil
+	case DriverFake:
+		return NewFakeSender(), nil
+	}
+
+	return nil, errors.Errorf("unknown sms driver %q", driver)
+}
+
+// LogSender writes messages to the log instead of sending them. It is meant
+// for local runs.
+type LogSender struct {
+	log *log.Logger
+}
+
+func NewLogSender(logger *log.Logger) *LogSender {
+	return &LogSender{log: logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, phone, text string) error {
+	s.log.Printf("sms : to %s : %s", phone, text)
+	return nil
+}
+
+// Message is a message kept by FakeSender.
+type Message struct {
+	Phone string
+	Text  string
+}
+
+// FakeSender keeps messages in memory so they can be inspected.
+type FakeSender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewFakeSender() *FakeSender {
+	return &FakeSender{}
+}
+
+func (s *FakeSender) Send(ctx context.Context, phone, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, Message{Phone: phone, Text: text})
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (s *FakeSender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// NormalizePhone keeps only the digits of a phone number, so "+998 (90)
+// 123-45-67" and "998901234567" are stored and looked up the same way.
+func NormalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,58 @@
+// Package stats publishes business figures, e.g. the number of users, as
+// metrics. They are read from the database when the metrics are scraped.
+package stats
+
+import (
+	"context"
+	"log"
+	"project/internal/repository/postgres/user"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// timeout bounds the queries of a scrape.
+const timeout = 5 * time.Second
+
+type Users interface {
+	GetCounts(ctx context.Context) ([]user.CountResponse, error)
+}
+
+// Collector is a prometheus.Collector of the business figures.
+type Collector struct {
+	users Users
+	log   *log.Logger
+
+	usersDesc *prometheus.Desc
+}
+
+func NewCollector(users Users, log *log.Logger) *Collector {
+	return &Collector{
+		users: users,
+		log:   log,
+		usersDesc: prometheus.NewDesc("users",
+			"Number of users that are not deleted by role and status.",
+			[]string{"role", "status"}, nil),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.usersDesc
+}
+
+// Collect reads the figures. Figures that can not be read are left out of the
+// scrape, so their series have gaps instead of wrong values.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	counts, err := c.users.GetCounts(ctx)
+	if err != nil {
+		c.log.Printf("stats : collecting users : %v", err)
+		return
+	}
+
+	for _, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.usersDesc, prometheus.GaugeValue, float64(count.Count), count.Role, count.Status)
+	}
+}
@@ -0,0 +1,286 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"project/internal/auth"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// These are the expected values for Claims.Type.
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+	TypeMFA     = "mfa"
+
+	TypePasswordChange = "password_change"
+)
+
+// Config holds the values written into every issued token.
+type Config struct {
+	Issuer          string
+	Audience        string
+	AccessLifetime  time.Duration
+	RefreshLifetime time.Duration
+
+	// MFALifetime is how long a user has to enter the two-factor code
+	// after the password.
+	MFALifetime time.Duration
+
+	// ImpersonationLifetime is the lifetime of impersonation tokens, they
+	// can not be refreshed.
+	ImpersonationLifetime time.Duration
+
+	// PasswordChangeLifetime is how long a user whose password has to be
+	// changed has to choose the new one after signing in.
+	PasswordChangeLifetime time.Duration
+}
+
+// Subject is the user a pair of tokens is issued for.
+type Subject struct {
+	UserID      int
+	Role        string
+	Permissions []string
+	SessionID   string
+
+	// TokenID is the jti of the refresh token.
+	TokenID string
+
+	// ActorID is the admin impersonating the user.
+	ActorID int
+}
+
+// Pair is an access token with the refresh token that renews it.
+type Pair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Service issues and checks tokens with the keys of the auth.Auth built in
+// main, so the auth settings of the config control every issued token.
+type Service struct {
+	auth *auth.Auth
+	cfg  Config
+}
+
+func NewService(a *auth.Auth, cfg Config) *Service {
+	return &Service{auth: a, cfg: cfg}
+}
+
+// RefreshLifetime returns the lifetime of refresh tokens.
+func (s *Service) RefreshLifetime() time.Duration {
+	return s.cfg.RefreshLifetime
+}
+
+// MFALifetime returns the lifetime of mfa pending tokens.
+func (s *Service) MFALifetime() time.Duration {
+	return s.cfg.MFALifetime
+}
+
+// JWKS returns the public keys that verify the issued tokens.
+func (s *Service) JWKS() auth.JWKS {
+	return s.auth.JWKS()
+}
+
+// Issue signs an access and a refresh token for the subject with the active
+// key.
+//
+// iss (issuer): Issuer of the JWT
+// sub (subject): Subject of the JWT (the user)
+// aud (audience): Recipient for which the JWT is intended
+// exp (expiration time): Time after which the JWT expires
+// iat (issued at time): Time at which the JWT was issued
+// jti (JWT ID): Unique identifier of the refresh token, used to rotate it
+func (s *Service) Issue(subject Subject) (Pair, error) {
+	now := time.Now()
+	kid := s.auth.ActiveKID()
+
+	accessClaims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  s.cfg.Audience,
+			Subject:   fmt.Sprint(subject.UserID),
+			ExpiresAt: now.Add(s.cfg.AccessLifetime).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		UserId:      subject.UserID,
+		Role:        subject.Role,
+		Permissions: subject.Permissions,
+		Type:        TypeAccess,
+		SessionID:   subject.SessionID,
+	}
+
+	refreshClaims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  s.cfg.Audience,
+			Subject:   fmt.Sprint(subject.UserID),
+			ExpiresAt: now.Add(s.cfg.RefreshLifetime).Unix(),
+			Id:        subject.TokenID,
+			IssuedAt:  now.Unix(),
+		},
+		UserId:    subject.UserID,
+		Role:      subject.Role,
+		Type:      TypeRefresh,
+		SessionID: subject.SessionID,
+	}
+
+	accessToken, err := s.auth.GenerateToken(kid, accessClaims)
+	if err != nil {
+		return Pair{}, errors.Wrap(err, "generating access token")
+	}
+
+	refreshToken, err := s.auth.GenerateToken(kid, refreshClaims)
+	if err != nil {
+		return Pair{}, errors.Wrap(err, "generating refresh token")
+	}
+
+	return Pair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// IssueMFA signs an mfa pending token for the subject. It proves that the
+// password was correct and is exchanged for a pair once the two-factor code
+// is verified. It is not accepted by Verify.
+func (s *Service) IssueMFA(subject Subject) (string, error) {
+	mfaToken, err := s.issuePending(subject, TypeMFA, s.cfg.MFALifetime)
+	if err != nil {
+		return "", errors.Wrap(err, "generating mfa token")
+	}
+
+	return mfaToken, nil
+}
+
+// IssuePasswordChange signs a password change token for the subject. It
+// proves that the password was correct and lets a user whose password has
+// to be changed set a new one. It is not accepted by Verify.
+func (s *Service) IssuePasswordChange(subject Subject) (string, error) {
+	passwordToken, err := s.issuePending(subject, TypePasswordChange, s.cfg.PasswordChangeLifetime)
+	if err != nil {
+		return "", errors.Wrap(err, "generating password change token")
+	}
+
+	return passwordToken, nil
+}
+
+// issuePending signs a token of a sign-in that needs another step.
+func (s *Service) issuePending(subject Subject, tokenType string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  s.cfg.Audience,
+			Subject:   fmt.Sprint(subject.UserID),
+			ExpiresAt: now.Add(lifetime).Unix(),
+			Id:        subject.TokenID,
+			IssuedAt:  now.Unix(),
+		},
+		UserId: subject.UserID,
+		Role:   subject.Role,
+		Type:   tokenType,
+	}
+
+	return s.auth.GenerateToken(s.auth.ActiveKID(), claims)
+}
+
+// IssueImpersonation signs an access token of the subject for the admin of
+// subject.ActorID. There is no refresh token, the token belongs to the
+// session of the admin and ends with it. The session is not one of the
+// subject, so the routes of the own sessions refuse the token.
+func (s *Service) IssueImpersonation(subject Subject) (string, error) {
+	now := time.Now()
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.cfg.Issuer,
+			Audience:  s.cfg.Audience,
+			Subject:   fmt.Sprint(subject.UserID),
+			ExpiresAt: now.Add(s.cfg.ImpersonationLifetime).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		UserId:      subject.UserID,
+		Role:        subject.Role,
+		Permissions: subject.Permissions,
+		Type:        TypeAccess,
+		SessionID:   subject.SessionID,
+		ActorID:     subject.ActorID,
+	}
+
+	accessToken, err := s.auth.GenerateToken(s.auth.ActiveKID(), claims)
+	if err != nil {
+		return "", errors.Wrap(err, "generating impersonation token")
+	}
+
+	return accessToken, nil
+}
+
+// ImpersonationLifetime returns the lifetime of impersonation tokens.
+func (s *Service) ImpersonationLifetime() time.Duration {
+	return s.cfg.ImpersonationLifetime
+}
+
+// ParseMFA checks an mfa pending token and returns its claims.
+func (s *Service) ParseMFA(mfaToken string) (auth.Claims, error) {
+	claims, err := s.auth.ValidateToken(mfaToken)
+	if err != nil || s.checkClaims(claims, TypeMFA) != nil || claims.Id == "" {
+		return auth.Claims{}, errors.New("invalid mfa token")
+	}
+
+	return claims, nil
+}
+
+// ParsePasswordChange checks a password change token and returns its claims.
+func (s *Service) ParsePasswordChange(passwordToken string) (auth.Claims, error) {
+	claims, err := s.auth.ValidateToken(passwordToken)
+	if err != nil || s.checkClaims(claims, TypePasswordChange) != nil || claims.Id == "" {
+		return auth.Claims{}, errors.New("invalid password change token")
+	}
+
+	return claims, nil
+}
+
+// ParseRefresh checks a refresh token and the access token it was issued
+// with, which may be expired, and returns the claims of the refresh token.
+func (s *Service) ParseRefresh(accessToken, refreshToken string) (auth.Claims, error) {
+	accessClaims, err := s.auth.ValidateExpiredToken(accessToken)
+	if err != nil || s.checkClaims(accessClaims, TypeAccess) != nil {
+		return auth.Claims{}, errors.New("invalid access token")
+	}
+
+	refreshClaims, err := s.auth.ValidateToken(refreshToken)
+	if err != nil || s.checkClaims(refreshClaims, TypeRefresh) != nil || refreshClaims.Id == "" {
+		return auth.Claims{}, errors.New("invalid refresh token")
+	}
+
+	// Check if the refresh token matches the user in the expired access token
+	if accessClaims.UserId != refreshClaims.UserId || accessClaims.SessionID != refreshClaims.SessionID {
+		return auth.Claims{}, errors.New("token user ID mismatch")
+	}
+
+	return refreshClaims, nil
+}
+
+// Verify is an auth.ClaimsVerifier accepting only access tokens issued by
+// this service.
+func (s *Service) Verify(ctx context.Context, claims auth.Claims) error {
+	return s.checkClaims(claims, TypeAccess)
+}
+
+func (s *Service) checkClaims(claims auth.Claims, tokenType string) error {
+	if claims.Type != tokenType {
+		return errors.Errorf("unexpected token type %q", claims.Type)
+	}
+
+	if !claims.VerifyIssuer(s.cfg.Issuer, true) {
+		return errors.New("invalid token issuer")
+	}
+
+	if !claims.VerifyAudience(s.cfg.Audience, true) {
+		return errors.New("invalid token audience")
+	}
+
+	return nil
+}
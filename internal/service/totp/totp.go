@@ -0,0 +1,141 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as they
+// are used by authenticator apps: SHA1, 6 digits and a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Digits is the length of a code.
+	Digits = 6
+
+	// Period is how long a code is valid.
+	Period = 30 * time.Second
+
+	// Skew is how many periods before and after the current one are accepted,
+	// to allow for clock drift of the device.
+	Skew = 1
+
+	// RecoveryCodes is how many recovery codes are generated at once.
+	RecoveryCodes = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32 encoded secret.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.Wrap(err, "generating totp secret")
+	}
+
+	return encoding.EncodeToString(secret), nil
+}
+
+// URI returns the otpauth:// provisioning URI of the secret. Authenticator
+// apps add the account by scanning it as a QR code.
+func URI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+// Validate reports whether the code is valid for the secret at t.
+func Validate(secret, code string, t time.Time) bool {
+	_, ok := Step(secret, code, t)
+	return ok
+}
+
+// Step returns the time step the code is valid for at t. A code is accepted
+// in Skew steps around the current one, callers remember the step of a used
+// code to reject it when it is sent again.
+func Step(secret, code string, t time.Time) (int64, bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	counter := t.Unix() / int64(Period.Seconds())
+
+	var step int64
+	valid := false
+	for i := int64(-Skew); i <= Skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(generate(key, counter+i)), []byte(code)) == 1 {
+			step, valid = counter+i, true
+		}
+	}
+
+	return step, valid
+}
+
+// GenerateRecoveryCodes returns RecoveryCodes new single use codes.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodes)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.Wrap(err, "generating recovery codes")
+		}
+
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode returns the hash of a recovery code that is stored instead
+// of the code.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// generate returns the code of the counter (RFC 4226).
+func generate(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
@@ -0,0 +1,63 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStep(t *testing.T) {
+	// the secret of the test vectors of RFC 6238 for SHA1, their codes are
+	// cut to the last 6 digits
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		time   int64
+		step   int64
+		valid  bool
+	}{
+		{name: "rfc 6238 at 59", secret: secret, code: "287082", time: 59, step: 1, valid: true},
+		{name: "rfc 6238 at 1111111109", secret: secret, code: "081804", time: 1111111109, step: 37037036, valid: true},
+		{name: "rfc 6238 at 1234567890", secret: secret, code: "005924", time: 1234567890, step: 41152263, valid: true},
+		{name: "rfc 6238 at 2000000000", secret: secret, code: "279037", time: 2000000000, step: 66666666, valid: true},
+		{name: "one period late", secret: secret, code: "287082", time: 59 + 30, step: 1, valid: true},
+		{name: "one period early", secret: secret, code: "287082", time: 59 - 30, step: 1, valid: true},
+		{name: "two periods late", secret: secret, code: "287082", time: 59 + 60},
+		{name: "two periods early", secret: secret, code: "081804", time: 1111111109 - 60},
+		{name: "spaces and lower case secret", secret: " " + strings.ToLower(secret) + " ", code: " 287082 ", time: 59, step: 1, valid: true},
+		{name: "incorrect code", secret: secret, code: "287083", time: 59},
+		{name: "too short", secret: secret, code: "87082", time: 59},
+		{name: "too long", secret: secret, code: "94287082", time: 59},
+		{name: "invalid secret", secret: "not base32!", code: "287082", time: 59},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, valid := Step(tt.secret, tt.code, time.Unix(tt.time, 0))
+			if valid != tt.valid || step != tt.step {
+				t.Errorf("Step = %d, %v, want %d, %v", step, valid, tt.step, tt.valid)
+			}
+
+			if got := Validate(tt.secret, tt.code, time.Unix(tt.time, 0)); got != tt.valid {
+				t.Errorf("Validate = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("a1b2c-3d4e5")
+
+	for _, code := range []string{"a1b2c3d4e5", " A1B2C-3D4E5 "} {
+		if got := HashRecoveryCode(code); got != want {
+			t.Errorf("hash of %q differs from the hash of the printed code", code)
+		}
+	}
+
+	if HashRecoveryCode("a1b2c-3d4e6") == want {
+		t.Error("hashes of different codes are equal")
+	}
+}
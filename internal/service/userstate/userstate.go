@@ -0,0 +1,166 @@
+// Package userstate checks on every request that the user of a token still
+// exists, is active and holds the role of the token.
+package userstate
+
+import (
+	"context"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/entity"
+	"project/internal/pkg/repository/postgresql"
+	"project/internal/repository/postgres"
+	"project/internal/repository/redis/userstate"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUserNotFound is returned for tokens of deleted users.
+	ErrUserNotFound = errors.New("user of the token does not exist")
+
+	// ErrUserInactive is returned for tokens of users that are not active.
+	ErrUserInactive = errors.New("user of the token is not active")
+
+	// ErrRoleChanged is returned for tokens issued before the role of the
+	// user changed. A new sign-in issues a token with the current role.
+	ErrRoleChanged = errors.New("role of the user changed, sign in again")
+
+	// ErrPermissionsChanged is returned for tokens carrying a permission the
+	// role of the user no longer has.
+	ErrPermissionsChanged = errors.New("permissions of the user changed, sign in again")
+
+	// ErrImpersonationRevoked is returned for impersonation tokens of admins
+	// that no longer hold auth.PermUserImpersonate.
+	ErrImpersonationRevoked = errors.New("impersonating admin lost the permission to impersonate")
+)
+
+type Users interface {
+	GetById(ctx context.Context, id int) (entity.User, error)
+}
+
+type Permissions interface {
+	GetByRole(ctx context.Context, role string) ([]string, error)
+}
+
+type Cache interface {
+	Get(ctx context.Context, userID int) (userstate.State, bool, error)
+	Set(ctx context.Context, userID int, state userstate.State) error
+	Delete(ctx context.Context, userID int) error
+}
+
+type Service struct {
+	users       Users
+	permissions Permissions
+	cache       Cache
+}
+
+func NewService(users Users, permissions Permissions, cache Cache) *Service {
+	return &Service{users: users, permissions: permissions, cache: cache}
+}
+
+// Verify is an auth.ClaimsVerifier. The user of the claims has to be active
+// and hold their role and every permission of the claims, so permissions
+// taken from a role stop working before the tokens expire. The impersonating
+// admin of the claims is checked too, it has to be active and still hold
+// auth.PermUserImpersonate. For API keys the user is the creator of the key,
+// its keys stop working when it is deleted, made inactive or given another
+// role.
+func (s *Service) Verify(ctx context.Context, claims auth.Claims) error {
+	state, err := s.get(ctx, claims.UserId)
+	if err != nil {
+		return err
+	}
+
+	if err = check(state); err != nil {
+		return err
+	}
+
+	if state.Role != claims.Role {
+		return ErrRoleChanged
+	}
+
+	for _, permission := range claims.Permissions {
+		if !contains(state.Permissions, permission) {
+			return ErrPermissionsChanged
+		}
+	}
+
+	if claims.ActorID != 0 {
+		actor, err := s.get(ctx, claims.ActorID)
+		if err != nil {
+			return err
+		}
+
+		if err = check(actor); err != nil {
+			return errors.Wrap(err, "impersonating admin")
+		}
+
+		if !contains(actor.Permissions, auth.PermUserImpersonate) {
+			return ErrImpersonationRevoked
+		}
+	}
+
+	return nil
+}
+
+// Invalidate drops the cached state of the user. It is called after the
+// user is updated or deleted.
+func (s *Service) Invalidate(ctx context.Context, userID int) error {
+	return s.cache.Delete(ctx, userID)
+}
+
+func (s *Service) get(ctx context.Context, userID int) (userstate.State, error) {
+	state, ok, err := s.cache.Get(ctx, userID)
+	if err != nil {
+		return userstate.State{}, err
+	}
+	if ok {
+		return state, nil
+	}
+
+	// the state is cached for every caller, so it is read across the scope
+	detail, err := s.users.GetById(postgresql.Unscoped(ctx), userID)
+	if webErr, ok := err.(*web.Error); ok && webErr.Err == postgres.ErrNotFound {
+		state = userstate.State{Deleted: true}
+	} else if err != nil {
+		return userstate.State{}, err
+	} else {
+		state = userstate.State{Status: detail.StatusAt(time.Now())}
+		if detail.Role != nil {
+			state.Role = *detail.Role
+
+			if state.Permissions, err = s.permissions.GetByRole(ctx, state.Role); err != nil {
+				return userstate.State{}, err
+			}
+		}
+	}
+
+	if err = s.cache.Set(ctx, userID, state); err != nil {
+		return userstate.State{}, err
+	}
+
+	return state, nil
+}
+
+func check(state userstate.State) error {
+	if state.Deleted {
+		return ErrUserNotFound
+	}
+
+	if state.Status != entity.UserStatusActive {
+		return ErrUserInactive
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
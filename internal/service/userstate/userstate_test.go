@@ -0,0 +1,245 @@
+package userstate
+
+import (
+	"context"
+	"net/http"
+	"project/foundation/web"
+	"project/internal/auth"
+	"project/internal/entity"
+	"project/internal/repository/postgres"
+	"project/internal/repository/redis/userstate"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestVerify(t *testing.T) {
+	employee := auth.Claims{UserId: 2, Role: auth.RoleEmployee, Permissions: []string{auth.PermUserRead}}
+	impersonated := auth.Claims{UserId: 2, Role: auth.RoleEmployee, Permissions: []string{auth.PermUserRead}, ActorID: 1}
+
+	tests := []struct {
+		name   string
+		claims auth.Claims
+
+		// change changes the users and the permissions of the roles before
+		// the check.
+		change func(users *memoryUsers, permissions memoryPermissions)
+
+		err error
+	}{
+		{
+			name:   "active user",
+			claims: employee,
+		},
+		{
+			name:   "blocked user",
+			claims: employee,
+			change: func(users *memoryUsers, _ memoryPermissions) { users.setStatus(2, entity.UserStatusBlocked, nil) },
+			err:    ErrUserInactive,
+		},
+		{
+			name:   "block ended",
+			claims: employee,
+			change: func(users *memoryUsers, _ memoryPermissions) {
+				until := time.Now().AddDate(0, 0, -2)
+				users.setStatus(2, entity.UserStatusBlocked, &until)
+			},
+		},
+		{
+			name:   "deleted user",
+			claims: employee,
+			change: func(users *memoryUsers, _ memoryPermissions) { users.delete(2) },
+			err:    ErrUserNotFound,
+		},
+		{
+			name:   "role changed",
+			claims: employee,
+			change: func(users *memoryUsers, _ memoryPermissions) { users.setRole(2, auth.RoleStudent) },
+			err:    ErrRoleChanged,
+		},
+		{
+			name:   "permission taken from the role",
+			claims: employee,
+			change: func(_ *memoryUsers, permissions memoryPermissions) { permissions[auth.RoleEmployee] = nil },
+			err:    ErrPermissionsChanged,
+		},
+		{
+			name:   "impersonation",
+			claims: impersonated,
+		},
+		{
+			name:   "impersonating admin blocked",
+			claims: impersonated,
+			change: func(users *memoryUsers, _ memoryPermissions) { users.setStatus(1, entity.UserStatusBlocked, nil) },
+			err:    ErrUserInactive,
+		},
+		{
+			name:   "impersonate permission taken from the admin",
+			claims: impersonated,
+			change: func(_ *memoryUsers, permissions memoryPermissions) {
+				permissions[auth.RoleAdmin] = []string{auth.PermUserRead}
+			},
+			err: ErrImpersonationRevoked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, users, permissions, _ := newService(t)
+
+			if tt.change != nil {
+				tt.change(users, permissions)
+			}
+
+			if err := s.Verify(context.Background(), tt.claims); errors.Cause(err) != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyCache(t *testing.T) {
+	ctx := context.Background()
+	claims := auth.Claims{UserId: 2, Role: auth.RoleEmployee}
+
+	s, users, _, server := newService(t)
+
+	if err := s.Verify(ctx, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	// the state is cached, a change that does not invalidate it is seen
+	// only after the TTL
+	users.setStatus(2, entity.UserStatusBlocked, nil)
+	if err := s.Verify(ctx, claims); err != nil {
+		t.Fatalf("cached state: %v", err)
+	}
+	if reads := users.reads(2); reads != 1 {
+		t.Errorf("user read %d times, want once", reads)
+	}
+
+	server.FastForward(userstate.StateTTL)
+	if err := s.Verify(ctx, claims); err != ErrUserInactive {
+		t.Fatalf("after the TTL: got %v, want %v", err, ErrUserInactive)
+	}
+
+	// unblocking invalidates the state, so the user is let in at once
+	users.setStatus(2, entity.UserStatusActive, nil)
+	if err := s.Invalidate(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(ctx, claims); err != nil {
+		t.Fatalf("after unblocking: %v", err)
+	}
+
+	// and so does blocking
+	users.setStatus(2, entity.UserStatusBlocked, nil)
+	if err := s.Invalidate(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(ctx, claims); err != ErrUserInactive {
+		t.Fatalf("after blocking: got %v, want %v", err, ErrUserInactive)
+	}
+
+	// the cached state of the other users is kept
+	users.setStatus(1, entity.UserStatusBlocked, nil)
+	if err := s.Verify(ctx, auth.Claims{UserId: 1, Role: auth.RoleAdmin}); err != ErrUserInactive {
+		t.Fatalf("admin: got %v, want %v", err, ErrUserInactive)
+	}
+	users.setStatus(1, entity.UserStatusActive, nil)
+	if err := s.Invalidate(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(ctx, auth.Claims{UserId: 1, Role: auth.RoleAdmin}); err != ErrUserInactive {
+		t.Fatalf("admin after invalidating another user: got %v, want %v", err, ErrUserInactive)
+	}
+}
+
+// newService returns a service with the admin 1 and the employee 2, the
+// state is cached in miniredis.
+func newService(t *testing.T) (*Service, *memoryUsers, memoryPermissions, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	users := &memoryUsers{users: map[int]entity.User{
+		1: newUser(1, auth.RoleAdmin),
+		2: newUser(2, auth.RoleEmployee),
+	}, counts: make(map[int]int)}
+	permissions := memoryPermissions{
+		auth.RoleAdmin:    {auth.PermUserRead, auth.PermUserImpersonate},
+		auth.RoleEmployee: {auth.PermUserRead},
+	}
+
+	return NewService(users, permissions, userstate.NewRepository(client)), users, permissions, server
+}
+
+func newUser(id int, role string) entity.User {
+	u := entity.User{Role: &role, Status: entity.UserStatusActive}
+	u.ID = id
+	return u
+}
+
+type memoryUsers struct {
+	mu     sync.Mutex
+	users  map[int]entity.User
+	counts map[int]int
+}
+
+func (m *memoryUsers) GetById(ctx context.Context, id int) (entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counts[id]++
+
+	u, ok := m.users[id]
+	if !ok {
+		return entity.User{}, web.NewRequestError(postgres.ErrNotFound, http.StatusNotFound)
+	}
+
+	return u, nil
+}
+
+func (m *memoryUsers) reads(id int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.counts[id]
+}
+
+func (m *memoryUsers) setStatus(id int, status string, until *time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.users[id]
+	u.Status, u.StatusUntil = status, until
+	m.users[id] = u
+}
+
+func (m *memoryUsers) setRole(id int, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.users[id]
+	u.Role = &role
+	m.users[id] = u
+}
+
+func (m *memoryUsers) delete(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.users, id)
+}
+
+type memoryPermissions map[string][]string
+
+func (m memoryPermissions) GetByRole(ctx context.Context, role string) ([]string, error) {
+	return m[role], nil
+}